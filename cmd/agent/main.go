@@ -1,14 +1,31 @@
 package main
 
 import (
+	"context"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/avointsev/yp7m-go/internal/agent/metrics"
+	"github.com/avointsev/yp7m-go/internal/agent/scrape"
+	"github.com/avointsev/yp7m-go/internal/agent/spool"
 	"github.com/avointsev/yp7m-go/internal/flags"
 	"github.com/avointsev/yp7m-go/internal/logger"
+	"github.com/avointsev/yp7m-go/internal/models"
+	"github.com/avointsev/yp7m-go/internal/tlsconfig"
 )
 
+// buildVersion is reported to the server; set it with -ldflags "-X main.buildVersion=...".
+var buildVersion = "dev"
+
+// scrapeResult is the outcome of a scrape run outside the main loop.
+type scrapeResult struct {
+	batch metrics.Batch
+	took  time.Duration
+}
+
 func main() {
 	config, err := flags.ParseAgentConfig()
 	if err != nil {
@@ -16,16 +33,85 @@ func main() {
 	}
 
 	metricaSet := metrics.NewMetrics()
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	metricaSet.SetIdentity(models.Agent{
+		ID:        config.AgentID,
+		Hostname:  hostname,
+		Version:   buildVersion,
+		StartTime: time.Now(),
+	})
+	metricaSet.EnableTelemetry(config.AgentID)
+	if config.UseTLS() {
+		tlsConfig, err := tlsconfig.ClientConfig(config.TLSCAFile, config.TLSCertFile, config.TLSKeyFile)
+		if err != nil {
+			log.Fatalf("%s: %v", logger.ErrTLSConfig, err)
+		}
+		metricaSet.UseTLS(tlsConfig)
+	}
+	if config.SpoolPath != "" {
+		metricaSet.UseSpool(spool.New[metrics.Batch](config.SpoolPath, int64(config.SpoolMaxSize), config.SpoolMaxAge))
+	}
+
+	tickerPoll := time.NewTicker(config.PollInterval)
+	tickerReport := time.NewTicker(config.ReportInterval)
+
+	// scrapeC stays nil, and never fires, when no scrape targets are configured.
+	// Scrapes run in their own goroutine so that slow targets cannot hold up
+	// polling and reporting; a tick is skipped while a scrape is in flight.
+	var scraper *scrape.Scraper
+	var scrapeC <-chan time.Time
+	tickerScrape := time.NewTicker(config.ScrapeInterval)
+	if len(config.ScrapeTargets) > 0 {
+		scraper = scrape.New(config.ScrapeTargets)
+		scrapeC = tickerScrape.C
+	}
+	scraped := make(chan scrapeResult)
+	scraping := false
 
-	tickerPoll := time.NewTicker(config.ReportInterval)
-	tickerReport := time.NewTicker(config.PollInterval)
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
 
 	for {
 		select {
 		case <-tickerPoll.C:
+			start := time.Now()
 			metricaSet.UpdateMetrics()
+			metricaSet.RecordCollection("runtime", time.Since(start))
+		case <-scrapeC:
+			if scraping {
+				continue
+			}
+			scraping = true
+			go func(timeout time.Duration) {
+				ctx, cancel := context.WithTimeout(context.Background(), timeout)
+				defer cancel()
+				start := time.Now()
+				batch, _ := scraper.Scrape(ctx)
+				scraped <- scrapeResult{batch: batch, took: time.Since(start)}
+			}(scrape.Timeout(config.ScrapeInterval))
+		case result := <-scraped:
+			scraping = false
+			metricaSet.Collect(result.batch)
+			metricaSet.RecordCollection("scrape", result.took)
 		case <-tickerReport.C:
-			metricaSet.ReportMetrics(config.Address)
+			if err := metricaSet.ReportMetrics(config.Address); err != nil {
+				log.Printf("%s: %v", logger.ErrAgentSendRequest, err)
+			}
+		case <-reload:
+			next, err := flags.ParseAgentConfig()
+			if err != nil {
+				log.Printf("%s: %v", logger.ErrConfigReload, err)
+				continue
+			}
+			var changes []flags.Change
+			config, changes = flags.Reload(config, next)
+			flags.LogChanges(changes)
+			tickerPoll.Reset(config.PollInterval)
+			tickerReport.Reset(config.ReportInterval)
+			tickerScrape.Reset(config.ScrapeInterval)
 		}
 	}
 }
@@ -42,7 +42,7 @@ func TestMainFunction(_ *testing.T) {
 			case <-tickerPoll.C:
 				mockMetrics.UpdateMetrics()
 			case <-tickerReport.C:
-				mockMetrics.ReportMetrics(config.Address)
+				_ = mockMetrics.ReportMetrics(config.Address)
 			}
 		}
 	}()
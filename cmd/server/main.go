@@ -1,16 +1,45 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 
 	"github.com/avointsev/yp7m-go/internal/flags"
 	"github.com/avointsev/yp7m-go/internal/logger"
+	"github.com/avointsev/yp7m-go/internal/server/admin"
+	"github.com/avointsev/yp7m-go/internal/server/agents"
+	"github.com/avointsev/yp7m-go/internal/server/alerts"
+	"github.com/avointsev/yp7m-go/internal/server/grafana"
+	"github.com/avointsev/yp7m-go/internal/server/graphite"
 	"github.com/avointsev/yp7m-go/internal/server/handlers"
+	"github.com/avointsev/yp7m-go/internal/server/influx"
+	"github.com/avointsev/yp7m-go/internal/server/notify"
+	"github.com/avointsev/yp7m-go/internal/server/otlp"
+	"github.com/avointsev/yp7m-go/internal/server/recording"
+	"github.com/avointsev/yp7m-go/internal/server/remotewrite"
+	"github.com/avointsev/yp7m-go/internal/server/selfmetrics"
+	"github.com/avointsev/yp7m-go/internal/server/statsd"
 	"github.com/avointsev/yp7m-go/internal/server/storage"
+	"github.com/avointsev/yp7m-go/internal/server/stream"
+	"github.com/avointsev/yp7m-go/internal/tlsconfig"
+)
+
+const (
+	shutdownTimeout = 10 * time.Second
+	// expiryInterval is how often metrics past the purge TTL are removed.
+	expiryInterval = 10 * time.Second
 )
 
 func main() {
@@ -20,16 +49,286 @@ func main() {
 	}
 
 	store := storage.NewMemStorage()
+	store.SetHistoryRetention(config.HistoryRetention)
+	store.SetExpiry(config.StaleAfter, config.PurgeAfter)
+	if config.FileStoragePath != "" && config.Restore {
+		if err := store.LoadFile(config.FileStoragePath); err != nil {
+			log.Fatalf("%s: %v", logger.ErrStorageLoad, err)
+		}
+	}
+
+	registry := agents.New(config.AgentStale, config.AgentOffline, config.AgentForget)
+	guard := admin.New(config.AdminToken)
+	rules, err := loadRules(config.AlertRules)
+	if err != nil {
+		log.Fatalf("%s: %v", logger.ErrAlertRulesRead, err)
+	}
+	engine := alerts.New(store, rules)
+	var sink *notify.Sink
+	var sinkServer *http.Server
+	sinkURL := ""
+	if config.WebhookTest {
+		sink = notify.NewSink()
+		sinkServer, sinkURL, err = serveSink(sink)
+		if err != nil {
+			log.Fatalf("%s: %v", logger.ErrWebhookSink, err)
+		}
+	}
+	notifier := notify.New(webhookURLs(config, sinkURL), config.WebhookRepeat, config.WebhookRetries)
+	engine.OnEvaluate(notifier.Notify)
+	recordingRules, err := loadRecordingRules(config.RecordingRules)
+	if err != nil {
+		log.Fatalf("%s: %v", logger.ErrRecordingRulesRead, err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// recorder measures the server itself; every ingestion path and handler
+	// goes through the instrumented store, while flushes write to store directly.
+	// Writes accepted by the instrumented store are published to stream subscribers.
+	recorder := selfmetrics.New()
+	broker := stream.NewBroker()
+	instrumented := recorder.Wrap(broker.Wrap(store))
+	go recorder.Run(ctx, store, selfmetrics.DefaultInterval)
+
+	recordingEngine := recording.New(instrumented, recordingRules)
+	go recordingEngine.Run(ctx, config.RecordingInt)
+	go watchReload(config, store, registry, guard, engine, notifier, recordingEngine, sinkURL)
+
+	if config.FileStoragePath != "" && config.StoreInterval > 0 {
+		go persist(ctx, store, config.FileStoragePath, config.StoreInterval)
+	}
+	go expire(ctx, store)
+	go engine.Run(ctx, config.AlertInterval)
+	go notifier.Run(ctx)
+
+	// listeners tracks ingestion listeners that must finish flushing before the final save.
+	var listeners sync.WaitGroup
+
+	if config.StatsdAddress != "" {
+		statsdServer := statsd.New(instrumented, config.StatsdFlush)
+		listeners.Add(1)
+		go func() {
+			defer listeners.Done()
+			log.Printf("%s on udp://%s", logger.OkStatsdStarted, config.StatsdAddress)
+			if err := statsdServer.ListenAndServe(ctx, config.StatsdAddress); err != nil {
+				log.Printf("%s: %v", logger.ErrStatsdListener, err)
+			}
+		}()
+	}
+
+	if config.GraphiteAddress != "" {
+		graphiteServer := graphite.New(instrumented)
+		listeners.Add(1)
+		go func() {
+			defer listeners.Done()
+			log.Printf("%s on tcp://%s", logger.OkGraphiteStarted, config.GraphiteAddress)
+			if err := graphiteServer.ListenAndServe(ctx, config.GraphiteAddress); err != nil {
+				log.Printf("%s: %v", logger.ErrGraphiteListener, err)
+			}
+		}()
+	}
 
 	r := chi.NewRouter()
 	r.Use(middleware.Logger)
+	r.Use(recorder.Middleware)
+
+	r.Get("/", handlers.RootHandler(instrumented))
+	r.Get("/value/{type}/{name}", handlers.GetMetricHandler(instrumented))
+	r.Group(func(r chi.Router) {
+		r.Use(registry.Middleware)
+		r.Post("/update/{type}/{name}/{value}", handlers.UpdateMetricHandler(instrumented))
+		r.Post("/update/", handlers.UpdateJSONHandler(instrumented))
+	})
+	r.Post("/value/", handlers.ValueJSONHandler(instrumented))
+	r.Get("/metrics", handlers.PrometheusHandler(instrumented))
+	r.Get("/quantile/{name}", handlers.QuantileHandler(instrumented))
+	r.Get("/history/{type}/{name}", handlers.HistoryHandler(instrumented))
+	r.Get("/query", handlers.QueryHandler(instrumented))
+	r.Get("/query_range", handlers.QueryRangeHandler(instrumented))
+	r.Post("/write", influx.Handler(instrumented, config.InfluxCounters))
+	r.Post("/api/v1/write", remotewrite.Handler(instrumented))
+	r.Post("/v1/metrics", otlp.Handler(instrumented))
+	r.Get("/agents", handlers.AgentsHandler(registry))
+	r.Get("/ui/agents", handlers.AgentsPageHandler(registry))
+	r.Get("/stream", stream.Handler(broker))
+	r.Mount("/grafana", grafana.Router(instrumented, engine))
+	r.Get("/alerts", handlers.AlertsHandler(engine))
+	r.Get("/ui/alerts", handlers.AlertsPageHandler(engine))
+	if sink != nil {
+		r.Handle(notify.SinkPath, sink)
+	}
+	r.Group(func(r chi.Router) {
+		r.Use(guard.Middleware)
+		r.Delete("/value/{type}/{name}", handlers.DeleteMetricHandler(instrumented))
+		r.Delete("/value/", handlers.DeleteMatchingHandler(instrumented))
+		r.Post("/reset/{name}", handlers.ResetCounterHandler(instrumented))
+	})
+
+	server := &http.Server{
+		Addr:    config.Address,
+		Handler: r,
+	}
+	// Open streams would otherwise hold Shutdown until its timeout.
+	server.RegisterOnShutdown(broker.Close)
+	if config.UseTLS() {
+		server.TLSConfig, err = tlsconfig.ServerConfig(config.TLSCertFile, config.TLSKeyFile, config.TLSClientCAFile)
+		if err != nil {
+			log.Fatalf("%s: %v", logger.ErrTLSConfig, err)
+		}
+	}
+
+	go func() {
+		var err error
+		if server.TLSConfig != nil {
+			log.Printf("%s on https://%s", logger.OkServerStarted, config.Address)
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			log.Printf("%s on http://%s", logger.OkServerStarted, config.Address)
+			err = server.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("%s: %v", logger.ErrServerNotStarted, err)
+		}
+	}()
+
+	<-ctx.Done()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("%s: %v", logger.ErrServerInternalError, err)
+	}
+	if sinkServer != nil {
+		if err := sinkServer.Close(); err != nil {
+			log.Printf("%s: %v", logger.ErrServerInternalError, err)
+		}
+	}
+	listeners.Wait()
+	if config.FileStoragePath != "" {
+		if err := store.SaveFile(config.FileStoragePath); err != nil {
+			log.Printf("%s: %v", logger.ErrStorageSave, err)
+		}
+	}
+	log.Println(logger.OkServerStopped)
+}
+
+// persist saves the storage to path every interval until ctx is cancelled.
+func persist(ctx context.Context, store *storage.MemStorage, path string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := store.SaveFile(path); err != nil {
+				log.Printf("%s: %v", logger.ErrStorageSave, err)
+			}
+		}
+	}
+}
+
+// expire removes metrics past the purge TTL every expiryInterval until ctx is cancelled.
+func expire(ctx context.Context, store *storage.MemStorage) {
+	ticker := time.NewTicker(expiryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if removed := store.Expire(); removed > 0 {
+				log.Printf("%s: %d", logger.OkMetricsExpired, removed)
+			}
+		}
+	}
+}
+
+// watchReload re-reads the configuration on SIGHUP and applies runtime-safe changes.
+func watchReload(config flags.ServerConfig, store *storage.MemStorage, registry *agents.Registry, guard *admin.Guard,
+	engine *alerts.Engine, notifier *notify.Notifier, recordingEngine *recording.Engine, sinkURL string) {
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+
+	for range reload {
+		next, err := flags.ParseServerConfig()
+		if err != nil {
+			log.Printf("%s: %v", logger.ErrConfigReload, err)
+			continue
+		}
+		var changes []flags.Change
+		config, changes = flags.Reload(config, next)
+		flags.LogChanges(changes)
+		store.SetHistoryRetention(config.HistoryRetention)
+		store.SetExpiry(config.StaleAfter, config.PurgeAfter)
+		registry.SetThresholds(config.AgentStale, config.AgentOffline, config.AgentForget)
+		guard.SetToken(config.AdminToken)
+		if rules, err := loadRules(config.AlertRules); err != nil {
+			log.Printf("%s: %v", logger.ErrAlertRulesRead, err)
+		} else {
+			engine.SetRules(rules)
+		}
+		notifier.Configure(webhookURLs(config, sinkURL), config.WebhookRepeat, config.WebhookRetries)
+		if rules, err := loadRecordingRules(config.RecordingRules); err != nil {
+			log.Printf("%s: %v", logger.ErrRecordingRulesRead, err)
+		} else {
+			recordingEngine.SetRules(rules)
+		}
+	}
+}
+
+// loadRecordingRules reads the recording rules from path; an empty path means no rules.
+func loadRecordingRules(path string) ([]recording.Rule, error) {
+	if path == "" {
+		return nil, nil
+	}
+	rules, err := recording.LoadRules(path)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("%s: %d from %s", logger.OkRecordingRulesLoaded, len(rules), path)
+	return rules, nil
+}
+
+// webhookURLs returns the configured webhooks, plus the local test sink when sinkURL is set.
+func webhookURLs(config flags.ServerConfig, sinkURL string) []string {
+	urls := slices.Clone(config.WebhookURLs)
+	if sinkURL != "" {
+		urls = append(urls, sinkURL)
+	}
+	return urls
+}
 
-	r.Get("/", handlers.RootHandler(store))
-	r.Get("/value/{type}/{name}", handlers.GetMetricHandler(store))
-	r.Post("/update/{type}/{name}/{value}", handlers.UpdateMetricHandler(store))
+// serveSink serves the test sink over plain HTTP on a loopback port and returns
+// its URL. Notifications reach the sink this way even when the main server
+// requires TLS client certificates; the sink stays readable at SinkPath there.
+func serveSink(sink *notify.Sink) (*http.Server, string, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, "", err
+	}
+	server := &http.Server{Handler: sink}
+	go func() {
+		if err := server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("%s: %v", logger.ErrWebhookSink, err)
+		}
+	}()
+	return server, "http://" + ln.Addr().String() + notify.SinkPath, nil
+}
 
-	log.Printf("%s on http://%s", logger.OkServerStarted, config.Address)
-	if err := http.ListenAndServe(config.Address, r); err != nil {
-		log.Fatalf("%s: %v", logger.ErrServerNotStarted, err)
+// loadRules reads the alerting rules from path; an empty path means no rules.
+func loadRules(path string) ([]alerts.Rule, error) {
+	if path == "" {
+		return nil, nil
+	}
+	rules, err := alerts.LoadRules(path)
+	if err != nil {
+		return nil, err
 	}
+	log.Printf("%s: %d from %s", logger.OkAlertRulesLoaded, len(rules), path)
+	return rules, nil
 }
@@ -6,12 +6,15 @@ import (
 	"net/http"
 	"net/http/httptest"
 	_ "os"
+	"strings"
 	"testing"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 
+	"github.com/avointsev/yp7m-go/internal/flags"
 	"github.com/avointsev/yp7m-go/internal/server/handlers"
+	"github.com/avointsev/yp7m-go/internal/server/notify"
 	"github.com/avointsev/yp7m-go/internal/server/storage"
 )
 
@@ -80,3 +83,32 @@ func TestMainFunction(t *testing.T) {
 	// 	t.Errorf("unexpected log output: %v", logOutput)
 	// }
 }
+
+func TestServeSink(t *testing.T) {
+	sink := notify.NewSink()
+	server, sinkURL, err := serveSink(sink)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() {
+		if closeErr := server.Close(); closeErr != nil {
+			t.Errorf("error closing sink server: %v", closeErr)
+		}
+	}()
+
+	urls := webhookURLs(flags.ServerConfig{WebhookURLs: []string{"http://hooks.example/alert"}}, sinkURL)
+	if len(urls) != 2 || urls[1] != sinkURL || !strings.HasPrefix(sinkURL, "http://127.0.0.1:") {
+		t.Fatalf("expected the loopback sink after configured webhooks, got %v", urls)
+	}
+
+	resp, err := http.Post(sinkURL, "application/json", strings.NewReader(`{"status":"firing"}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if closeErr := resp.Body.Close(); closeErr != nil {
+		t.Errorf("error closing response body: %v", closeErr)
+	}
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("expected status 204, got %v", resp.StatusCode)
+	}
+}
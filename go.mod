@@ -3,3 +3,9 @@ module github.com/avointsev/yp7m-go
 go 1.22
 
 require github.com/go-chi/chi/v5 v5.1.0
+
+require (
+	github.com/golang/snappy v0.0.4
+	google.golang.org/protobuf v1.34.2
+	gopkg.in/yaml.v3 v3.0.1
+)
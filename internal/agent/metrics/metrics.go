@@ -1,23 +1,123 @@
 package metrics
 
 import (
+	"bytes"
+	"cmp"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math/rand"
 	"net/http"
+	"net/url"
 	"runtime"
+	"slices"
 	"strconv"
+	"time"
 
 	"github.com/avointsev/yp7m-go/internal/logger"
+	"github.com/avointsev/yp7m-go/internal/models"
 )
 
+// MetricType holds the latest gauges and the counter and histogram deltas not
+// yet acknowledged by the server.
 type MetricType struct {
-	Gauges   map[string]float64
-	Counters map[string]int64
+	Gauges     map[string]float64
+	Counters   map[string]int64
+	Histograms map[string]Histogram
+	client     *http.Client
+	spool      Spooler
+	telemetry  *telemetry
+	identity   *models.Agent
+	scheme     string
+}
+
+// Batch is a set of metric values reported together.
+type Batch struct {
+	Gauges     map[string]float64   `json:"gauges,omitempty"`
+	Counters   map[string]int64     `json:"counters,omitempty"`
+	Histograms map[string]Histogram `json:"histograms,omitempty"`
+}
+
+// Histogram holds cumulative bucket counts observed since the last report.
+// Count covers all observations, including those above the last bucket.
+type Histogram struct {
+	Buckets []models.Bucket `json:"buckets"`
+	Sum     float64         `json:"sum"`
+	Count   uint64          `json:"count"`
+}
+
+// add returns the sum of h and other. A histogram with different buckets
+// replaces h, as the two cannot be combined.
+func (h Histogram) add(other Histogram) Histogram {
+	sameBounds := slices.EqualFunc(h.Buckets, other.Buckets, func(a, b models.Bucket) bool {
+		return a.UpperBound == b.UpperBound
+	})
+	if !sameBounds {
+		other.Buckets = slices.Clone(other.Buckets)
+		return other
+	}
+	sum := Histogram{
+		Buckets: slices.Clone(h.Buckets),
+		Sum:     h.Sum + other.Sum,
+		Count:   h.Count + other.Count,
+	}
+	for i := range sum.Buckets {
+		sum.Buckets[i].Count += other.Buckets[i].Count
+	}
+	return sum
+}
+
+// Spooler keeps batches that could not be delivered.
+type Spooler interface {
+	Append(batch Batch) error
+	Entries() ([]Batch, error)
+	Ack(n int, rest *Batch) error
+}
+
+// Empty reports whether the batch has no values.
+func (b Batch) Empty() bool {
+	return b.size() == 0
+}
+
+func (b Batch) size() int {
+	return len(b.Gauges) + len(b.Counters) + len(b.Histograms)
+}
+
+// errRejected marks a value the server refused and would refuse again, such
+// as one with a reserved name. Such values are dropped instead of retried.
+var errRejected = errors.New(logger.ErrAgentRejected)
+
+// Merge combines batches in order: later gauge values win, counters and histograms are summed.
+func Merge(batches ...Batch) Batch {
+	merged := Batch{
+		Gauges:     make(map[string]float64),
+		Counters:   make(map[string]int64),
+		Histograms: make(map[string]Histogram),
+	}
+	for _, b := range batches {
+		merged.add(b)
+	}
+	return merged
+}
+
+func (b *Batch) add(other Batch) {
+	for name, value := range other.Gauges {
+		b.Gauges[name] = value
+	}
+	for name, value := range other.Counters {
+		b.Counters[name] += value
+	}
+	for name, value := range other.Histograms {
+		b.Histograms[name] = b.Histograms[name].add(value)
+	}
 }
 
 func NewMetrics() *MetricType {
 	return &MetricType{
+		client: &http.Client{},
+		scheme: "http",
 		Gauges: map[string]float64{
 			"Alloc":         0,
 			"BuckHashSys":   0,
@@ -51,6 +151,7 @@ func NewMetrics() *MetricType {
 		Counters: map[string]int64{
 			"PollCount": 0,
 		},
+		Histograms: make(map[string]Histogram),
 	}
 }
 
@@ -93,21 +194,89 @@ func (m *MetricType) UpdateMetrics() {
 	m.Counters["PollCount"]++
 }
 
-func (m *MetricType) SendMetric(destAddress string, metricatype string, name string, value interface{}) {
-	url := fmt.Sprintf("http://%s/update/%s/%s/%v", destAddress, metricatype, name, value)
+// Collect adds values gathered outside the runtime poll, such as scraped
+// metrics: gauges replace current values, counter and histogram deltas accumulate.
+func (m *MetricType) Collect(b Batch) {
+	current := Batch{Gauges: m.Gauges, Counters: m.Counters, Histograms: m.Histograms}
+	current.add(b)
+}
+
+// UseTLS switches reporting to HTTPS with the given client TLS configuration.
+func (m *MetricType) UseTLS(config *tls.Config) {
+	m.client = &http.Client{
+		Transport: &http.Transport{TLSClientConfig: config},
+	}
+	m.scheme = "https"
+}
+
+// ack subtracts the reported counter deltas of snapshot except those still pending in unsent.
+func (m *MetricType) ack(snapshot, unsent Batch) {
+	for name, value := range snapshot.Counters {
+		if _, pending := unsent.Counters[name]; pending {
+			continue
+		}
+		m.Counters[name] -= value
+	}
+	for name := range snapshot.Histograms {
+		if _, pending := unsent.Histograms[name]; !pending {
+			delete(m.Histograms, name)
+		}
+	}
+}
+
+// SetIdentity makes every request carry the agent identity headers.
+func (m *MetricType) SetIdentity(agent models.Agent) {
+	m.identity = &agent
+}
+
+// UseSpool enables persisting undelivered batches to s.
+func (m *MetricType) UseSpool(s Spooler) {
+	m.spool = s
+}
+
+func (m *MetricType) SendMetric(destAddress string, metricatype string, name string, value interface{}) error {
+	url := fmt.Sprintf("%s://%s/update/%s/%s/%v", m.scheme, destAddress, metricatype, name, value)
 
 	req, err := http.NewRequest(http.MethodPost, url, http.NoBody)
 	if err != nil {
 		log.Printf("%s: %v", logger.ErrAgentCreateRequest, err)
-		return
+		return fmt.Errorf("%s: %w", logger.ErrAgentCreateRequest, err)
 	}
 	req.Header.Set("Content-Type", "text/plain")
+	return m.do(req)
+}
+
+// SendJSON sends metric to the JSON update API. It is used for histograms and
+// for series names, such as labelled ones, that cannot be placed in a URL path.
+func (m *MetricType) SendJSON(destAddress string, metric models.Metrics) error {
+	body, err := json.Marshal(metric)
+	if err != nil {
+		log.Printf("%s: %v", logger.ErrAgentCreateRequest, err)
+		return fmt.Errorf("%s: %w", logger.ErrAgentCreateRequest, err)
+	}
+	endpoint := fmt.Sprintf("%s://%s/update/", m.scheme, destAddress)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("%s: %v", logger.ErrAgentCreateRequest, err)
+		return fmt.Errorf("%s: %w", logger.ErrAgentCreateRequest, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return m.do(req)
+}
+
+func (m *MetricType) do(req *http.Request) error {
+	if m.identity != nil {
+		req.Header.Set(models.HeaderAgentID, m.identity.ID)
+		req.Header.Set(models.HeaderAgentHostname, m.identity.Hostname)
+		req.Header.Set(models.HeaderAgentVersion, m.identity.Version)
+		req.Header.Set(models.HeaderAgentStart, m.identity.StartTime.Format(time.RFC3339))
+	}
+	size := len(req.URL.RequestURI()) + int(max(req.ContentLength, 0))
+	resp, err := m.client.Do(req)
 	if err != nil {
 		log.Printf("%s: %v", logger.ErrAgentSendRequest, err)
-		return
+		return fmt.Errorf("%s: %w", logger.ErrAgentSendRequest, err)
 	}
 	defer func() {
 		if closeErr := resp.Body.Close(); closeErr != nil {
@@ -117,14 +286,157 @@ func (m *MetricType) SendMetric(destAddress string, metricatype string, name str
 
 	if resp.StatusCode != http.StatusOK {
 		log.Printf("%s: %d", logger.ErrAgentResponseCode, resp.StatusCode)
+		if permanent(resp.StatusCode) {
+			return fmt.Errorf("%w: %d", errRejected, resp.StatusCode)
+		}
+		return fmt.Errorf("%s: %d", logger.ErrAgentResponseCode, resp.StatusCode)
+	}
+	m.countSent(size)
+	return nil
+}
+
+// Snapshot returns a copy of the current metric values.
+func (m *MetricType) Snapshot() Batch {
+	return Merge(Batch{Gauges: m.Gauges, Counters: m.Counters, Histograms: m.Histograms})
+}
+
+// permanent reports whether a request failing with status will fail again
+// when retried: client errors other than timeouts and rate limiting.
+func permanent(status int) bool {
+	return status >= 400 && status < 500 &&
+		status != http.StatusRequestTimeout && status != http.StatusTooManyRequests
+}
+
+// retry reports whether a value that failed with err should be sent again.
+// Values the server rejected are dropped with a log line.
+func retry(name string, err error) bool {
+	if errors.Is(err, errRejected) {
+		log.Printf(logger.LogDefaultFormat, logger.ErrAgentDropped, name)
+		return false
+	}
+	return true
+}
+
+// SendBatch sends every value of batch and returns the values that were not
+// delivered and can be retried, with the first error.
+func (m *MetricType) SendBatch(destAddress string, batch Batch) (Batch, error) {
+	unsent := Batch{
+		Gauges:     make(map[string]float64),
+		Counters:   make(map[string]int64),
+		Histograms: make(map[string]Histogram),
+	}
+	var firstErr error
+
+	for name, value := range batch.Gauges {
+		var err error
+		if pathSafe(name) {
+			err = m.SendMetric(destAddress, "gauge", name, strconv.FormatFloat(value, 'f', -1, 64))
+		} else {
+			err = m.SendJSON(destAddress, models.Metrics{ID: name, MType: "gauge", Value: &value})
+		}
+		if err != nil && retry(name, err) {
+			unsent.Gauges[name] = value
+		}
+		firstErr = cmp.Or(firstErr, err)
+	}
+	for name, value := range batch.Counters {
+		if value == 0 {
+			continue
+		}
+		var err error
+		if pathSafe(name) {
+			err = m.SendMetric(destAddress, "counter", name, value)
+		} else {
+			err = m.SendJSON(destAddress, models.Metrics{ID: name, MType: "counter", Delta: &value})
+		}
+		if err != nil && retry(name, err) {
+			unsent.Counters[name] = value
+		}
+		firstErr = cmp.Or(firstErr, err)
+	}
+	for name, value := range batch.Histograms {
+		if value.Count == 0 {
+			continue
+		}
+		metric := models.Metrics{ID: name, MType: "histogram", Buckets: value.Buckets, Sum: &value.Sum, Count: &value.Count}
+		err := m.SendJSON(destAddress, metric)
+		if err != nil && retry(name, err) {
+			unsent.Histograms[name] = value
+		}
+		firstErr = cmp.Or(firstErr, err)
+	}
+	return unsent, firstErr
+}
+
+// pathSafe reports whether name can be sent in the update URL path unescaped.
+func pathSafe(name string) bool {
+	return url.PathEscape(name) == name
+}
+
+// ReportMetrics sends any spooled batches and then the current values.
+// Counters are sent as deltas since the last acknowledged report. Undelivered
+// values are appended to the spool when one is configured, otherwise, or when
+// the spool cannot be written, the counter deltas are carried over to the next
+// report.
+func (m *MetricType) ReportMetrics(destAddress string) error {
+	snapshot := m.Snapshot()
+
+	if m.spool == nil {
+		unsent, err := m.SendBatch(destAddress, snapshot)
+		m.ack(snapshot, unsent)
+		m.recordReport(err, false, !unsent.Empty())
+		return err
+	}
+
+	delivered, err := m.replay(destAddress)
+	unsent := snapshot
+	if err == nil {
+		unsent, err = m.SendBatch(destAddress, snapshot)
+	}
+
+	pending := unsent
+	if !unsent.Empty() {
+		if appendErr := m.spool.Append(unsent); appendErr != nil {
+			log.Printf("%s: %v", logger.ErrSpoolWrite, appendErr)
+		} else {
+			log.Printf("%s: %d gauges, %d counters, %d histograms",
+				logger.OkSpoolAppend, len(unsent.Gauges), len(unsent.Counters), len(unsent.Histograms))
+			pending = Batch{}
+		}
 	}
+	m.ack(snapshot, pending)
+	m.recordReport(err, delivered > 0, !unsent.Empty())
+	return err
 }
 
-func (m *MetricType) ReportMetrics(destAddress string) {
-	for name, value := range m.Gauges {
-		m.SendMetric(destAddress, "gauge", name, strconv.FormatFloat(value, 'f', -1, 64))
+// replay sends the spooled batches merged into one: counters and histograms
+// are summed and the latest gauge wins, which leaves the server with the same
+// values as sending them one by one. The batches are removed once delivered;
+// a partial delivery replaces them with the undelivered rest. It returns the
+// number of batches delivered and an error when any value is still pending,
+// so that newer values are not sent ahead of them.
+func (m *MetricType) replay(destAddress string) (int, error) {
+	spooled, err := m.spool.Entries()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", logger.ErrSpoolRead, err)
+	}
+	if len(spooled) == 0 {
+		return 0, nil
+	}
+
+	merged := Merge(spooled...)
+	unsent, err := m.SendBatch(destAddress, merged)
+	if !unsent.Empty() {
+		if unsent.size() < merged.size() {
+			if ackErr := m.spool.Ack(len(spooled), &unsent); ackErr != nil {
+				log.Printf("%s: %v", logger.ErrSpoolWrite, ackErr)
+			}
+		}
+		return 0, err
 	}
-	for name, value := range m.Counters {
-		m.SendMetric(destAddress, "counter", name, value)
+	if err := m.spool.Ack(len(spooled), nil); err != nil {
+		return 0, fmt.Errorf("%s: %w", logger.ErrSpoolWrite, err)
 	}
+	log.Printf("%s: %d batches", logger.OkSpoolReplay, len(spooled))
+	return len(spooled), nil
 }
@@ -1,14 +1,19 @@
 package metrics
 
 import (
+	"encoding/json"
+	"errors"
 	"math/rand"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"slices"
 	"strconv"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/avointsev/yp7m-go/internal/models"
 )
 
 // TestNewMetrics checks the initialization of the Metrics structure.
@@ -69,7 +74,10 @@ func TestSendMetric(t *testing.T) {
 
 	serverURL, _ := url.Parse(server.URL)
 	destAddress := serverURL.Host
-	metrics.SendMetric(destAddress, "gauge", "Alloc", strconv.FormatFloat(rand.Float64()*100, 'f', -1, 64))
+	err := metrics.SendMetric(destAddress, "gauge", "Alloc", strconv.FormatFloat(rand.Float64()*100, 'f', -1, 64))
+	if err != nil {
+		t.Errorf("Expected metric to be sent, got %v", err)
+	}
 }
 
 // TestReportMetrics checks the sending of all metrics.
@@ -89,7 +97,9 @@ func TestReportMetrics(t *testing.T) {
 	serverURL, _ := url.Parse(server.URL)
 	destAddress := serverURL.Host
 
-	metrics.ReportMetrics(destAddress)
+	if err := metrics.ReportMetrics(destAddress); err != nil {
+		t.Errorf("Expected metrics to be reported, got %v", err)
+	}
 
 	// Check that the expected number of metrics were sent
 	expectedCount := len(metrics.Gauges) + len(metrics.Counters)
@@ -124,7 +134,7 @@ func TestMainLoop(t *testing.T) {
 	}()
 
 	go func() {
-		metrics.ReportMetrics(destAddress)
+		_ = metrics.ReportMetrics(destAddress)
 	}()
 
 	select {
@@ -139,3 +149,249 @@ func TestMainLoop(t *testing.T) {
 		t.Errorf("Report metrics function timed out")
 	}
 }
+
+type memorySpool struct {
+	batches    []Batch
+	appendErr  error
+	entriesErr error
+}
+
+func (s *memorySpool) Append(batch Batch) error {
+	if s.appendErr != nil {
+		return s.appendErr
+	}
+	s.batches = append(s.batches, batch)
+	return nil
+}
+
+func (s *memorySpool) Entries() ([]Batch, error) {
+	return s.batches, s.entriesErr
+}
+
+func (s *memorySpool) Ack(n int, rest *Batch) error {
+	n = min(n, len(s.batches))
+	if rest != nil && n > 0 {
+		s.batches[n-1] = *rest
+		n--
+	}
+	s.batches = s.batches[n:]
+	return nil
+}
+
+// TestReportMetricsSpool checks that failed reports are spooled and replayed,
+// merged into one batch, before the current values.
+func TestReportMetricsSpool(t *testing.T) {
+	metrics := &MetricType{
+		Gauges:   map[string]float64{"Alloc": 1},
+		Counters: map[string]int64{"PollCount": 2},
+		client:   &http.Client{},
+		scheme:   "http",
+	}
+	store := &memorySpool{}
+	metrics.UseSpool(store)
+
+	available := false
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !available {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/update/"), "/")
+		received = append(received, parts[1]+"="+parts[2])
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	serverURL, _ := url.Parse(server.URL)
+
+	for range 2 {
+		if err := metrics.ReportMetrics(serverURL.Host); err == nil {
+			t.Fatal("Expected report to fail while server is unavailable")
+		}
+		metrics.Gauges["Alloc"]++
+		metrics.Counters["PollCount"] += 3
+	}
+	if len(store.batches) != 2 {
+		t.Fatalf("Expected 2 spooled batches, got %d", len(store.batches))
+	}
+
+	available = true
+	metrics.Gauges["Alloc"] = 5
+	metrics.Counters["PollCount"] = 1
+	if err := metrics.ReportMetrics(serverURL.Host); err != nil {
+		t.Fatalf("Expected report to succeed, got %v", err)
+	}
+
+	if len(store.batches) != 0 {
+		t.Errorf("Expected spool to be drained, got %d batches", len(store.batches))
+	}
+	slices.Sort(received[:2])
+	slices.Sort(received[2:])
+	want := []string{"Alloc=2", "PollCount=5", "Alloc=5", "PollCount=1"}
+	if !slices.Equal(received, want) {
+		t.Errorf("Expected merged spooled values before current ones %v, got %v", want, received)
+	}
+	if metrics.Counters["PollCount"] != 0 {
+		t.Errorf("Expected acknowledged delta to be reset, got %d", metrics.Counters["PollCount"])
+	}
+}
+
+// TestReportMetricsSpoolRejected checks that values the server rejects are
+// dropped instead of blocking the spool.
+func TestReportMetricsSpoolRejected(t *testing.T) {
+	metrics := &MetricType{
+		Gauges:   map[string]float64{},
+		Counters: map[string]int64{"PollCount": 1},
+		client:   &http.Client{},
+		scheme:   "http",
+	}
+	store := &memorySpool{batches: []Batch{{Counters: map[string]int64{"reserved": 1, "hits": 2}}}}
+	metrics.UseSpool(store)
+
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/reserved/") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received = append(received, r.URL.Path)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	serverURL, _ := url.Parse(server.URL)
+	if err := metrics.ReportMetrics(serverURL.Host); err != nil {
+		t.Fatalf("Expected report to succeed, got %v", err)
+	}
+	if len(store.batches) != 0 {
+		t.Errorf("Expected the rejected value to be dropped from the spool, got %v", store.batches)
+	}
+	slices.Sort(received)
+	want := []string{"/update/counter/PollCount/1", "/update/counter/hits/2"}
+	if !slices.Equal(received, want) {
+		t.Errorf("Expected %v to be delivered, got %v", want, received)
+	}
+}
+
+// TestReportMetricsSpoolErrors checks that nothing is lost when the spool
+// cannot be read or written.
+func TestReportMetricsSpoolErrors(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	serverURL, _ := url.Parse(server.URL)
+
+	metrics := &MetricType{
+		Gauges:   map[string]float64{},
+		Counters: map[string]int64{"PollCount": 2},
+		client:   &http.Client{},
+		scheme:   "http",
+	}
+	store := &memorySpool{appendErr: errors.New("disk full")}
+	metrics.UseSpool(store)
+	if err := metrics.ReportMetrics(serverURL.Host); err == nil {
+		t.Fatal("Expected report to fail while server is unavailable")
+	}
+	if metrics.Counters["PollCount"] != 2 {
+		t.Errorf("Expected the delta to be carried over when spooling fails, got %d", metrics.Counters["PollCount"])
+	}
+
+	requests = 0
+	store.appendErr, store.entriesErr = nil, errors.New("corrupt spool")
+	if err := metrics.ReportMetrics(serverURL.Host); err == nil {
+		t.Fatal("Expected an unreadable spool to fail the report")
+	}
+	if requests != 0 || len(store.batches) != 1 {
+		t.Errorf("Expected current values to be spooled behind the unread ones, got %d requests and %d batches",
+			requests, len(store.batches))
+	}
+}
+
+// TestReportMetricsCounterDeltas checks that counters are sent as deltas and carried over on failure.
+func TestReportMetricsCounterDeltas(t *testing.T) {
+	metrics := NewMetrics()
+
+	available := false
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !available {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if strings.HasPrefix(r.URL.Path, "/update/counter/PollCount/") {
+			received = append(received, strings.TrimPrefix(r.URL.Path, "/update/counter/PollCount/"))
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	serverURL, _ := url.Parse(server.URL)
+
+	metrics.UpdateMetrics()
+	metrics.UpdateMetrics()
+	if err := metrics.ReportMetrics(serverURL.Host); err == nil {
+		t.Fatal("Expected report to fail while server is unavailable")
+	}
+	if metrics.Counters["PollCount"] != 2 {
+		t.Fatalf("Expected unsent delta 2 to be carried over, got %d", metrics.Counters["PollCount"])
+	}
+
+	available = true
+	metrics.UpdateMetrics()
+	if err := metrics.ReportMetrics(serverURL.Host); err != nil {
+		t.Fatalf("Expected report to succeed, got %v", err)
+	}
+	metrics.UpdateMetrics()
+	if err := metrics.ReportMetrics(serverURL.Host); err != nil {
+		t.Fatalf("Expected report to succeed, got %v", err)
+	}
+
+	if strings.Join(received, ",") != "3,1" {
+		t.Errorf("Expected deltas 3,1 to be sent, got %v", received)
+	}
+}
+
+// TestReportMetricsJSON checks that histograms and labelled series are sent to the JSON API.
+func TestReportMetricsJSON(t *testing.T) {
+	metrics := NewMetrics()
+
+	received := make(map[string]models.Metrics)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/update/" {
+			var metric models.Metrics
+			if err := json.NewDecoder(r.Body).Decode(&metric); err != nil {
+				t.Errorf("Expected JSON body, got %v", err)
+			}
+			received[metric.ID] = metric
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	serverURL, _ := url.Parse(server.URL)
+
+	histogram := Histogram{Buckets: []models.Bucket{{UpperBound: 0.1, Count: 2}}, Sum: 0.3, Count: 3}
+	metrics.Collect(Batch{
+		Gauges:     map[string]float64{`up{job="node"}`: 1},
+		Histograms: map[string]Histogram{"latency": histogram},
+	})
+	metrics.Collect(Batch{Histograms: map[string]Histogram{"latency": histogram}})
+
+	if err := metrics.ReportMetrics(serverURL.Host); err != nil {
+		t.Fatalf("Expected report to succeed, got %v", err)
+	}
+
+	if m, ok := received[`up{job="node"}`]; !ok || m.MType != "gauge" || *m.Value != 1 {
+		t.Errorf("Expected labelled gauge via JSON, got %+v", m)
+	}
+	m, ok := received["latency"]
+	if !ok || m.MType != "histogram" || *m.Count != 6 || m.Buckets[0].Count != 4 {
+		t.Errorf("Expected merged histogram via JSON, got %+v", m)
+	}
+	if len(metrics.Histograms) != 0 {
+		t.Errorf("Expected acknowledged histograms to be cleared, got %v", metrics.Histograms)
+	}
+}
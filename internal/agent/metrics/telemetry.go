@@ -0,0 +1,97 @@
+package metrics
+
+import (
+	"log"
+	"time"
+
+	"github.com/avointsev/yp7m-go/internal/labels"
+	"github.com/avointsev/yp7m-go/internal/logger"
+)
+
+// TelemetryPrefix is the namespace of the agent's own metrics.
+const TelemetryPrefix = "yp7m_agent_"
+
+// Names of the agent telemetry metrics. Every series carries an "agent" label
+// so that the server can tell agents apart.
+const (
+	ReportsSent        = TelemetryPrefix + "reports_sent_total"
+	ReportsFailed      = TelemetryPrefix + "reports_failed_total"
+	ReportsRetried     = TelemetryPrefix + "reports_retried_total"
+	SentBytes          = TelemetryPrefix + "sent_bytes_total"
+	CollectionDuration = TelemetryPrefix + "collection_duration_seconds"
+	SpoolDepth         = TelemetryPrefix + "spool_depth"
+	LastReportSuccess  = TelemetryPrefix + "last_report_success_timestamp_seconds"
+)
+
+// telemetry tracks the state behind the agent metrics between reports.
+type telemetry struct {
+	labels    labels.Labels
+	sentBytes int64
+	// retry is set when undelivered values were carried over to the next report.
+	retry bool
+}
+
+// EnableTelemetry makes the agent report its own metrics, labelled with
+// agent=id, as part of the normal payload. Values describing a report are
+// sent with the following one.
+func (m *MetricType) EnableTelemetry(id string) {
+	m.telemetry = &telemetry{labels: labels.Labels{"agent": id}}
+}
+
+// RecordCollection reports how long the named collector took to gather metrics.
+func (m *MetricType) RecordCollection(collector string, d time.Duration) {
+	if m.telemetry == nil {
+		return
+	}
+	m.Gauges[m.telemetry.series(CollectionDuration, "collector", collector)] = d.Seconds()
+}
+
+func (t *telemetry) series(name string, extra ...string) string {
+	l := make(labels.Labels, len(t.labels)+len(extra)/2)
+	for k, v := range t.labels {
+		l[k] = v
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		l[extra[i]] = extra[i+1]
+	}
+	return labels.Series(name, l)
+}
+
+// countSent adds the payload size of a delivered request.
+func (m *MetricType) countSent(bytes int) {
+	if m.telemetry != nil {
+		m.telemetry.sentBytes += int64(bytes)
+	}
+}
+
+// recordReport updates the telemetry after a report. retried tells whether
+// the report carried values from an earlier failed one, and unsent whether
+// values were left over for the next.
+func (m *MetricType) recordReport(err error, retried, unsent bool) {
+	t := m.telemetry
+	if t == nil {
+		return
+	}
+	if retried || t.retry {
+		m.Counters[t.series(ReportsRetried)]++
+	}
+	t.retry = unsent && m.spool == nil
+
+	if err != nil {
+		m.Counters[t.series(ReportsFailed)]++
+	} else {
+		m.Counters[t.series(ReportsSent)]++
+		m.Gauges[t.series(LastReportSuccess)] = float64(time.Now().Unix())
+	}
+	m.Counters[t.series(SentBytes)] += t.sentBytes
+	t.sentBytes = 0
+
+	if m.spool != nil {
+		entries, spoolErr := m.spool.Entries()
+		if spoolErr != nil {
+			log.Printf("%s: %v", logger.ErrSpoolRead, spoolErr)
+			return
+		}
+		m.Gauges[t.series(SpoolDepth)] = float64(len(entries))
+	}
+}
@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/avointsev/yp7m-go/internal/models"
+)
+
+// TestTelemetry checks that report outcomes are sent with the following report.
+func TestTelemetry(t *testing.T) {
+	metrics := NewMetrics()
+	metrics.EnableTelemetry("host1")
+	metrics.SetIdentity(models.Agent{ID: "host1", Version: "1.0"})
+
+	available := false
+	received := make(map[string]models.Metrics)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(models.HeaderAgentID) != "host1" || r.Header.Get(models.HeaderAgentVersion) != "1.0" {
+			t.Errorf("Expected identity headers, got %v", r.Header)
+		}
+		if !available {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.URL.Path == "/update/" {
+			var metric models.Metrics
+			if err := json.NewDecoder(r.Body).Decode(&metric); err != nil {
+				t.Errorf("Expected JSON body, got %v", err)
+			}
+			received[metric.ID] = metric
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	serverURL, _ := url.Parse(server.URL)
+
+	metrics.UpdateMetrics()
+	metrics.RecordCollection("runtime", 2*time.Millisecond)
+	if err := metrics.ReportMetrics(serverURL.Host); err == nil {
+		t.Fatal("Expected report to fail while server is unavailable")
+	}
+
+	available = true
+	if err := metrics.ReportMetrics(serverURL.Host); err != nil {
+		t.Fatalf("Expected report to succeed, got %v", err)
+	}
+	if m := received[`yp7m_agent_reports_failed_total{agent="host1"}`]; m.Delta == nil || *m.Delta != 1 {
+		t.Errorf("Expected one failed report, got %+v", m)
+	}
+	if m := received[`yp7m_agent_collection_duration_seconds{agent="host1",collector="runtime"}`]; m.Value == nil || *m.Value != 0.002 {
+		t.Errorf("Expected collection duration, got %+v", m)
+	}
+
+	if err := metrics.ReportMetrics(serverURL.Host); err != nil {
+		t.Fatalf("Expected report to succeed, got %v", err)
+	}
+	for _, name := range []string{
+		`yp7m_agent_reports_sent_total{agent="host1"}`,
+		`yp7m_agent_reports_retried_total{agent="host1"}`,
+		`yp7m_agent_sent_bytes_total{agent="host1"}`,
+		`yp7m_agent_last_report_success_timestamp_seconds{agent="host1"}`,
+	} {
+		if _, ok := received[name]; !ok {
+			t.Errorf("Expected %s to be reported", name)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package scrape
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/avointsev/yp7m-go/internal/labels"
+)
+
+var errInvalidLine = errors.New("invalid exposition line")
+
+// Sample is a single line of the Prometheus text exposition format.
+type Sample struct {
+	Name   string
+	Labels labels.Labels
+	Value  float64
+}
+
+// Exposition is a parsed scrape: the declared family types and all samples.
+type Exposition struct {
+	Types   map[string]string
+	Samples []Sample
+}
+
+// Parse reads the Prometheus text exposition format. HELP lines and sample
+// timestamps are ignored.
+func Parse(r io.Reader) (Exposition, error) {
+	exp := Exposition{Types: make(map[string]string)}
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			fields := strings.Fields(line)
+			if len(fields) == 4 && fields[1] == "TYPE" {
+				exp.Types[fields[2]] = fields[3]
+			}
+			continue
+		}
+
+		sample, err := parseSample(line)
+		if err != nil {
+			return Exposition{}, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+		exp.Samples = append(exp.Samples, sample)
+	}
+	if err := scanner.Err(); err != nil {
+		return Exposition{}, fmt.Errorf("read exposition: %w", err)
+	}
+	return exp, nil
+}
+
+func parseSample(line string) (Sample, error) {
+	end := strings.IndexAny(line, "{ \t")
+	if end <= 0 {
+		return Sample{}, errInvalidLine
+	}
+	sample := Sample{Name: line[:end], Labels: make(labels.Labels)}
+	rest := line[end:]
+
+	if rest[0] == '{' {
+		var err error
+		if rest, err = parseLabels(rest[1:], sample.Labels); err != nil {
+			return Sample{}, err
+		}
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) < 1 || len(fields) > 2 {
+		return Sample{}, errInvalidLine
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return Sample{}, errInvalidLine
+	}
+	sample.Value = value
+	return sample, nil
+}
+
+// parseLabels reads name="value" pairs up to the closing brace into l and
+// returns the remainder of the line.
+func parseLabels(s string, l labels.Labels) (string, error) {
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		if s == "" {
+			return "", errInvalidLine
+		}
+		if s[0] == '}' {
+			return s[1:], nil
+		}
+
+		name, rest, ok := strings.Cut(s, "=")
+		name = strings.TrimSpace(name)
+		rest = strings.TrimLeft(rest, " \t")
+		if !ok || name == "" || !strings.HasPrefix(rest, `"`) {
+			return "", errInvalidLine
+		}
+
+		var value strings.Builder
+		i := 1
+		for ; i < len(rest) && rest[i] != '"'; i++ {
+			if rest[i] != '\\' || i+1 == len(rest) {
+				value.WriteByte(rest[i])
+				continue
+			}
+			i++
+			switch rest[i] {
+			case 'n':
+				value.WriteByte('\n')
+			default:
+				value.WriteByte(rest[i])
+			}
+		}
+		if i == len(rest) {
+			return "", errInvalidLine
+		}
+		l[name] = value.String()
+		s = rest[i+1:]
+	}
+}
@@ -0,0 +1,226 @@
+// Package scrape collects metrics from endpoints exposing the Prometheus text
+// format and converts them into batches for the agent reporting pipeline.
+package scrape
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/avointsev/yp7m-go/internal/agent/metrics"
+	"github.com/avointsev/yp7m-go/internal/cumulative"
+	"github.com/avointsev/yp7m-go/internal/labels"
+	"github.com/avointsev/yp7m-go/internal/logger"
+	"github.com/avointsev/yp7m-go/internal/models"
+)
+
+// instanceLabel identifies the scraped target, as in Prometheus.
+const instanceLabel = "instance"
+
+// Timeout returns how long a scrape may take at the given interval. It leaves
+// a fifth of the interval so that a slow target cannot delay the next scrape.
+func Timeout(interval time.Duration) time.Duration {
+	return interval - interval/5
+}
+
+// Scraper periodically reads a fixed set of targets. Counters and histograms
+// are cumulative in the exposition format, so the scraper remembers previous
+// readings and emits the increase since the last scrape. The first reading of
+// a series is only a baseline.
+type Scraper struct {
+	targets    []string
+	client     *http.Client
+	tracker    *cumulative.Tracker
+	remainders map[string]float64
+}
+
+// New creates a scraper for targets. Requests are bounded by the context
+// passed to Scrape.
+func New(targets []string) *Scraper {
+	return &Scraper{
+		targets:    targets,
+		client:     &http.Client{},
+		tracker:    cumulative.New(),
+		remainders: make(map[string]float64),
+	}
+}
+
+// Scrape reads every target concurrently and returns the combined batch.
+// Failing targets are logged and skipped; the first error is returned. Scrape
+// must not be called again before it returns.
+func (s *Scraper) Scrape(ctx context.Context) (metrics.Batch, error) {
+	expositions := make([]Exposition, len(s.targets))
+	errs := make([]error, len(s.targets))
+	var wg sync.WaitGroup
+	for i, target := range s.targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			expositions[i], errs[i] = s.fetch(ctx, target)
+		}()
+	}
+	wg.Wait()
+
+	batch := metrics.Merge()
+	var firstErr error
+	for i, target := range s.targets {
+		if errs[i] != nil {
+			log.Printf("%s %s: %v", logger.ErrScrapeTarget, target, errs[i])
+			firstErr = cmp.Or(firstErr, errs[i])
+			continue
+		}
+		instance := target
+		if u, err := url.Parse(target); err == nil {
+			instance = u.Host
+		}
+		s.convert(expositions[i], instance, batch)
+	}
+	return batch, firstErr
+}
+
+func (s *Scraper) fetch(ctx context.Context, target string) (Exposition, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, http.NoBody)
+	if err != nil {
+		return Exposition{}, fmt.Errorf("%s: %w", logger.ErrAgentCreateRequest, err)
+	}
+	req.Header.Set("Accept", "text/plain;version=0.0.4")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return Exposition{}, fmt.Errorf("%s: %w", logger.ErrAgentSendRequest, err)
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			log.Printf("%s: %v", logger.ErrAgentCloseRequest, closeErr)
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return Exposition{}, fmt.Errorf("%s: %d", logger.ErrAgentResponseCode, resp.StatusCode)
+	}
+	exp, err := Parse(resp.Body)
+	if err != nil {
+		return Exposition{}, fmt.Errorf("%s: %w", logger.ErrScrapeParse, err)
+	}
+	return exp, nil
+}
+
+// histogramReading collects the _bucket, _sum and _count samples of one series.
+type histogramReading struct {
+	buckets  map[float64]float64
+	sum      float64
+	count    float64
+	hasCount bool
+}
+
+// convert adds the samples of exp to batch. Counters become deltas, histograms
+// become bucket deltas, and gauges, summaries and untyped samples are gauges.
+// NaN and infinite values cannot be reported and are dropped.
+func (s *Scraper) convert(exp Exposition, instance string, batch metrics.Batch) {
+	readings := make(map[string]*histogramReading)
+
+	for _, sample := range exp.Samples {
+		if math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) {
+			continue
+		}
+		if _, ok := sample.Labels[instanceLabel]; !ok {
+			sample.Labels[instanceLabel] = instance
+		}
+		kind, family := familyOf(exp.Types, sample.Name)
+
+		switch kind {
+		case "counter":
+			series := labels.Series(sample.Name, sample.Labels)
+			delta := s.tracker.Delta(series, sample.Value) + s.remainders[series]
+			whole := math.Trunc(delta)
+			s.remainders[series] = delta - whole
+			batch.Counters[series] += int64(whole)
+		case "histogram":
+			le := sample.Labels["le"]
+			delete(sample.Labels, "le")
+			series := labels.Series(family, sample.Labels)
+			reading, ok := readings[series]
+			if !ok {
+				reading = &histogramReading{buckets: make(map[float64]float64)}
+				readings[series] = reading
+			}
+			switch strings.TrimPrefix(sample.Name, family) {
+			case "_bucket":
+				if bound, err := strconv.ParseFloat(le, 64); err == nil {
+					reading.buckets[bound] = sample.Value
+				}
+			case "_sum":
+				reading.sum = sample.Value
+			case "_count":
+				reading.count, reading.hasCount = sample.Value, true
+			}
+		default:
+			batch.Gauges[labels.Series(sample.Name, sample.Labels)] = sample.Value
+		}
+	}
+
+	for series, reading := range readings {
+		delta, ok := s.tracker.HistogramDelta(series, reading.histogram())
+		if ok && delta.Count > 0 {
+			batch.Histograms[series] = toBatchHistogram(delta)
+		}
+	}
+}
+
+// familyOf returns the declared type of the family a sample belongs to and
+// the family name. Samples of undeclared families are untyped.
+func familyOf(types map[string]string, name string) (string, string) {
+	if kind, ok := types[name]; ok {
+		return kind, name
+	}
+	for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+		if base, ok := strings.CutSuffix(name, suffix); ok && types[base] == "histogram" {
+			return "histogram", base
+		}
+	}
+	if base, ok := strings.CutSuffix(name, "_total"); ok && types[base] == "counter" {
+		return "counter", base
+	}
+	return "untyped", name
+}
+
+// histogram converts a reading into cumulative buckets. The +Inf bucket is
+// represented by Count.
+func (r *histogramReading) histogram() cumulative.Histogram {
+	h := cumulative.Histogram{Sum: r.sum, Count: uint64(r.count)}
+	bounds := make([]float64, 0, len(r.buckets))
+	for bound, count := range r.buckets {
+		if math.IsInf(bound, 1) {
+			if !r.hasCount {
+				h.Count = uint64(count)
+			}
+			continue
+		}
+		bounds = append(bounds, bound)
+	}
+	slices.Sort(bounds)
+	h.Bounds = bounds
+	h.Counts = make([]uint64, len(bounds))
+	for i, bound := range bounds {
+		h.Counts[i] = uint64(r.buckets[bound])
+	}
+	return h
+}
+
+// toBatchHistogram converts a histogram delta into the reported form.
+func toBatchHistogram(h cumulative.Histogram) metrics.Histogram {
+	batch := metrics.Histogram{Sum: h.Sum, Count: h.Count}
+	for i, bound := range h.Bounds {
+		batch.Buckets = append(batch.Buckets, models.Bucket{UpperBound: bound, Count: h.Counts[i]})
+	}
+	return batch
+}
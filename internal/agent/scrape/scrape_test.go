@@ -0,0 +1,134 @@
+package scrape
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	exp, err := Parse(strings.NewReader(`# HELP http_requests_total Requests.
+# TYPE http_requests_total counter
+http_requests_total{method="get",path="/a \"b\"\\c"} 10 1700000000000
+up 1
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if exp.Types["http_requests_total"] != "counter" {
+		t.Errorf("unexpected types %v", exp.Types)
+	}
+	if len(exp.Samples) != 2 {
+		t.Fatalf("expected 2 samples, got %+v", exp.Samples)
+	}
+	if s := exp.Samples[0]; s.Value != 10 || s.Labels["method"] != "get" || s.Labels["path"] != `/a "b"\c` {
+		t.Errorf("unexpected sample %+v", s)
+	}
+
+	for _, body := range []string{"up", "up{job=\"x\" 1", "up{job=x} 1", "up one"} {
+		if _, err := Parse(strings.NewReader(body)); err == nil {
+			t.Errorf("expected error for %q", body)
+		}
+	}
+}
+
+func TestScrape(t *testing.T) {
+	requests := 0.0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests++
+		fmt.Fprintf(w, `# TYPE jobs_total counter
+jobs_total %g
+# TYPE temperature gauge
+temperature 21.5
+pressure +Inf
+# TYPE latency histogram
+latency_bucket{le="0.1"} %g
+latency_bucket{le="1"} %g
+latency_bucket{le="+Inf"} %g
+latency_sum %g
+latency_count %g
+`, 2.5*requests, requests, 2*requests, 3*requests, requests, 3*requests)
+	}))
+	defer server.Close()
+	target := server.URL + "/metrics"
+	host, _ := url.Parse(server.URL)
+	instance := `{instance="` + host.Host + `"}`
+
+	s := New([]string{target})
+	first, err := s.Scrape(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := first.Gauges["pressure"+instance]; ok || first.Gauges["temperature"+instance] != 21.5 {
+		t.Errorf("unexpected gauges %v", first.Gauges)
+	}
+	if first.Counters["jobs_total"+instance] != 0 {
+		t.Errorf("expected first counter reading as a baseline, got %v", first.Counters)
+	}
+	if h, ok := first.Histograms["latency"+instance]; ok {
+		t.Errorf("expected first histogram reading as a baseline, got %+v", h)
+	}
+
+	second, err := s.Scrape(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if second.Counters["jobs_total"+instance] != 2 {
+		t.Errorf("expected whole delta 2, got %v", second.Counters)
+	}
+	if h := second.Histograms["latency"+instance]; h.Count != 3 || len(h.Buckets) != 2 || h.Buckets[0].Count != 1 || h.Sum != 1 {
+		t.Errorf("expected histogram delta, got %+v", h)
+	}
+
+	third, err := s.Scrape(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if third.Counters["jobs_total"+instance] != 3 {
+		t.Errorf("expected delta with carried fraction 3, got %v", third.Counters)
+	}
+
+	s = New([]string{server.URL + "/missing", "http://127.0.0.1:1/metrics"})
+	if _, err := s.Scrape(context.Background()); err == nil {
+		t.Error("expected error for unreachable target, got nil")
+	}
+}
+
+func TestScrapeTimeout(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprintln(w, "up 1")
+	}))
+	defer fast.Close()
+
+	if timeout := Timeout(10 * time.Second); timeout != 8*time.Second {
+		t.Errorf("expected timeout 8s for a 10s interval, got %v", timeout)
+	}
+
+	s := New([]string{slow.URL, fast.URL})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	batch, err := s.Scrape(ctx)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the slow target to be cut off by the timeout, took %v", elapsed)
+	}
+	if err == nil {
+		t.Error("expected an error for the slow target, got nil")
+	}
+	host, _ := url.Parse(fast.URL)
+	if batch.Gauges[`up{instance="`+host.Host+`"}`] != 1 {
+		t.Errorf("expected the fast target to be collected, got %v", batch.Gauges)
+	}
+}
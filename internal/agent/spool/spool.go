@@ -0,0 +1,233 @@
+package spool
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/avointsev/yp7m-go/internal/logger"
+)
+
+// Spool is an append-only file of undelivered entries bounded by size and age.
+type Spool[T any] struct {
+	path    string
+	maxSize int64
+	maxAge  time.Duration
+	mu      sync.Mutex
+}
+
+type record[T any] struct {
+	Time  time.Time `json:"time"`
+	Entry T         `json:"entry"`
+}
+
+// New creates a spool stored at path. Zero maxSize or maxAge disables that bound.
+func New[T any](path string, maxSize int64, maxAge time.Duration) *Spool[T] {
+	return &Spool[T]{
+		path:    path,
+		maxSize: maxSize,
+		maxAge:  maxAge,
+	}
+}
+
+// Append stores entry at the end of the spool, dropping the oldest entries
+// when the size bound would be exceeded.
+func (s *Spool[T]) Append(entry T) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	line, err := json.Marshal(record[T]{Time: time.Now(), Entry: entry})
+	if err != nil {
+		return fmt.Errorf("%s: %w", logger.ErrSpoolWrite, err)
+	}
+	line = append(line, '\n')
+
+	info, err := os.Stat(s.path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return s.write(line)
+	case err != nil:
+		return fmt.Errorf("%s: %w", logger.ErrSpoolWrite, err)
+	case s.maxSize == 0 || info.Size()+int64(len(line)) <= s.maxSize:
+		return s.appendLine(line)
+	}
+
+	records, err := s.read()
+	if err != nil {
+		return err
+	}
+	lines := make([][]byte, 0, len(records)+1)
+	for _, r := range s.live(records) {
+		data, err := json.Marshal(r)
+		if err != nil {
+			return fmt.Errorf("%s: %w", logger.ErrSpoolWrite, err)
+		}
+		lines = append(lines, append(data, '\n'))
+	}
+	lines = append(lines, line)
+
+	var size int64
+	for _, l := range lines {
+		size += int64(len(l))
+	}
+	for s.maxSize > 0 && size > s.maxSize && len(lines) > 0 {
+		size -= int64(len(lines[0]))
+		lines = lines[1:]
+	}
+
+	return s.write(bytes.Join(lines, nil))
+}
+
+// Entries returns the spooled entries in append order. Expired entries are
+// skipped and removed from the spool.
+func (s *Spool[T]) Entries() ([]T, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	live := s.live(records)
+	if len(live) < len(records) {
+		if err := s.store(live); err != nil {
+			return nil, err
+		}
+	}
+	entries := make([]T, 0, len(live))
+	for _, r := range live {
+		entries = append(entries, r.Entry)
+	}
+	return entries, nil
+}
+
+// Ack removes the first n entries returned by Entries once they are delivered.
+// A non-nil rest takes their place as a single entry holding what was not
+// delivered. It keeps the timestamp of the oldest removed entry so that it
+// expires no later than the data it holds.
+func (s *Spool[T]) Ack(n int, rest *T) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records, err := s.read()
+	if err != nil {
+		return err
+	}
+	n = min(n, len(records))
+	if rest != nil && n > 0 {
+		records[n-1] = record[T]{Time: records[0].Time, Entry: *rest}
+		n--
+	}
+	return s.store(records[n:])
+}
+
+// Len returns the number of spooled entries.
+func (s *Spool[T]) Len() (int, error) {
+	entries, err := s.Entries()
+	return len(entries), err
+}
+
+// Clear removes all spooled entries.
+func (s *Spool[T]) Clear() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.store(nil)
+}
+
+func (s *Spool[T]) read() ([]record[T], error) {
+	file, err := os.Open(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", logger.ErrSpoolRead, err)
+	}
+	defer func() {
+		if closeErr := file.Close(); closeErr != nil {
+			log.Printf("%s: %v", logger.ErrSpoolRead, closeErr)
+		}
+	}()
+
+	var records []record[T]
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, int(max(s.maxSize, bufio.MaxScanTokenSize)))
+	for scanner.Scan() {
+		var r record[T]
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			continue
+		}
+		records = append(records, r)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", logger.ErrSpoolRead, err)
+	}
+	return records, nil
+}
+
+// live returns the records that have not expired.
+func (s *Spool[T]) live(records []record[T]) []record[T] {
+	if s.maxAge == 0 {
+		return records
+	}
+	live := make([]record[T], 0, len(records))
+	for _, r := range records {
+		if time.Since(r.Time) <= s.maxAge {
+			live = append(live, r)
+		}
+	}
+	return live
+}
+
+// store replaces the spool contents with records, removing the file when
+// none are left.
+func (s *Spool[T]) store(records []record[T]) error {
+	if len(records) == 0 {
+		if err := os.Remove(s.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("%s: %w", logger.ErrSpoolWrite, err)
+		}
+		return nil
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, r := range records {
+		if err := encoder.Encode(r); err != nil {
+			return fmt.Errorf("%s: %w", logger.ErrSpoolWrite, err)
+		}
+	}
+	return s.write(buf.Bytes())
+}
+
+func (s *Spool[T]) appendLine(line []byte) error {
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("%s: %w", logger.ErrSpoolWrite, err)
+	}
+	if _, err := file.Write(line); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("%s: %w", logger.ErrSpoolWrite, err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("%s: %w", logger.ErrSpoolWrite, err)
+	}
+	return nil
+}
+
+// write replaces the spool file atomically.
+func (s *Spool[T]) write(data []byte) error {
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("%s: %w", logger.ErrSpoolWrite, err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("%s: %w", logger.ErrSpoolWrite, err)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package spool
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAppendAndEntries(t *testing.T) {
+	s := New[int](filepath.Join(t.TempDir(), "spool.jsonl"), 0, 0)
+
+	for i := 1; i <= 3; i++ {
+		if err := s.Append(i); err != nil {
+			t.Fatalf("unexpected append error: %v", err)
+		}
+	}
+
+	entries, err := s.Entries()
+	if err != nil {
+		t.Fatalf("unexpected read error: %v", err)
+	}
+	if len(entries) != 3 || entries[0] != 1 || entries[2] != 3 {
+		t.Errorf("expected entries [1 2 3] in order, got %v", entries)
+	}
+
+	if err := s.Clear(); err != nil {
+		t.Fatalf("unexpected clear error: %v", err)
+	}
+	if n, _ := s.Len(); n != 0 {
+		t.Errorf("expected empty spool after clear, got %d entries", n)
+	}
+}
+
+func TestMaxSizeDropsOldest(t *testing.T) {
+	s := New[string](filepath.Join(t.TempDir(), "spool.jsonl"), 200, 0)
+
+	for _, v := range []string{"first", "second", "third", "fourth"} {
+		if err := s.Append(v); err != nil {
+			t.Fatalf("unexpected append error: %v", err)
+		}
+	}
+
+	entries, err := s.Entries()
+	if err != nil {
+		t.Fatalf("unexpected read error: %v", err)
+	}
+	if len(entries) == 0 || len(entries) == 4 {
+		t.Fatalf("expected spool to be trimmed, got %v", entries)
+	}
+	if entries[len(entries)-1] != "fourth" {
+		t.Errorf("expected newest entry to be kept, got %v", entries)
+	}
+}
+
+func TestMaxAgeSkipsExpired(t *testing.T) {
+	s := New[int](filepath.Join(t.TempDir(), "spool.jsonl"), 0, time.Millisecond)
+
+	if err := s.Append(1); err != nil {
+		t.Fatalf("unexpected append error: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	if n, _ := s.Len(); n != 0 {
+		t.Errorf("expected expired entries to be skipped, got %d", n)
+	}
+}
+
+func TestAckKeepsTimestamps(t *testing.T) {
+	s := New[int](filepath.Join(t.TempDir(), "spool.jsonl"), 0, 100*time.Millisecond)
+
+	if err := s.Append(1); err != nil {
+		t.Fatalf("unexpected append error: %v", err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	for _, v := range []int{2, 3} {
+		if err := s.Append(v); err != nil {
+			t.Fatalf("unexpected append error: %v", err)
+		}
+	}
+
+	rest := 10
+	if err := s.Ack(2, &rest); err != nil {
+		t.Fatalf("unexpected ack error: %v", err)
+	}
+	entries, err := s.Entries()
+	if err != nil {
+		t.Fatalf("unexpected read error: %v", err)
+	}
+	if len(entries) != 2 || entries[0] != 10 || entries[1] != 3 {
+		t.Errorf("expected entries [10 3], got %v", entries)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	entries, err = s.Entries()
+	if err != nil {
+		t.Fatalf("unexpected read error: %v", err)
+	}
+	if len(entries) != 1 || entries[0] != 3 {
+		t.Errorf("expected the replacing entry to expire with the oldest time, got %v", entries)
+	}
+
+	if err := s.Ack(1, nil); err != nil {
+		t.Fatalf("unexpected ack error: %v", err)
+	}
+	if entries, _ := s.Entries(); len(entries) != 0 {
+		t.Errorf("expected an empty spool after ack, got %v", entries)
+	}
+}
@@ -0,0 +1,82 @@
+// Package cumulative converts monotonically increasing counter and histogram
+// readings into the deltas expected by the additive storage.
+package cumulative
+
+import (
+	"slices"
+	"sync"
+)
+
+// Tracker remembers the last reading of every series.
+type Tracker struct {
+	last       map[string]float64
+	histograms map[string]Histogram
+	mu         sync.Mutex
+}
+
+// Histogram is a cumulative histogram reading. Counts are cumulative per
+// upper bound and Count covers all observations, acting as the +Inf bucket.
+type Histogram struct {
+	Bounds []float64
+	Counts []uint64
+	Sum    float64
+	Count  uint64
+}
+
+// New creates an empty tracker.
+func New() *Tracker {
+	return &Tracker{
+		last:       make(map[string]float64),
+		histograms: make(map[string]Histogram),
+	}
+}
+
+// Delta returns the increase of series since its previous reading. The first
+// reading is only a baseline and yields zero, since the total it carries may
+// already have been counted before a restart of the tracker. The first reading
+// after a reset (a decrease) counts in full.
+func (t *Tracker) Delta(series string, value float64) float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	last, seen := t.last[series]
+	t.last[series] = value
+	switch {
+	case !seen:
+		return 0
+	case value < last:
+		return value
+	}
+	return value - last
+}
+
+// HistogramDelta returns the observations added to series since its previous
+// reading. As with Delta, the first reading is only a baseline and false is
+// returned for it. A change of bounds or a reset is reported in full.
+func (t *Tracker) HistogramDelta(series string, current Histogram) (Histogram, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	previous, seen := t.histograms[series]
+	t.histograms[series] = current
+	if !seen {
+		return Histogram{}, false
+	}
+	if !slices.Equal(previous.Bounds, current.Bounds) || current.Count < previous.Count {
+		return current, true
+	}
+
+	delta := Histogram{
+		Bounds: slices.Clone(current.Bounds),
+		Counts: slices.Clone(current.Counts),
+		Sum:    current.Sum - previous.Sum,
+		Count:  current.Count - previous.Count,
+	}
+	for i := range delta.Counts {
+		if delta.Counts[i] < previous.Counts[i] {
+			return current, true
+		}
+		delta.Counts[i] -= previous.Counts[i]
+	}
+	return delta, true
+}
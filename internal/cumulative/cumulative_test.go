@@ -0,0 +1,55 @@
+package cumulative
+
+import "testing"
+
+func TestDelta(t *testing.T) {
+	tracker := New()
+
+	steps := []struct {
+		series string
+		value  float64
+		want   float64
+	}{
+		{"bytes", 100, 0},
+		{"bytes", 150, 50},
+		{"other", 7, 0},
+		{"bytes", 150, 0},
+		{"bytes", 20, 20},
+		{"bytes", 25, 5},
+	}
+	for i, step := range steps {
+		if got := tracker.Delta(step.series, step.value); got != step.want {
+			t.Errorf("step %d: Delta(%s, %v) = %v, want %v", i, step.series, step.value, got, step.want)
+		}
+	}
+}
+
+func TestDeltaAfterRestart(t *testing.T) {
+	tracker := New()
+	total := tracker.Delta("bytes", 100) + tracker.Delta("bytes", 150)
+
+	tracker = New()
+	total += tracker.Delta("bytes", 150) + tracker.Delta("bytes", 180)
+	if total != 80 {
+		t.Errorf("expected increases after the first reading to total 80, got %v", total)
+	}
+}
+
+func TestHistogramDelta(t *testing.T) {
+	tracker := New()
+	bounds := []float64{0.1, 1}
+
+	if _, ok := tracker.HistogramDelta("latency", Histogram{Bounds: bounds, Counts: []uint64{1, 2}, Sum: 1, Count: 3}); ok {
+		t.Error("expected the first reading to be a baseline")
+	}
+
+	delta, ok := tracker.HistogramDelta("latency", Histogram{Bounds: bounds, Counts: []uint64{2, 4}, Sum: 2.5, Count: 6})
+	if !ok || delta.Count != 3 || delta.Counts[0] != 1 || delta.Counts[1] != 2 || delta.Sum != 1.5 {
+		t.Errorf("expected delta of 3 observations, got %+v", delta)
+	}
+
+	reset := Histogram{Bounds: bounds, Counts: []uint64{0, 1}, Sum: 0.5, Count: 1}
+	if delta, ok := tracker.HistogramDelta("latency", reset); !ok || delta.Count != 1 || delta.Sum != 0.5 {
+		t.Errorf("expected reset reading in full, got %+v", delta)
+	}
+}
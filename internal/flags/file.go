@@ -0,0 +1,162 @@
+package flags
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/avointsev/yp7m-go/internal/logger"
+)
+
+// ConfigError describes an invalid configuration value and names the offending key.
+type ConfigError struct {
+	Key    string
+	Reason string
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("config key %q: %s", e.Key, e.Reason)
+}
+
+// loadConfigFile decodes a JSON or YAML config file into dest.
+// YAML is normalised to JSON first so both formats report errors the same way.
+func loadConfigFile(path string, dest interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("%s: %w", logger.ErrConfigRead, err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		var raw map[string]interface{}
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			return fmt.Errorf("%s: %w", logger.ErrConfigDecode, err)
+		}
+		if data, err = json.Marshal(raw); err != nil {
+			return fmt.Errorf("%s: %w", logger.ErrConfigDecode, err)
+		}
+	case ".json":
+	default:
+		return fmt.Errorf(logger.LogDefaultFormat, logger.ErrConfigFormat, path)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(dest); err != nil {
+		return decodeError(err)
+	}
+	return nil
+}
+
+func decodeError(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return &ConfigError{Key: typeErr.Field, Reason: "expected " + typeErr.Type.String()}
+	}
+	if key, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		return &ConfigError{Key: strings.Trim(key, `"`), Reason: "unknown key"}
+	}
+	return fmt.Errorf("%s: %w", logger.ErrConfigDecode, err)
+}
+
+// resolveString picks a value with precedence env > flag > file > default.
+func resolveString(envVar string, flagValue string, flagSet bool, fileValue *string, defaultValue string) string {
+	if value, ok := os.LookupEnv(envVar); ok {
+		return value
+	}
+	if flagSet {
+		return flagValue
+	}
+	if fileValue != nil {
+		return *fileValue
+	}
+	return defaultValue
+}
+
+// resolveInt picks a value with precedence env > flag > file > default.
+func resolveInt(envVar string, flagValue int, flagSet bool, fileValue *int, defaultValue int) (int, error) {
+	if value, ok := os.LookupEnv(envVar); ok {
+		intValue, err := strconv.Atoi(value)
+		if err != nil {
+			return 0, &ConfigError{Key: envVar, Reason: logger.ErrFlagInvalidValue}
+		}
+		return intValue, nil
+	}
+	if flagSet {
+		return flagValue, nil
+	}
+	if fileValue != nil {
+		return *fileValue, nil
+	}
+	return defaultValue, nil
+}
+
+// resolveBool picks a value with precedence env > flag > file > default.
+func resolveBool(envVar string, flagValue bool, flagSet bool, fileValue *bool, defaultValue bool) (bool, error) {
+	if value, ok := os.LookupEnv(envVar); ok {
+		boolValue, err := strconv.ParseBool(value)
+		if err != nil {
+			return false, &ConfigError{Key: envVar, Reason: logger.ErrFlagInvalidValue}
+		}
+		return boolValue, nil
+	}
+	if flagSet {
+		return flagValue, nil
+	}
+	if fileValue != nil {
+		return *fileValue, nil
+	}
+	return defaultValue, nil
+}
+
+// stringList is a list setting in a config file, written either as an array
+// or as a comma-separated string.
+type stringList []string
+
+func (l *stringList) UnmarshalJSON(data []byte) error {
+	var items []string
+	if err := json.Unmarshal(data, &items); err == nil {
+		*l = items
+		return nil
+	}
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return &json.UnmarshalTypeError{Value: string(data), Type: reflect.TypeOf(items)}
+	}
+	*l = splitList(value)
+	return nil
+}
+
+// resolveList picks a list with precedence env > flag > file > default.
+// Env, flag and default values are comma-separated.
+func resolveList(envVar string, flagValue string, flagSet bool, fileValue *stringList, defaultValue string) []string {
+	if value, ok := os.LookupEnv(envVar); ok {
+		return splitList(value)
+	}
+	if flagSet {
+		return splitList(flagValue)
+	}
+	if fileValue != nil {
+		return splitList(strings.Join(*fileValue, ","))
+	}
+	return splitList(defaultValue)
+}
+
+// splitList splits a comma-separated setting into trimmed non-empty items.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -4,44 +4,67 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"net/url"
 	"os"
-	"strconv"
 	"time"
 
 	"github.com/avointsev/yp7m-go/internal/logger"
 )
 
+// AgentConfig fields tagged `reload:"true"` are applied on SIGHUP without a restart.
 type AgentConfig struct {
-	Address        string
-	ReportInterval time.Duration
-	PollInterval   time.Duration
+	AgentID        string        `key:"agent_id"`
+	Address        string        `key:"address"`
+	TLSCAFile      string        `key:"tls_ca"`
+	TLSCertFile    string        `key:"tls_cert"`
+	TLSKeyFile     string        `key:"tls_key"`
+	ReportInterval time.Duration `key:"report_interval" reload:"true"`
+	PollInterval   time.Duration `key:"poll_interval" reload:"true"`
+	SpoolPath      string        `key:"spool_path"`
+	SpoolMaxSize   int           `key:"spool_max_size"`
+	SpoolMaxAge    time.Duration `key:"spool_max_age"`
+	ScrapeTargets  []string      `key:"scrape_targets"`
+	ScrapeInterval time.Duration `key:"scrape_interval" reload:"true"`
 }
 
-type ServerConfig struct {
-	Address string
+// UseTLS reports whether the agent should connect over HTTPS.
+func (c AgentConfig) UseTLS() bool {
+	return c.TLSCAFile != "" || c.TLSCertFile != "" || c.TLSKeyFile != ""
 }
 
-func GetEnvOrFlag(envVar string, flagValue string, defaultValue string) string {
-	if value, ok := os.LookupEnv(envVar); ok {
-		return value
-	}
-	if flagValue != "" {
-		return flagValue
-	}
-	return defaultValue
+// ServerConfig fields tagged `reload:"true"` are applied on SIGHUP without a restart.
+type ServerConfig struct {
+	Address          string        `key:"address"`
+	TLSCertFile      string        `key:"tls_cert"`
+	TLSKeyFile       string        `key:"tls_key"`
+	TLSClientCAFile  string        `key:"tls_client_ca"`
+	FileStoragePath  string        `key:"file_storage_path"`
+	StoreInterval    time.Duration `key:"store_interval"`
+	Restore          bool          `key:"restore"`
+	StatsdAddress    string        `key:"statsd_address"`
+	StatsdFlush      time.Duration `key:"statsd_flush_interval"`
+	InfluxCounters   []string      `key:"influx_counter_fields"`
+	GraphiteAddress  string        `key:"graphite_address"`
+	HistoryRetention time.Duration `key:"history_retention" reload:"true"`
+	AgentStale       time.Duration `key:"agent_stale_after" reload:"true"`
+	AgentOffline     time.Duration `key:"agent_offline_after" reload:"true"`
+	AgentForget      time.Duration `key:"agent_forget_after" reload:"true"`
+	StaleAfter       time.Duration `key:"stale_after" reload:"true"`
+	PurgeAfter       time.Duration `key:"purge_after" reload:"true"`
+	AdminToken       string        `key:"admin_token" reload:"true" secret:"true"`
+	AlertRules       string        `key:"alert_rules" reload:"true"`
+	AlertInterval    time.Duration `key:"alert_interval"`
+	WebhookURLs      []string      `key:"webhook_urls" reload:"true"`
+	WebhookRepeat    time.Duration `key:"webhook_repeat_interval" reload:"true"`
+	WebhookRetries   int           `key:"webhook_retries" reload:"true"`
+	WebhookTest      bool          `key:"webhook_test"`
+	RecordingRules   string        `key:"recording_rules" reload:"true"`
+	RecordingInt     time.Duration `key:"recording_interval"`
 }
 
-func GetIntEnvOrFlag(envVar string, flagValue int, defaultValue int) int {
-	if value, ok := os.LookupEnv(envVar); ok {
-		if intValue, err := strconv.Atoi(value); err == nil {
-			return intValue
-		}
-		log.Printf(logger.LogDefaultFormat, logger.ErrFlagInvalidValue, envVar)
-	}
-	if flagValue != 0 {
-		return flagValue
-	}
-	return defaultValue
+// UseTLS reports whether the server should serve HTTPS.
+func (c ServerConfig) UseTLS() bool {
+	return c.TLSCertFile != "" || c.TLSKeyFile != ""
 }
 
 func logErrorf(v ...interface{}) error {
@@ -60,55 +83,426 @@ func logErrorf(v ...interface{}) error {
 	return nil
 }
 
+type agentFileConfig struct {
+	AgentID        *string     `json:"agent_id"`
+	Address        *string     `json:"address"`
+	TLSCAFile      *string     `json:"tls_ca"`
+	TLSCertFile    *string     `json:"tls_cert"`
+	TLSKeyFile     *string     `json:"tls_key"`
+	ReportInterval *int        `json:"report_interval"`
+	PollInterval   *int        `json:"poll_interval"`
+	SpoolPath      *string     `json:"spool_path"`
+	SpoolMaxSize   *int        `json:"spool_max_size"`
+	SpoolMaxAge    *int        `json:"spool_max_age"`
+	ScrapeTargets  *stringList `json:"scrape_targets"`
+	ScrapeInterval *int        `json:"scrape_interval"`
+}
+
+type serverFileConfig struct {
+	Address          *string     `json:"address"`
+	TLSCertFile      *string     `json:"tls_cert"`
+	TLSKeyFile       *string     `json:"tls_key"`
+	TLSClientCAFile  *string     `json:"tls_client_ca"`
+	FileStoragePath  *string     `json:"file_storage_path"`
+	StoreInterval    *int        `json:"store_interval"`
+	Restore          *bool       `json:"restore"`
+	StatsdAddress    *string     `json:"statsd_address"`
+	StatsdFlush      *int        `json:"statsd_flush_interval"`
+	InfluxCounters   *stringList `json:"influx_counter_fields"`
+	GraphiteAddress  *string     `json:"graphite_address"`
+	HistoryRetention *int        `json:"history_retention"`
+	AgentStale       *int        `json:"agent_stale_after"`
+	AgentOffline     *int        `json:"agent_offline_after"`
+	AgentForget      *int        `json:"agent_forget_after"`
+	StaleAfter       *int        `json:"stale_after"`
+	PurgeAfter       *int        `json:"purge_after"`
+	AdminToken       *string     `json:"admin_token"`
+	AlertRules       *string     `json:"alert_rules"`
+	AlertInterval    *int        `json:"alert_interval"`
+	WebhookURLs      *stringList `json:"webhook_urls"`
+	WebhookRepeat    *int        `json:"webhook_repeat_interval"`
+	WebhookRetries   *int        `json:"webhook_retries"`
+	WebhookTest      *bool       `json:"webhook_test"`
+	RecordingRules   *string     `json:"recording_rules"`
+	RecordingInt     *int        `json:"recording_interval"`
+}
+
+// setFlags returns the names of flags explicitly passed on the command line.
+func setFlags(fs *flag.FlagSet) map[string]bool {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	return set
+}
+
 func ParseAgentConfig() (AgentConfig, error) {
+	return LoadAgentConfig(os.Args[1:])
+}
+
+// LoadAgentConfig builds the agent configuration from args, the config file and the environment.
+func LoadAgentConfig(args []string) (AgentConfig, error) {
 	var (
+		flagConfig    string
+		flagAgentID   string
 		flagAddr      string
+		flagTLSCA     string
+		flagTLSCert   string
+		flagTLSKey    string
 		flagReportInt int
 		flagPollInt   int
+		flagSpool     string
+		flagSpoolSize int
+		flagSpoolAge  int
+		flagScrape    string
+		flagScrapeInt int
 	)
 
 	const (
 		defaultflagAddr  string = "localhost:8080"
 		defaultReportInt int    = 10
 		defaultPollInt   int    = 2
+		defaultSpoolSize int    = 10 << 20
+		defaultSpoolAge  int    = 24 * 60 * 60
+		defaultScrapeInt int    = 15
 	)
 
-	flag.StringVar(&flagAddr, "a", defaultflagAddr, "HTTP server endpoint address")
-	flag.IntVar(&flagReportInt, "r", defaultReportInt, "Report interval in seconds")
-	flag.IntVar(&flagPollInt, "p", defaultPollInt, "Poll interval in seconds")
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	fs.StringVar(&flagConfig, "c", "", "Path to JSON or YAML config file")
+	fs.StringVar(&flagAgentID, "id", "", "Agent ID reported to the server, defaults to the hostname")
+	fs.StringVar(&flagAddr, "a", defaultflagAddr, "HTTP server endpoint address")
+	fs.IntVar(&flagReportInt, "r", defaultReportInt, "Report interval in seconds")
+	fs.IntVar(&flagPollInt, "p", defaultPollInt, "Poll interval in seconds")
+	fs.StringVar(&flagTLSCA, "tls-ca", "", "CA bundle used to verify the server certificate")
+	fs.StringVar(&flagTLSCert, "tls-cert", "", "Client certificate file for mTLS")
+	fs.StringVar(&flagTLSKey, "tls-key", "", "Client private key file for mTLS")
+	fs.StringVar(&flagSpool, "spool", "", "Path to spool file for undelivered metrics, empty disables spooling")
+	fs.IntVar(&flagSpoolSize, "spool-max-size", defaultSpoolSize, "Maximum spool size in bytes")
+	fs.IntVar(&flagSpoolAge, "spool-max-age", defaultSpoolAge, "Maximum age of spooled metrics in seconds")
+	fs.StringVar(&flagScrape, "scrape", "", "Comma-separated Prometheus endpoints to scrape, e.g. http://localhost:9100/metrics")
+	fs.IntVar(&flagScrapeInt, "scrape-interval", defaultScrapeInt, "Scrape interval in seconds")
+
+	if err := fs.Parse(args); err != nil {
+		return AgentConfig{}, fmt.Errorf(logger.LogDefaultFormat, logger.ErrFlagsParse, err)
+	}
+
+	if len(fs.Args()) > 0 {
+		return AgentConfig{}, logErrorf(logger.ErrFlagUnknown+": %v", fs.Args())
+	}
+
+	set := setFlags(fs)
+	var file agentFileConfig
+	if path := resolveString("CONFIG", flagConfig, set["c"], nil, ""); path != "" {
+		if err := loadConfigFile(path, &file); err != nil {
+			return AgentConfig{}, err
+		}
+	}
+
+	reportInt, err := resolveInt("REPORT_INTERVAL", flagReportInt, set["r"], file.ReportInterval, defaultReportInt)
+	if err != nil {
+		return AgentConfig{}, err
+	}
+	pollInt, err := resolveInt("POLL_INTERVAL", flagPollInt, set["p"], file.PollInterval, defaultPollInt)
+	if err != nil {
+		return AgentConfig{}, err
+	}
+	spoolSize, err := resolveInt("SPOOL_MAX_SIZE", flagSpoolSize, set["spool-max-size"], file.SpoolMaxSize, defaultSpoolSize)
+	if err != nil {
+		return AgentConfig{}, err
+	}
+	spoolAge, err := resolveInt("SPOOL_MAX_AGE", flagSpoolAge, set["spool-max-age"], file.SpoolMaxAge, defaultSpoolAge)
+	if err != nil {
+		return AgentConfig{}, err
+	}
+	scrapeInt, err := resolveInt("SCRAPE_INTERVAL", flagScrapeInt, set["scrape-interval"], file.ScrapeInterval, defaultScrapeInt)
+	if err != nil {
+		return AgentConfig{}, err
+	}
 
-	flag.Parse()
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
 
-	if len(flag.Args()) > 0 {
-		return AgentConfig{}, logErrorf(logger.ErrFlagUnknown+": %v", flag.Args())
+	config := AgentConfig{
+		AgentID:        resolveString("AGENT_ID", flagAgentID, set["id"], file.AgentID, hostname),
+		Address:        resolveString("ADDRESS", flagAddr, set["a"], file.Address, defaultflagAddr),
+		TLSCAFile:      resolveString("TLS_CA", flagTLSCA, set["tls-ca"], file.TLSCAFile, ""),
+		TLSCertFile:    resolveString("TLS_CERT", flagTLSCert, set["tls-cert"], file.TLSCertFile, ""),
+		TLSKeyFile:     resolveString("TLS_KEY", flagTLSKey, set["tls-key"], file.TLSKeyFile, ""),
+		ReportInterval: time.Duration(reportInt) * time.Second,
+		PollInterval:   time.Duration(pollInt) * time.Second,
+		SpoolPath:      resolveString("SPOOL_PATH", flagSpool, set["spool"], file.SpoolPath, ""),
+		SpoolMaxSize:   spoolSize,
+		SpoolMaxAge:    time.Duration(spoolAge) * time.Second,
+		ScrapeTargets:  resolveList("SCRAPE_TARGETS", flagScrape, set["scrape"], file.ScrapeTargets, ""),
+		ScrapeInterval: time.Duration(scrapeInt) * time.Second,
 	}
 
-	address := GetEnvOrFlag("ADDRESS", flagAddr, defaultflagAddr)
-	reportInterval := time.Duration(GetIntEnvOrFlag("REPORT_INTERVAL", flagReportInt, defaultReportInt)) * time.Second
-	pollInterval := time.Duration(GetIntEnvOrFlag("POLL_INTERVAL", flagPollInt, defaultPollInt)) * time.Second
+	return config, config.Validate()
+}
 
-	return AgentConfig{
-		Address:        address,
-		ReportInterval: reportInterval,
-		PollInterval:   pollInterval,
-	}, nil
+// Validate checks the agent configuration and names the first invalid key.
+func (c AgentConfig) Validate() error {
+	switch {
+	case c.AgentID == "":
+		return &ConfigError{Key: "agent_id", Reason: "must not be empty"}
+	case c.Address == "":
+		return &ConfigError{Key: "address", Reason: "must not be empty"}
+	case c.ReportInterval <= 0:
+		return &ConfigError{Key: "report_interval", Reason: "must be positive"}
+	case c.PollInterval <= 0:
+		return &ConfigError{Key: "poll_interval", Reason: "must be positive"}
+	case (c.TLSCertFile == "") != (c.TLSKeyFile == ""):
+		return &ConfigError{Key: "tls_key", Reason: logger.ErrTLSKeyPairRequired}
+	case c.SpoolMaxSize < 0:
+		return &ConfigError{Key: "spool_max_size", Reason: "must not be negative"}
+	case c.SpoolMaxAge < 0:
+		return &ConfigError{Key: "spool_max_age", Reason: "must not be negative"}
+	case c.ScrapeInterval <= 0:
+		return &ConfigError{Key: "scrape_interval", Reason: "must be positive"}
+	}
+	for _, target := range c.ScrapeTargets {
+		if !validURL(target) {
+			return &ConfigError{Key: "scrape_targets", Reason: fmt.Sprintf("invalid URL %q", target)}
+		}
+	}
+	return nil
+}
+
+// validURL reports whether raw is an absolute http or https URL.
+func validURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
 }
 
 func ParseServerConfig() (ServerConfig, error) {
-	var flagAddr string
-	const defaultflagAddr string = "localhost:8080"
+	return LoadServerConfig(os.Args[1:])
+}
+
+// LoadServerConfig builds the server configuration from args, the config file and the environment.
+func LoadServerConfig(args []string) (ServerConfig, error) {
+	var (
+		flagConfig   string
+		flagAddr     string
+		flagTLSCert  string
+		flagTLSKey   string
+		flagClientCA string
+		flagFile     string
+		flagStoreInt int
+		flagRestore  bool
+		flagStatsd   string
+		flagStatsdFl int
+		flagInfluxCt string
+		flagGraphite string
+		flagHistory  int
+		flagStale    int
+		flagOffline  int
+		flagForget   int
+		flagStaleTTL int
+		flagPurgeTTL int
+		flagAdmin    string
+		flagAlerts   string
+		flagAlertInt int
+		flagWebhooks string
+		flagRepeat   int
+		flagRetries  int
+		flagWebhookT bool
+		flagRecRules string
+		flagRecInt   int
+	)
+	const (
+		defaultflagAddr string = "localhost:8080"
+		defaultStoreInt int    = 300
+		defaultRestore  bool   = true
+		defaultStatsdFl int    = 10
+		defaultHistory  int    = 60 * 60
+		defaultStale    int    = 60
+		defaultOffline  int    = 5 * 60
+		defaultForget   int    = 24 * 60 * 60
+		defaultStaleTTL int    = 5 * 60
+		defaultAlertInt int    = 15
+		defaultRepeat   int    = 4 * 60 * 60
+		defaultRetries  int    = 3
+		defaultRecInt   int    = 15
+	)
+
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	fs.StringVar(&flagConfig, "c", "", "Path to JSON or YAML config file")
+	fs.StringVar(&flagAddr, "a", defaultflagAddr, "HTTP server address")
+	fs.StringVar(&flagTLSCert, "tls-cert", "", "TLS certificate file, enables HTTPS")
+	fs.StringVar(&flagTLSKey, "tls-key", "", "TLS private key file")
+	fs.StringVar(&flagClientCA, "tls-client-ca", "", "CA bundle for verifying agent client certificates")
+	fs.StringVar(&flagFile, "f", "", "File to persist metrics to, empty disables persistence")
+	fs.IntVar(&flagStoreInt, "i", defaultStoreInt, "Persist interval in seconds, 0 saves only on shutdown")
+	fs.BoolVar(&flagRestore, "r", defaultRestore, "Restore metrics from file on start")
+	fs.StringVar(&flagStatsd, "statsd", "", "UDP address for the StatsD listener, empty disables it")
+	fs.IntVar(&flagStatsdFl, "statsd-flush", defaultStatsdFl, "StatsD flush interval in seconds")
+	fs.StringVar(&flagInfluxCt, "influx-counters", "",
+		"Comma-separated name patterns of Influx integer fields stored as cumulative counters")
+	fs.StringVar(&flagGraphite, "graphite", "", "TCP address for the Graphite plaintext listener, empty disables it")
+	fs.IntVar(&flagHistory, "history-retention", defaultHistory, "How long metric history is kept, in seconds")
+	fs.IntVar(&flagStale, "agent-stale", defaultStale, "Seconds without a report after which an agent is stale")
+	fs.IntVar(&flagOffline, "agent-offline", defaultOffline, "Seconds without a report after which an agent is offline")
+	fs.IntVar(&flagForget, "agent-forget", defaultForget, "Seconds without a report after which an agent is removed")
+	fs.IntVar(&flagStaleTTL, "stale-after", defaultStaleTTL, "Seconds without updates after which a metric is stale, 0 disables")
+	fs.IntVar(&flagPurgeTTL, "purge-after", 0, "Seconds without updates after which a metric is removed, 0 disables")
+	fs.StringVar(&flagAdmin, "admin-token", "", "Bearer token for the delete and reset API, empty disables it")
+	fs.StringVar(&flagAlerts, "alert-rules", "", "File with alerting rules, one per line")
+	fs.IntVar(&flagAlertInt, "alert-interval", defaultAlertInt, "Alert rule evaluation interval in seconds")
+	fs.StringVar(&flagWebhooks, "webhook", "", "Comma-separated webhook URLs notified when alerts fire or resolve")
+	fs.IntVar(&flagRepeat, "webhook-repeat", defaultRepeat, "Seconds after which a still-firing alert is notified again")
+	fs.IntVar(&flagRetries, "webhook-retries", defaultRetries, "Retries for a failed webhook delivery")
+	fs.BoolVar(&flagWebhookT, "webhook-test", false, "Also send notifications to the built-in test sink at /webhook/sink")
+	fs.StringVar(&flagRecRules, "recording-rules", "", "File with recording rules, one name = expression per line")
+	fs.IntVar(&flagRecInt, "recording-interval", defaultRecInt, "Recording rule evaluation interval in seconds")
 
-	flag.StringVar(&flagAddr, "a", defaultflagAddr, "HTTP server address")
+	if err := fs.Parse(args); err != nil {
+		return ServerConfig{}, fmt.Errorf(logger.LogDefaultFormat, logger.ErrFlagsParse, err)
+	}
+
+	if len(fs.Args()) > 0 {
+		return ServerConfig{}, logErrorf(logger.ErrFlagUnknown+": %v", fs.Args())
+	}
+
+	set := setFlags(fs)
+	var file serverFileConfig
+	if path := resolveString("CONFIG", flagConfig, set["c"], nil, ""); path != "" {
+		if err := loadConfigFile(path, &file); err != nil {
+			return ServerConfig{}, err
+		}
+	}
 
-	flag.Parse()
+	storeInt, err := resolveInt("STORE_INTERVAL", flagStoreInt, set["i"], file.StoreInterval, defaultStoreInt)
+	if err != nil {
+		return ServerConfig{}, err
+	}
+	restore, err := resolveBool("RESTORE", flagRestore, set["r"], file.Restore, defaultRestore)
+	if err != nil {
+		return ServerConfig{}, err
+	}
+	history, err := resolveInt("HISTORY_RETENTION", flagHistory, set["history-retention"], file.HistoryRetention, defaultHistory)
+	if err != nil {
+		return ServerConfig{}, err
+	}
+	statsdFlush, err := resolveInt("STATSD_FLUSH_INTERVAL", flagStatsdFl, set["statsd-flush"], file.StatsdFlush, defaultStatsdFl)
+	if err != nil {
+		return ServerConfig{}, err
+	}
+	stale, err := resolveInt("AGENT_STALE_AFTER", flagStale, set["agent-stale"], file.AgentStale, defaultStale)
+	if err != nil {
+		return ServerConfig{}, err
+	}
+	offline, err := resolveInt("AGENT_OFFLINE_AFTER", flagOffline, set["agent-offline"], file.AgentOffline, defaultOffline)
+	if err != nil {
+		return ServerConfig{}, err
+	}
+	forget, err := resolveInt("AGENT_FORGET_AFTER", flagForget, set["agent-forget"], file.AgentForget, defaultForget)
+	if err != nil {
+		return ServerConfig{}, err
+	}
+	staleTTL, err := resolveInt("STALE_AFTER", flagStaleTTL, set["stale-after"], file.StaleAfter, defaultStaleTTL)
+	if err != nil {
+		return ServerConfig{}, err
+	}
+	purgeTTL, err := resolveInt("PURGE_AFTER", flagPurgeTTL, set["purge-after"], file.PurgeAfter, 0)
+	if err != nil {
+		return ServerConfig{}, err
+	}
+	alertInt, err := resolveInt("ALERT_INTERVAL", flagAlertInt, set["alert-interval"], file.AlertInterval, defaultAlertInt)
+	if err != nil {
+		return ServerConfig{}, err
+	}
+	repeat, err := resolveInt("WEBHOOK_REPEAT_INTERVAL", flagRepeat, set["webhook-repeat"], file.WebhookRepeat, defaultRepeat)
+	if err != nil {
+		return ServerConfig{}, err
+	}
+	retries, err := resolveInt("WEBHOOK_RETRIES", flagRetries, set["webhook-retries"], file.WebhookRetries, defaultRetries)
+	if err != nil {
+		return ServerConfig{}, err
+	}
+	webhookTest, err := resolveBool("WEBHOOK_TEST", flagWebhookT, set["webhook-test"], file.WebhookTest, false)
+	if err != nil {
+		return ServerConfig{}, err
+	}
+	recInt, err := resolveInt("RECORDING_INTERVAL", flagRecInt, set["recording-interval"], file.RecordingInt, defaultRecInt)
+	if err != nil {
+		return ServerConfig{}, err
+	}
 
-	if len(flag.Args()) > 0 {
-		return ServerConfig{}, logErrorf(logger.ErrFlagUnknown+": %v", flag.Args())
+	config := ServerConfig{
+		Address:         resolveString("ADDRESS", flagAddr, set["a"], file.Address, defaultflagAddr),
+		TLSCertFile:     resolveString("TLS_CERT", flagTLSCert, set["tls-cert"], file.TLSCertFile, ""),
+		TLSKeyFile:      resolveString("TLS_KEY", flagTLSKey, set["tls-key"], file.TLSKeyFile, ""),
+		TLSClientCAFile: resolveString("TLS_CLIENT_CA", flagClientCA, set["tls-client-ca"], file.TLSClientCAFile, ""),
+		FileStoragePath: resolveString("FILE_STORAGE_PATH", flagFile, set["f"], file.FileStoragePath, ""),
+		StoreInterval:   time.Duration(storeInt) * time.Second,
+		Restore:         restore,
+		StatsdAddress:   resolveString("STATSD_ADDRESS", flagStatsd, set["statsd"], file.StatsdAddress, ""),
+		StatsdFlush:     time.Duration(statsdFlush) * time.Second,
+		InfluxCounters: resolveList("INFLUX_COUNTER_FIELDS", flagInfluxCt, set["influx-counters"],
+			file.InfluxCounters, ""),
+		GraphiteAddress:  resolveString("GRAPHITE_ADDRESS", flagGraphite, set["graphite"], file.GraphiteAddress, ""),
+		HistoryRetention: time.Duration(history) * time.Second,
+		AgentStale:       time.Duration(stale) * time.Second,
+		AgentOffline:     time.Duration(offline) * time.Second,
+		AgentForget:      time.Duration(forget) * time.Second,
+		StaleAfter:       time.Duration(staleTTL) * time.Second,
+		PurgeAfter:       time.Duration(purgeTTL) * time.Second,
+		AdminToken:       resolveString("ADMIN_TOKEN", flagAdmin, set["admin-token"], file.AdminToken, ""),
+		AlertRules:       resolveString("ALERT_RULES", flagAlerts, set["alert-rules"], file.AlertRules, ""),
+		AlertInterval:    time.Duration(alertInt) * time.Second,
+		WebhookURLs:      resolveList("WEBHOOK_URLS", flagWebhooks, set["webhook"], file.WebhookURLs, ""),
+		WebhookRepeat:    time.Duration(repeat) * time.Second,
+		WebhookRetries:   retries,
+		WebhookTest:      webhookTest,
+		RecordingRules:   resolveString("RECORDING_RULES", flagRecRules, set["recording-rules"], file.RecordingRules, ""),
+		RecordingInt:     time.Duration(recInt) * time.Second,
 	}
 
-	address := GetEnvOrFlag("ADDRESS", flagAddr, defaultflagAddr)
+	return config, config.Validate()
+}
 
-	return ServerConfig{
-		Address: address,
-	}, nil
+// Validate checks the server configuration and names the first invalid key.
+func (c ServerConfig) Validate() error {
+	switch {
+	case c.Address == "":
+		return &ConfigError{Key: "address", Reason: "must not be empty"}
+	case (c.TLSCertFile == "") != (c.TLSKeyFile == ""):
+		return &ConfigError{Key: "tls_key", Reason: logger.ErrTLSKeyPairRequired}
+	case c.TLSClientCAFile != "" && c.TLSCertFile == "":
+		return &ConfigError{Key: "tls_client_ca", Reason: "requires tls_cert and tls_key"}
+	case c.StoreInterval < 0:
+		return &ConfigError{Key: "store_interval", Reason: "must not be negative"}
+	case c.StatsdAddress != "" && c.StatsdFlush <= 0:
+		return &ConfigError{Key: "statsd_flush_interval", Reason: "must be positive"}
+	case c.HistoryRetention <= 0:
+		return &ConfigError{Key: "history_retention", Reason: "must be positive"}
+	case c.AgentStale <= 0:
+		return &ConfigError{Key: "agent_stale_after", Reason: "must be positive"}
+	case c.AgentOffline < c.AgentStale:
+		return &ConfigError{Key: "agent_offline_after", Reason: "must not be less than agent_stale_after"}
+	case c.AgentForget < c.AgentOffline:
+		return &ConfigError{Key: "agent_forget_after", Reason: "must not be less than agent_offline_after"}
+	case c.StaleAfter < 0:
+		return &ConfigError{Key: "stale_after", Reason: "must not be negative"}
+	case c.PurgeAfter < 0:
+		return &ConfigError{Key: "purge_after", Reason: "must not be negative"}
+	case c.PurgeAfter > 0 && c.PurgeAfter < c.StaleAfter:
+		return &ConfigError{Key: "purge_after", Reason: "must not be less than stale_after"}
+	case c.AlertInterval <= 0:
+		return &ConfigError{Key: "alert_interval", Reason: "must be positive"}
+	case c.WebhookRepeat <= 0:
+		return &ConfigError{Key: "webhook_repeat_interval", Reason: "must be positive"}
+	case c.WebhookRetries < 0:
+		return &ConfigError{Key: "webhook_retries", Reason: "must not be negative"}
+	case c.RecordingInt <= 0:
+		return &ConfigError{Key: "recording_interval", Reason: "must be positive"}
+	}
+	for _, webhook := range c.WebhookURLs {
+		if !validURL(webhook) {
+			return &ConfigError{Key: "webhook_urls", Reason: fmt.Sprintf("invalid URL %q", webhook)}
+		}
+	}
+	return nil
 }
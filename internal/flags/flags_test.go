@@ -2,7 +2,10 @@ package flags
 
 import (
 	"bytes"
+	"errors"
 	"flag"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -16,9 +19,17 @@ func TestAgentEnvVariables(t *testing.T) {
 	flagReportInt := 10
 	flagPollInt := 2
 
-	address := GetEnvOrFlag("ADDRESS", flagAddr, "localhost:8080")
-	reportInterval := time.Duration(GetIntEnvOrFlag("REPORT_INTERVAL", flagReportInt, 10)) * time.Second
-	pollInterval := time.Duration(GetIntEnvOrFlag("POLL_INTERVAL", flagPollInt, 2)) * time.Second
+	address := resolveString("ADDRESS", flagAddr, true, nil, "localhost:8080")
+	reportInt, err := resolveInt("REPORT_INTERVAL", flagReportInt, true, nil, 10)
+	if err != nil {
+		t.Fatalf("Failed to resolve REPORT_INTERVAL: %v", err)
+	}
+	pollInt, err := resolveInt("POLL_INTERVAL", flagPollInt, true, nil, 2)
+	if err != nil {
+		t.Fatalf("Failed to resolve POLL_INTERVAL: %v", err)
+	}
+	reportInterval := time.Duration(reportInt) * time.Second
+	pollInterval := time.Duration(pollInt) * time.Second
 
 	if address != "envhost:9090" {
 		t.Errorf("Expected address to be 'envhost:9090' from environment variable, got %s", address)
@@ -87,7 +98,7 @@ func TestServerEnvVariables(t *testing.T) {
 	t.Setenv("ADDRESS", "envhost:9090")
 	flagAddr := "flaghost:8081"
 
-	address := GetEnvOrFlag("ADDRESS", flagAddr, "localhost:8080")
+	address := resolveString("ADDRESS", flagAddr, true, nil, "localhost:8080")
 
 	if address != "envhost:9090" {
 		t.Errorf("Expected address to be 'envhost:9090' from environment variable, got %s", address)
@@ -125,3 +136,169 @@ func TestServerInvalidFlags(t *testing.T) {
 		t.Error("Expected error message for unknown flag")
 	}
 }
+
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	return path
+}
+
+func TestAgentConfigFilePrecedence(t *testing.T) {
+	path := writeConfig(t, "agent.yaml", "address: filehost:7070\nreport_interval: 30\npoll_interval: 3\n")
+	t.Setenv("POLL_INTERVAL", "7")
+
+	config, err := LoadAgentConfig([]string{"-c", path, "-r", "20"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if config.Address != "filehost:7070" {
+		t.Errorf("Expected address from file, got %s", config.Address)
+	}
+	if config.ReportInterval != 20*time.Second {
+		t.Errorf("Expected report interval from flag, got %v", config.ReportInterval)
+	}
+	if config.PollInterval != 7*time.Second {
+		t.Errorf("Expected poll interval from environment, got %v", config.PollInterval)
+	}
+}
+
+func TestServerConfigFileFromEnv(t *testing.T) {
+	path := writeConfig(t, "server.json", `{"address": "filehost:9091"}`)
+	t.Setenv("CONFIG", path)
+
+	config, err := LoadServerConfig(nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if config.Address != "filehost:9091" {
+		t.Errorf("Expected address from file, got %s", config.Address)
+	}
+}
+
+func TestConfigFileErrorsNameKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		key     string
+	}{
+		{"unknown key", "agent.json", `{"adress": "x"}`, "adress"},
+		{"wrong type", "agent.yaml", "report_interval: soon\n", "report_interval"},
+		{"invalid value", "agent.yaml", "poll_interval: 0\n", "poll_interval"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeConfig(t, tt.file, tt.content)
+			_, err := LoadAgentConfig([]string{"-c", path})
+
+			var configErr *ConfigError
+			if !errors.As(err, &configErr) {
+				t.Fatalf("Expected ConfigError, got %v", err)
+			}
+			if configErr.Key != tt.key {
+				t.Errorf("Expected error for key %q, got %q", tt.key, configErr.Key)
+			}
+		})
+	}
+}
+
+func TestReloadAppliesOnlySafeChanges(t *testing.T) {
+	current := AgentConfig{Address: "localhost:8080", ReportInterval: 10 * time.Second, PollInterval: 2 * time.Second}
+	next := AgentConfig{Address: "otherhost:8080", ReportInterval: 5 * time.Second, PollInterval: 2 * time.Second}
+
+	result, changes := Reload(current, next)
+
+	if result.ReportInterval != 5*time.Second {
+		t.Errorf("Expected report interval to be reloaded, got %v", result.ReportInterval)
+	}
+	if result.Address != "localhost:8080" {
+		t.Errorf("Expected address to require restart, got %s", result.Address)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("Expected 2 changes, got %d", len(changes))
+	}
+	for _, c := range changes {
+		if c.Key == "address" && c.Applied {
+			t.Error("Expected address change not to be applied")
+		}
+		if c.Key == "report_interval" && !c.Applied {
+			t.Error("Expected report_interval change to be applied")
+		}
+	}
+}
+
+func TestAgentScrapeTargets(t *testing.T) {
+	config, err := LoadAgentConfig([]string{"-scrape", "http://localhost:9100/metrics, http://localhost:9200/metrics"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(config.ScrapeTargets) != 2 || config.ScrapeTargets[1] != "http://localhost:9200/metrics" {
+		t.Errorf("unexpected scrape targets %v", config.ScrapeTargets)
+	}
+
+	_, err = LoadAgentConfig([]string{"-scrape", "localhost:9100"})
+	var configErr *ConfigError
+	if !errors.As(err, &configErr) || configErr.Key != "scrape_targets" {
+		t.Errorf("expected scrape_targets error, got %v", err)
+	}
+}
+
+func TestConfigFileLists(t *testing.T) {
+	path := writeConfig(t, "agent.yaml",
+		"scrape_targets:\n  - http://localhost:9100/metrics\n  - http://localhost:9200/metrics\n")
+	config, err := LoadAgentConfig([]string{"-c", path})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(config.ScrapeTargets) != 2 || config.ScrapeTargets[1] != "http://localhost:9200/metrics" {
+		t.Errorf("unexpected scrape targets %v", config.ScrapeTargets)
+	}
+
+	path = writeConfig(t, "server.json", `{"webhook_urls": "http://a.example/hook, http://b.example/hook"}`)
+	server, err := LoadServerConfig([]string{"-c", path})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(server.WebhookURLs) != 2 || server.WebhookURLs[0] != "http://a.example/hook" {
+		t.Errorf("unexpected webhook urls %v", server.WebhookURLs)
+	}
+
+	path = writeConfig(t, "agent.json", `{"scrape_targets": 5}`)
+	if _, err = LoadAgentConfig([]string{"-c", path}); err == nil {
+		t.Error("expected error for a numeric scrape_targets")
+	}
+}
+
+func TestServerExpiryValidation(t *testing.T) {
+	config, err := LoadServerConfig([]string{"-stale-after", "60", "-purge-after", "3600"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.StaleAfter != time.Minute || config.PurgeAfter != time.Hour {
+		t.Errorf("unexpected expiry %v %v", config.StaleAfter, config.PurgeAfter)
+	}
+
+	_, err = LoadServerConfig([]string{"-stale-after", "600", "-purge-after", "60"})
+	var configErr *ConfigError
+	if !errors.As(err, &configErr) || configErr.Key != "purge_after" {
+		t.Errorf("expected purge_after error, got %v", err)
+	}
+}
+
+func TestReloadMasksSecrets(t *testing.T) {
+	current := ServerConfig{AdminToken: "old-token"}
+	next := ServerConfig{AdminToken: "new-token"}
+
+	result, changes := Reload(current, next)
+	if result.AdminToken != "new-token" {
+		t.Errorf("Expected admin token to be reloaded, got %q", result.AdminToken)
+	}
+	if len(changes) != 1 || changes[0].Old != "***" || changes[0].New != "***" {
+		t.Errorf("Expected masked admin token change, got %+v", changes)
+	}
+}
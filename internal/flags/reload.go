@@ -0,0 +1,81 @@
+package flags
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+
+	"github.com/avointsev/yp7m-go/internal/logger"
+)
+
+// Change describes a configuration value that differs after a reload.
+type Change struct {
+	Key     string
+	Old     string
+	New     string
+	Applied bool
+}
+
+// Reload copies the fields of next tagged `reload:"true"` into current and
+// returns every detected change. Fields without the tag require a restart
+// and keep their current value. Values of fields tagged `secret:"true"` are
+// masked in the reported changes.
+func Reload[T any](current, next T) (T, []Change) {
+	result := current
+	resultValue := reflect.ValueOf(&result).Elem()
+	nextValue := reflect.ValueOf(next)
+	resultType := resultValue.Type()
+
+	var changes []Change
+	for i := range resultType.NumField() {
+		field := resultType.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		oldField, newField := resultValue.Field(i), nextValue.Field(i)
+		if reflect.DeepEqual(oldField.Interface(), newField.Interface()) {
+			continue
+		}
+
+		key := field.Tag.Get("key")
+		if key == "" {
+			key = field.Name
+		}
+		change := Change{
+			Key:     key,
+			Old:     fmt.Sprint(oldField.Interface()),
+			New:     fmt.Sprint(newField.Interface()),
+			Applied: field.Tag.Get("reload") == "true",
+		}
+		if field.Tag.Get("secret") == "true" {
+			change.Old, change.New = maskSecret(change.Old), maskSecret(change.New)
+		}
+		if change.Applied {
+			oldField.Set(newField)
+		}
+		changes = append(changes, change)
+	}
+	return result, changes
+}
+
+// LogChanges reports the outcome of a configuration reload.
+func LogChanges(changes []Change) {
+	if len(changes) == 0 {
+		log.Println(logger.OkConfigUnchanged)
+		return
+	}
+	for _, c := range changes {
+		if c.Applied {
+			log.Printf("%s: %s %s -> %s", logger.OkConfigReloaded, c.Key, c.Old, c.New)
+		} else {
+			log.Printf("%s: %s %s -> %s", logger.ErrConfigRestartNeeded, c.Key, c.Old, c.New)
+		}
+	}
+}
+
+func maskSecret(value string) string {
+	if value == "" {
+		return `""`
+	}
+	return "***"
+}
@@ -0,0 +1,121 @@
+// Package hll implements a HyperLogLog sketch for approximate distinct counts.
+package hll
+
+import (
+	"errors"
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"slices"
+	"strconv"
+)
+
+// DefaultPrecision gives a standard error of about 0.8% using 16KiB of registers.
+const DefaultPrecision = 14
+
+const (
+	minPrecision = 4
+	maxPrecision = 18
+)
+
+var (
+	// ErrPrecisionMismatch is returned when merging sketches of different precision.
+	ErrPrecisionMismatch = errors.New("hll precision does not match")
+	// ErrInvalidSketch is returned for sketches with inconsistent precision and registers.
+	ErrInvalidSketch = errors.New("invalid hll sketch")
+)
+
+// HLL estimates the number of distinct members added to it. Members are hashed
+// with a fixed function so sketches built by different processes can be merged.
+type HLL struct {
+	Registers []byte `json:"registers"`
+	Precision uint8  `json:"precision"`
+}
+
+// New creates an empty sketch with 2^precision registers.
+func New(precision uint8) *HLL {
+	return &HLL{
+		Precision: precision,
+		Registers: make([]byte, 1<<precision),
+	}
+}
+
+// Validate checks that the register count matches the precision.
+func (h *HLL) Validate() error {
+	if h.Precision < minPrecision || h.Precision > maxPrecision || len(h.Registers) != 1<<h.Precision {
+		return ErrInvalidSketch
+	}
+	return nil
+}
+
+// Add records a member.
+func (h *HLL) Add(member string) {
+	hasher := fnv.New64a()
+	_, _ = hasher.Write([]byte(member))
+	x := mix(hasher.Sum64())
+
+	p := h.Precision
+	idx := x >> (64 - p)
+	w := x<<p | 1<<(p-1)
+	rho := byte(bits.LeadingZeros64(w) + 1)
+	if rho > h.Registers[idx] {
+		h.Registers[idx] = rho
+	}
+}
+
+// Merge combines other into h so that h estimates the union of both sets.
+func (h *HLL) Merge(other *HLL) error {
+	if h.Precision != other.Precision || len(h.Registers) != len(other.Registers) {
+		return ErrPrecisionMismatch
+	}
+	for i, r := range other.Registers {
+		if r > h.Registers[i] {
+			h.Registers[i] = r
+		}
+	}
+	return nil
+}
+
+// Clone returns a deep copy of the sketch.
+func (h *HLL) Clone() *HLL {
+	return &HLL{Precision: h.Precision, Registers: slices.Clone(h.Registers)}
+}
+
+// Estimate returns the approximate number of distinct members.
+func (h *HLL) Estimate() uint64 {
+	m := float64(len(h.Registers))
+	if m == 0 {
+		return 0
+	}
+
+	var sum float64
+	var zeros int
+	for _, r := range h.Registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	alpha := 0.7213 / (1 + 1.079/m)
+	estimate := alpha * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(estimate + 0.5)
+}
+
+// String renders the distinct count estimate for display.
+func (h *HLL) String() string {
+	return "distinct~" + strconv.FormatUint(h.Estimate(), 10)
+}
+
+// mix is the 64-bit finalizer of MurmurHash3, spreading FNV output over all bits.
+func mix(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
@@ -0,0 +1,64 @@
+package hll
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestEstimateAccuracy(t *testing.T) {
+	for _, n := range []int{10, 1000, 100000} {
+		h := New(DefaultPrecision)
+		for i := range n {
+			h.Add("user-" + strconv.Itoa(i))
+			h.Add("user-" + strconv.Itoa(i))
+		}
+
+		got := float64(h.Estimate())
+		if math.Abs(got-float64(n))/float64(n) > 0.03 {
+			t.Errorf("Estimate() = %v for %d distinct members", got, n)
+		}
+	}
+}
+
+func TestMergeIsUnion(t *testing.T) {
+	a, b := New(DefaultPrecision), New(DefaultPrecision)
+	for i := range 5000 {
+		a.Add("ip-" + strconv.Itoa(i))
+		b.Add("ip-" + strconv.Itoa(i+2500))
+	}
+
+	if err := a.Merge(b); err != nil {
+		t.Fatalf("unexpected merge error: %v", err)
+	}
+	got := float64(a.Estimate())
+	if math.Abs(got-7500)/7500 > 0.03 {
+		t.Errorf("expected union estimate near 7500, got %v", got)
+	}
+
+	if err := a.Merge(New(10)); err == nil {
+		t.Error("expected error when merging different precisions")
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	h := New(DefaultPrecision)
+	h.Add("a")
+	h.Add("b")
+
+	data, err := json.Marshal(h)
+	if err != nil {
+		t.Fatalf("unexpected marshal error: %v", err)
+	}
+	var decoded HLL
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("unexpected unmarshal error: %v", err)
+	}
+	if err := decoded.Validate(); err != nil {
+		t.Fatalf("expected decoded sketch to be valid: %v", err)
+	}
+	if decoded.Estimate() != 2 {
+		t.Errorf("expected estimate 2 after round trip, got %d", decoded.Estimate())
+	}
+}
@@ -0,0 +1,98 @@
+// Package labels encodes metric labels into series keys of the form
+// name{key="value",...}, with keys sorted, so that labelled series can be
+// stored under a single name alongside unlabelled metrics.
+package labels
+
+import (
+	"errors"
+	"slices"
+	"strings"
+)
+
+// ErrInvalidSeries is returned for malformed series keys.
+var ErrInvalidSeries = errors.New("invalid series key")
+
+// Labels is a set of label names and values.
+type Labels map[string]string
+
+// Series returns the canonical series key for name and labels.
+func Series(name string, l Labels) string {
+	if len(l) == 0 {
+		return name
+	}
+	keys := make([]string, 0, len(l))
+	for k := range l {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	var b strings.Builder
+	b.WriteString(name)
+	b.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(k)
+		b.WriteString(`="`)
+		b.WriteString(escape(l[k]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// Parse splits a series key into its metric name and labels.
+func Parse(series string) (string, Labels, error) {
+	name, rest, ok := strings.Cut(series, "{")
+	if !ok {
+		return series, nil, nil
+	}
+	if !strings.HasSuffix(rest, "}") {
+		return "", nil, ErrInvalidSeries
+	}
+	rest = rest[:len(rest)-1]
+
+	l := make(Labels)
+	for rest != "" {
+		key, value, ok := strings.Cut(rest, `="`)
+		if !ok || key == "" {
+			return "", nil, ErrInvalidSeries
+		}
+		var b strings.Builder
+		i := 0
+		for ; i < len(value); i++ {
+			c := value[i]
+			if c == '"' {
+				break
+			}
+			if c == '\\' && i+1 < len(value) {
+				i++
+				switch value[i] {
+				case 'n':
+					b.WriteByte('\n')
+				default:
+					b.WriteByte(value[i])
+				}
+				continue
+			}
+			b.WriteByte(c)
+		}
+		if i == len(value) {
+			return "", nil, ErrInvalidSeries
+		}
+		l[key] = b.String()
+		rest = strings.TrimPrefix(value[i+1:], ",")
+	}
+	return name, l, nil
+}
+
+// Name returns the metric name of a series key.
+func Name(series string) string {
+	name, _, _ := strings.Cut(series, "{")
+	return name
+}
+
+func escape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
@@ -0,0 +1,41 @@
+package labels
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestSeriesRoundTrip(t *testing.T) {
+	l := Labels{"host": "web-1", "region": `eu "west"`, "path": `C:\tmp`}
+
+	series := Series("cpu_usage", l)
+	if series != `cpu_usage{host="web-1",path="C:\\tmp",region="eu \"west\""}` {
+		t.Errorf("unexpected series key %s", series)
+	}
+
+	name, parsed, err := Parse(series)
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+	if name != "cpu_usage" || !maps.Equal(parsed, l) {
+		t.Errorf("expected cpu_usage %v, got %s %v", l, name, parsed)
+	}
+}
+
+func TestSeriesWithoutLabels(t *testing.T) {
+	if series := Series("Alloc", nil); series != "Alloc" {
+		t.Errorf("expected plain name, got %s", series)
+	}
+	name, l, err := Parse("Alloc")
+	if err != nil || name != "Alloc" || len(l) != 0 {
+		t.Errorf("expected plain name without labels, got %s %v %v", name, l, err)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, series := range []string{`cpu{host="a"`, `cpu{host}`, `cpu{host="a}`} {
+		if _, _, err := Parse(series); err == nil {
+			t.Errorf("expected error for %s", series)
+		}
+	}
+}
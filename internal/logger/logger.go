@@ -9,6 +9,13 @@ const (
 	ErrMetricNotFound            = "metric not found"
 	ErrMetricInvalidGaugeValue   = "Invalid gauge value"
 	ErrMetricInvalidCounterValue = "Invalid counter value"
+	ErrMetricInvalidJSON         = "Invalid metric JSON"
+	ErrHistogramInvalid          = "Invalid histogram buckets"
+	ErrHistogramBounds           = "Histogram bucket bounds do not match stored metric"
+	ErrSummaryInvalid            = "Invalid summary sketch"
+	ErrSummaryQuantile           = "Quantile must be between 0 and 1"
+	ErrSummaryWindow             = "Summary window exceeds retention"
+	ErrMetricReserved            = "Metric name is in the reserved namespace"
 	ErrWriteResponce             = "Failed to write response"
 	OkUpdated                    = "updated successfully"
 
@@ -17,15 +24,98 @@ const (
 
 	ErrFlagsParse = "Failed to parse arguments"
 
+	ErrConfigRead   = "Failed to read config file"
+	ErrConfigDecode = "Failed to decode config file"
+	ErrConfigFormat = "Unsupported config file format"
+
+	ErrConfigReload        = "Config reload rejected"
+	ErrConfigRestartNeeded = "Config change requires restart"
+	OkConfigReloaded       = "Config reloaded"
+	OkConfigUnchanged      = "Config reloaded without changes"
+
+	ErrStorageSave = "Failed to save metrics"
+	ErrStorageLoad = "Failed to restore metrics"
+	OkStorageSaved = "Metrics saved"
+
+	OkMetricsExpired = "Removed expired metrics"
+
+	ErrAdminDisabled     = "Admin API is disabled"
+	ErrAdminUnauthorized = "Admin token required"
+	ErrDeleteSelector    = "Bulk delete requires a prefix or label selector"
+	OkMetricDeleted      = "deleted"
+	OkCounterReset       = "reset"
+
+	ErrAlertRulesRead   = "Failed to read alert rules"
+	ErrAlertRuleInvalid = "Invalid alert rule"
+	OkAlertRulesLoaded  = "Alert rules loaded"
+
+	ErrWebhookSend     = "Failed to send webhook notification"
+	ErrWebhookResponse = "Webhook responded with unexpected status"
+	ErrWebhookSink     = "Failed to serve test webhook sink"
+	OkWebhookSinkRx    = "Test webhook sink received notification"
+
+	ErrStreamFilter      = "Invalid stream filter"
+	ErrStreamUnsupported = "Streaming is not supported"
+
+	ErrExprSyntax = "Invalid expression"
+	ErrExprEval   = "Failed to evaluate expression"
+	ErrQueryParam = "Invalid query parameter"
+
+	ErrGrafanaRequest = "Invalid Grafana datasource request"
+
+	ErrRecordingRulesRead   = "Failed to read recording rules"
+	ErrRecordingRuleInvalid = "Invalid recording rule"
+	OkRecordingRulesLoaded  = "Recording rules loaded"
+
+	ErrStatsdParse    = "Invalid StatsD line"
+	ErrStatsdFlush    = "Failed to flush StatsD aggregate"
+	ErrStatsdListener = "StatsD listener stopped"
+	OkStatsdStarted   = "StatsD listener started"
+
+	ErrInfluxParse = "Invalid line protocol"
+	ErrInfluxRead  = "Failed to read line protocol body"
+
+	ErrGraphiteParse    = "Invalid Graphite line"
+	ErrGraphiteListener = "Graphite listener stopped"
+	OkGraphiteStarted   = "Graphite listener started"
+
+	ErrHistoryRange = "Invalid history range"
+
+	ErrRemoteWriteRead     = "Failed to read remote write body"
+	ErrRemoteWriteDecode   = "Invalid remote write request"
+	ErrRemoteWriteTooLarge = "Remote write request too large"
+
+	ErrOTLPRead        = "Failed to read OTLP body"
+	ErrOTLPDecode      = "Invalid OTLP request"
+	ErrOTLPContentType = "Unsupported OTLP content type"
+	ErrOTLPRejected    = "Rejected OTLP data points"
+	ErrOTLPTooLarge    = "OTLP request too large"
+
 	ErrServerInternalError = "Internal server error"
 	ErrServerNotStarted    = "Server can't be started"
 	OkServerStarted        = "Server started"
+	OkServerStopped        = "Server stopped"
 
 	ErrAgentResponseCode  = "Unexpected response code"
 	ErrAgentCreateRequest = "Error creating request"
 	ErrAgentSendRequest   = "Error sending request"
 	ErrAgentCloseRequest  = "Error closing response body"
+	ErrAgentRejected      = "Server rejected the request"
+	ErrAgentDropped       = "Dropping metric rejected by the server"
+
+	ErrSpoolRead  = "Failed to read spool"
+	ErrSpoolWrite = "Failed to write spool"
+	OkSpoolReplay = "Replayed spooled metrics"
+	OkSpoolAppend = "Spooled undelivered metrics"
+
+	ErrScrapeTarget = "Failed to scrape target"
+	ErrScrapeParse  = "Invalid Prometheus exposition"
 
 	ErrFlagUnknown      = "Unknown flags provided"
 	ErrFlagInvalidValue = "Invalid flag value"
+
+	ErrTLSKeyPairRequired = "Both TLS certificate and key must be provided"
+	ErrTLSLoadKeyPair     = "Failed to load TLS key pair"
+	ErrTLSLoadCA          = "Failed to load CA certificates"
+	ErrTLSConfig          = "Invalid TLS configuration"
 )
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"github.com/avointsev/yp7m-go/internal/hll"
+	"github.com/avointsev/yp7m-go/internal/sketch"
+)
+
+// Metrics is the JSON representation of a metric used by the update and value APIs.
+type Metrics struct {
+	Delta        *int64         `json:"delta,omitempty"`
+	Value        *float64       `json:"value,omitempty"`
+	Sum          *float64       `json:"sum,omitempty"`
+	Count        *uint64        `json:"count,omitempty"`
+	Sketch       *sketch.Sketch `json:"sketch,omitempty"`
+	HLL          *hll.HLL       `json:"hll,omitempty"`
+	ID           string         `json:"id"`
+	MType        string         `json:"type"`
+	Buckets      []Bucket       `json:"buckets,omitempty"`
+	Observations []float64      `json:"observations,omitempty"`
+	Members      []string       `json:"members,omitempty"`
+	UpdatedAt    *time.Time     `json:"updated_at,omitempty"`
+	Stale        bool           `json:"stale,omitempty"`
+}
+
+// Bucket is a cumulative histogram bucket: Count observations were less than or equal to UpperBound.
+type Bucket struct {
+	UpperBound float64 `json:"le"`
+	Count      uint64  `json:"count"`
+}
+
+// Headers carrying the agent identity on every report.
+const (
+	HeaderAgentID       = "X-Agent-ID"
+	HeaderAgentHostname = "X-Agent-Hostname"
+	HeaderAgentVersion  = "X-Agent-Version"
+	HeaderAgentStart    = "X-Agent-Start"
+)
+
+// Agent identifies a reporting agent process.
+type Agent struct {
+	ID        string    `json:"id"`
+	Hostname  string    `json:"hostname"`
+	Version   string    `json:"version"`
+	StartTime time.Time `json:"start_time"`
+}
@@ -0,0 +1,75 @@
+// Package protoutil walks protobuf messages field by field, for decoding the
+// few wire formats the server accepts without generated code.
+package protoutil
+
+import (
+	"errors"
+	"math"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// ErrMalformed is returned for data that is not a valid protobuf message.
+var ErrMalformed = errors.New("malformed protobuf message")
+
+// Walk calls fn for every field in data. For length-delimited fields value
+// holds the payload; for other types it holds the raw encoded value.
+func Walk(data []byte, fn func(num protowire.Number, typ protowire.Type, value []byte) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return ErrMalformed
+		}
+		data = data[n:]
+
+		var value []byte
+		if typ == protowire.BytesType {
+			v, m := protowire.ConsumeBytes(data)
+			if m < 0 {
+				return ErrMalformed
+			}
+			value, n = v, m
+		} else {
+			n = protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return ErrMalformed
+			}
+			value = data[:n]
+		}
+		if err := fn(num, typ, value); err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+// Varint decodes a raw varint value passed to a Walk callback.
+func Varint(value []byte) uint64 {
+	v, _ := protowire.ConsumeVarint(value)
+	return v
+}
+
+// Fixed64 decodes a raw fixed64 value passed to a Walk callback.
+func Fixed64(value []byte) uint64 {
+	v, _ := protowire.ConsumeFixed64(value)
+	return v
+}
+
+// Double decodes a raw double value passed to a Walk callback.
+func Double(value []byte) float64 {
+	return math.Float64frombits(Fixed64(value))
+}
+
+// PackedFixed64 decodes a packed repeated fixed64 or double field.
+func PackedFixed64(value []byte) ([]uint64, error) {
+	if len(value)%8 != 0 {
+		return nil, ErrMalformed
+	}
+	out := make([]uint64, 0, len(value)/8)
+	for len(value) > 0 {
+		out = append(out, Fixed64(value))
+		value = value[8:]
+	}
+	return out, nil
+}
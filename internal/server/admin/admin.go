@@ -0,0 +1,52 @@
+// Package admin restricts destructive endpoints to callers presenting the
+// configured admin token as a bearer token.
+package admin
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/avointsev/yp7m-go/internal/logger"
+)
+
+// Guard checks requests against the admin token. With no token configured
+// the guarded endpoints are disabled.
+type Guard struct {
+	token string
+	mu    sync.RWMutex
+}
+
+// New returns a guard for token.
+func New(token string) *Guard {
+	return &Guard{token: token}
+}
+
+// SetToken replaces the admin token, e.g. after a configuration reload.
+func (g *Guard) SetToken(token string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.token = token
+}
+
+// Middleware rejects requests without the admin token.
+func (g *Guard) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		g.mu.RLock()
+		token := g.token
+		g.mu.RUnlock()
+
+		if token == "" {
+			http.Error(w, logger.ErrAdminDisabled, http.StatusForbidden)
+			return
+		}
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, logger.ErrAdminUnauthorized, http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,43 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGuard(t *testing.T) {
+	g := New("")
+	handler := g.Middleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	send := func(authorization string) int {
+		req := httptest.NewRequest(http.MethodDelete, "/value/gauge/x", http.NoBody)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := send("Bearer anything"); code != http.StatusForbidden {
+		t.Errorf("expected status %v without a configured token; got %v", http.StatusForbidden, code)
+	}
+
+	g.SetToken("secret")
+	tests := []struct {
+		authorization string
+		want          int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"secret", http.StatusUnauthorized},
+		{"Bearer secret", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		if code := send(tt.authorization); code != tt.want {
+			t.Errorf("Authorization %q: expected status %v; got %v", tt.authorization, tt.want, code)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+// Package agents keeps track of the agents reporting to the server, based on
+// the identity headers sent with every agent request.
+package agents
+
+import (
+	"cmp"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/avointsev/yp7m-go/internal/models"
+)
+
+// Status tells how recently an agent has reported.
+type Status string
+
+const (
+	Online  Status = "online"
+	Stale   Status = "stale"
+	Offline Status = "offline"
+)
+
+// Entry is the registry record of one agent.
+type Entry struct {
+	models.Agent
+	RemoteAddr string    `json:"remote_addr"`
+	FirstSeen  time.Time `json:"first_seen"`
+	LastSeen   time.Time `json:"last_seen"`
+	Requests   int64     `json:"requests"`
+	Status     Status    `json:"status"`
+}
+
+// Registry records the last time every agent was seen. An agent is stale when
+// it has not reported for the stale threshold, offline after the offline one,
+// and removed from the registry after the forget one.
+type Registry struct {
+	agents  map[string]*Entry
+	stale   time.Duration
+	offline time.Duration
+	forget  time.Duration
+	now     func() time.Time
+	mu      sync.Mutex
+}
+
+// New creates an empty registry with the given thresholds.
+func New(stale, offline, forget time.Duration) *Registry {
+	return &Registry{
+		agents:  make(map[string]*Entry),
+		stale:   stale,
+		offline: offline,
+		forget:  forget,
+		now:     time.Now,
+	}
+}
+
+// SetThresholds changes the stale, offline and forget thresholds.
+func (r *Registry) SetThresholds(stale, offline, forget time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stale, r.offline, r.forget = stale, offline, forget
+}
+
+// Seen records a request from agent.
+func (r *Registry) Seen(agent models.Agent, remoteAddr string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	entry, ok := r.agents[agent.ID]
+	if !ok {
+		r.prune(now)
+		entry = &Entry{FirstSeen: now}
+		r.agents[agent.ID] = entry
+	}
+	entry.Agent = agent
+	entry.RemoteAddr = remoteAddr
+	entry.LastSeen = now
+	entry.Requests++
+}
+
+// List returns all known agents ordered by ID, with their current status.
+func (r *Registry) List() []Entry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	r.prune(now)
+	list := make([]Entry, 0, len(r.agents))
+	for _, entry := range r.agents {
+		e := *entry
+		switch silence := now.Sub(e.LastSeen); {
+		case silence >= r.offline:
+			e.Status = Offline
+		case silence >= r.stale:
+			e.Status = Stale
+		default:
+			e.Status = Online
+		}
+		list = append(list, e)
+	}
+	slices.SortFunc(list, func(a, b Entry) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return list
+}
+
+// prune removes the agents that have not been seen for the forget threshold.
+func (r *Registry) prune(now time.Time) {
+	for id, entry := range r.agents {
+		if now.Sub(entry.LastSeen) >= r.forget {
+			delete(r.agents, id)
+		}
+	}
+}
+
+// Middleware records requests that carry an agent ID header. It belongs on
+// the update routes only, and a request counts once it has been accepted, so
+// that arbitrary requests cannot register agents.
+func (r *Registry) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, req.ProtoMajor)
+		next.ServeHTTP(ww, req)
+
+		if status := ww.Status(); status != 0 && status != http.StatusOK {
+			return
+		}
+		if id := req.Header.Get(models.HeaderAgentID); id != "" {
+			start, _ := time.Parse(time.RFC3339, req.Header.Get(models.HeaderAgentStart))
+			r.Seen(models.Agent{
+				ID:        id,
+				Hostname:  req.Header.Get(models.HeaderAgentHostname),
+				Version:   req.Header.Get(models.HeaderAgentVersion),
+				StartTime: start,
+			}, req.RemoteAddr)
+		}
+	})
+}
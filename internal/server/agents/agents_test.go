@@ -0,0 +1,83 @@
+package agents
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/avointsev/yp7m-go/internal/models"
+)
+
+func TestRegistry(t *testing.T) {
+	r := New(time.Minute, 5*time.Minute, 2*time.Hour)
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return now }
+
+	handler := r.Middleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	send := func(id string) {
+		req := httptest.NewRequest(http.MethodPost, "/update/", http.NoBody)
+		if id != "" {
+			req.Header.Set(models.HeaderAgentID, id)
+			req.Header.Set(models.HeaderAgentHostname, id+".example.com")
+			req.Header.Set(models.HeaderAgentVersion, "1.2.3")
+			req.Header.Set(models.HeaderAgentStart, "2024-01-01T11:00:00Z")
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	send("web1")
+	send("db1")
+	send("")
+	now = now.Add(2 * time.Minute)
+	send("web1")
+	r.mu.Lock()
+	r.agents["cache1"] = &Entry{Agent: models.Agent{ID: "cache1"}, LastSeen: now.Add(-time.Hour)}
+	r.mu.Unlock()
+
+	list := r.List()
+	if len(list) != 3 {
+		t.Fatalf("expected 3 agents, got %+v", list)
+	}
+	want := map[string]Status{"cache1": Offline, "db1": Stale, "web1": Online}
+	for _, e := range list {
+		if e.Status != want[e.ID] {
+			t.Errorf("expected %s to be %s, got %s", e.ID, want[e.ID], e.Status)
+		}
+	}
+	web := list[2]
+	if web.ID != "web1" || web.Requests != 2 || web.Version != "1.2.3" || web.Hostname != "web1.example.com" ||
+		!web.StartTime.Equal(time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected entry %+v", web)
+	}
+
+	r.SetThresholds(time.Hour, 2*time.Hour, 3*time.Hour)
+	for _, e := range r.List() {
+		if e.ID == "db1" && e.Status != Online {
+			t.Errorf("expected db1 to be online after raising thresholds, got %s", e.Status)
+		}
+	}
+
+	now = now.Add(3 * time.Hour)
+	send("web1")
+	if list := r.List(); len(list) != 1 || list[0].ID != "web1" {
+		t.Errorf("expected agents silent beyond the forget threshold to be removed, got %+v", list)
+	}
+}
+
+func TestRegistryIgnoresRejectedRequests(t *testing.T) {
+	r := New(time.Minute, 5*time.Minute, time.Hour)
+	handler := r.Middleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/update/", http.NoBody)
+	req.Header.Set(models.HeaderAgentID, "intruder")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if list := r.List(); len(list) != 0 {
+		t.Errorf("expected rejected request not to register an agent, got %+v", list)
+	}
+}
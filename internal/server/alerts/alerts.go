@@ -0,0 +1,258 @@
+// Package alerts evaluates threshold rules against the metric storage and
+// tracks the state of every rule between evaluations.
+package alerts
+
+import (
+	"context"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/avointsev/yp7m-go/internal/server/storage"
+)
+
+const (
+	// DefaultInterval is how often rules are evaluated unless configured otherwise.
+	DefaultInterval = 15 * time.Second
+	// maxEvents caps the recorded state changes.
+	maxEvents = 1000
+)
+
+// State is the state of an alert.
+type State string
+
+const (
+	Inactive State = "inactive"
+	// Pending alerts have met their condition for less than the rule's for duration.
+	Pending  State = "pending"
+	Firing   State = "firing"
+	Resolved State = "resolved"
+)
+
+// Alert is the current state of one rule. Value is the last measured value,
+// nil when it is not finite, as JSON cannot carry NaN or infinities.
+type Alert struct {
+	Rule
+	State      State      `json:"state"`
+	Value      *float64   `json:"value"`
+	ActiveAt   *time.Time `json:"active_at,omitempty"`
+	FiredAt    *time.Time `json:"fired_at,omitempty"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+}
+
+// Event records an alert firing or resolving.
+type Event struct {
+	Name  string    `json:"name"`
+	Expr  string    `json:"expr"`
+	State State     `json:"state"`
+	Value *float64  `json:"value"`
+	Time  time.Time `json:"time"`
+}
+
+// Engine evaluates rules on an interval.
+type Engine struct {
+	store  storage.StorageType
+	alerts []*Alert
+	events []Event
+	notify func([]Alert)
+	now    func() time.Time
+	mu     sync.Mutex
+}
+
+// New creates an engine evaluating rules against store.
+func New(store storage.StorageType, rules []Rule) *Engine {
+	e := &Engine{store: store, now: time.Now}
+	e.SetRules(rules)
+	return e
+}
+
+// SetRules replaces the rules, keeping the state of rules whose name and
+// expression are unchanged.
+func (e *Engine) SetRules(rules []Rule) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	previous := make(map[string]*Alert, len(e.alerts))
+	for _, a := range e.alerts {
+		previous[a.Name] = a
+	}
+	alerts := make([]*Alert, 0, len(rules))
+	for _, rule := range rules {
+		if a, ok := previous[rule.Name]; ok && a.Rule == rule {
+			alerts = append(alerts, a)
+			continue
+		}
+		alerts = append(alerts, &Alert{Rule: rule, State: Inactive})
+	}
+	e.alerts = alerts
+}
+
+// OnEvaluate registers fn to receive the state of every rule after each evaluation.
+func (e *Engine) OnEvaluate(fn func([]Alert)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.notify = fn
+}
+
+// Alerts returns the state of every rule in file order.
+func (e *Engine) Alerts() []Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	list := make([]Alert, len(e.alerts))
+	for i, a := range e.alerts {
+		list[i] = *a
+	}
+	return list
+}
+
+// Events returns the recorded firing and resolved changes between from and to.
+func (e *Engine) Events(from, to time.Time) []Event {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var events []Event
+	for _, ev := range e.events {
+		if !ev.Time.Before(from) && !ev.Time.After(to) {
+			events = append(events, ev)
+		}
+	}
+	return events
+}
+
+// Evaluate checks every rule once and updates its state.
+func (e *Engine) Evaluate() {
+	e.mu.Lock()
+	now := e.now()
+	for _, a := range e.alerts {
+		value, active := e.condition(a.Rule, now)
+		a.Value = finite(value)
+		before := a.State
+		a.transition(active, now)
+		if a.State != before && (a.State == Firing || a.State == Resolved) {
+			e.events = append(e.events, Event{Name: a.Name, Expr: a.Expr, State: a.State, Value: a.Value, Time: now})
+		}
+	}
+	if len(e.events) > maxEvents {
+		e.events = slices.Clone(e.events[len(e.events)-maxEvents:])
+	}
+	notify := e.notify
+	e.mu.Unlock()
+
+	if notify != nil {
+		notify(e.Alerts())
+	}
+}
+
+// Run evaluates the rules every interval until ctx is cancelled.
+func (e *Engine) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			e.Evaluate()
+		}
+	}
+}
+
+func (a *Alert) transition(active bool, now time.Time) {
+	if !active {
+		switch a.State {
+		case Firing:
+			a.State = Resolved
+			a.ResolvedAt = &now
+		case Pending:
+			a.State = Inactive
+		}
+		a.ActiveAt = nil
+		return
+	}
+
+	if a.ActiveAt == nil {
+		a.ActiveAt = &now
+		a.FiredAt, a.ResolvedAt = nil, nil
+	}
+	if a.State == Firing {
+		return
+	}
+	if now.Sub(*a.ActiveAt) >= a.For {
+		a.State = Firing
+		a.FiredAt = &now
+		return
+	}
+	a.State = Pending
+}
+
+// condition returns the measured value and whether the rule's condition holds.
+func (e *Engine) condition(rule Rule, now time.Time) (float64, bool) {
+	switch rule.Kind {
+	case Value:
+		value, ok := e.value(rule.MetricType, rule.Metric)
+		return value, ok && rule.compare(value)
+	case Rate:
+		value, ok := e.rate(rule.Metric, rule.Window, now)
+		return value, ok && rule.compare(value)
+	case Absent:
+		f, err := e.store.Freshness(rule.MetricType, rule.Metric)
+		if err != nil {
+			return 0, true
+		}
+		silence := now.Sub(f.Updated)
+		return silence.Seconds(), silence >= rule.Window
+	}
+	return 0, false
+}
+
+func (e *Engine) value(metricType, name string) (float64, bool) {
+	v, err := e.store.GetMetric(metricType, name)
+	if err != nil {
+		return 0, false
+	}
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// rate returns the per-second increase of a counter over window, treating a
+// decrease as a reset. The last sample before the window is the baseline;
+// without one, the first sample in the window is, since a counter restored
+// from file has no earlier history. A window without samples has no rate.
+func (e *Engine) rate(name string, window time.Duration, now time.Time) (float64, bool) {
+	samples, err := e.store.History(storage.Counter, name, time.Time{}, now)
+	if err != nil {
+		return 0, false
+	}
+	start := now.Add(-window)
+	var baseline *float64
+	increase := 0.0
+	inWindow := false
+	for _, s := range samples {
+		inWindow = inWindow || s.Time.After(start)
+		switch {
+		case baseline == nil || !s.Time.After(start):
+		case s.Value >= *baseline:
+			increase += s.Value - *baseline
+		default:
+			increase += s.Value
+		}
+		baseline = &s.Value
+	}
+	return increase / window.Seconds(), inWindow
+}
+
+// finite returns a pointer to v, or nil when v is NaN or infinite.
+func finite(v float64) *float64 {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil
+	}
+	return &v
+}
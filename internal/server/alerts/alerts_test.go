@@ -0,0 +1,153 @@
+package alerts
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/avointsev/yp7m-go/internal/server/storage"
+)
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    Rule
+		wantErr bool
+	}{
+		{
+			line: "HighHeap: gauge HeapAlloc > 1e9 for 5m",
+			want: Rule{Name: "HighHeap", Expr: "gauge HeapAlloc > 1e9 for 5m", Kind: Value,
+				MetricType: storage.Gauge, Metric: "HeapAlloc", Op: ">", Threshold: 1e9, For: 5 * time.Minute},
+		},
+		{
+			line: "SlowPolls: rate PollCount[1m] < 0.5",
+			want: Rule{Name: "SlowPolls", Expr: "rate PollCount[1m] < 0.5", Kind: Rate,
+				MetricType: storage.Counter, Metric: "PollCount", Window: time.Minute, Op: "<", Threshold: 0.5},
+		},
+		{
+			line: `NoData: absent gauge cpu{host="web1"}[30s] for 1m`,
+			want: Rule{Name: "NoData", Expr: `absent gauge cpu{host="web1"}[30s] for 1m`, Kind: Absent,
+				MetricType: storage.Gauge, Metric: `cpu{host="web1"}`, Window: 30 * time.Second, For: time.Minute},
+		},
+		{line: "gauge HeapAlloc > 1", wantErr: true},
+		{line: "x: histogram h > 1", wantErr: true},
+		{line: "x: gauge HeapAlloc => 1", wantErr: true},
+		{line: "x: gauge HeapAlloc > many", wantErr: true},
+		{line: "x: rate PollCount > 1", wantErr: true},
+		{line: "x: absent gauge HeapAlloc[0s]", wantErr: true},
+		{line: "x: gauge HeapAlloc > 1 for soon", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRule(tt.line)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidRule) {
+				t.Errorf("ParseRule(%q): expected ErrInvalidRule, got %v", tt.line, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseRule(%q) = %+v, %v; want %+v", tt.line, got, err, tt.want)
+		}
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules")
+	content := "# heap\nHighHeap: gauge HeapAlloc > 1e9\n\nHighHeap: gauge Other > 1\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("could not write rules: %v", err)
+	}
+	if _, err := LoadRules(path); !errors.Is(err, ErrInvalidRule) {
+		t.Errorf("expected duplicate name error, got %v", err)
+	}
+}
+
+func TestEngine(t *testing.T) {
+	store := storage.NewMemStorage()
+	rules := []Rule{
+		mustParse(t, "HighHeap: gauge HeapAlloc > 100 for 1m"),
+		mustParse(t, "FastPolls: rate PollCount[1m] > 1"),
+		mustParse(t, "NoData: absent gauge Missing[1m]"),
+	}
+	engine := New(store, rules)
+	now := time.Now()
+	engine.now = func() time.Time { return now }
+
+	store.UpdateGauge("HeapAlloc", 200)
+	store.UpdateCounter("PollCount", 1)
+	engine.Evaluate()
+	assertStates(t, engine, Pending, Inactive, Firing)
+
+	now = now.Add(time.Minute)
+	store.UpdateCounter("PollCount", 120)
+	engine.Evaluate()
+	assertStates(t, engine, Firing, Firing, Firing)
+	if rate := engine.Alerts()[1].Value; rate == nil || *rate != 2 {
+		t.Errorf("expected rate 2/s, got %v", rate)
+	}
+
+	store.UpdateGauge("HeapAlloc", 50)
+	store.UpdateGauge("Missing", 1)
+	engine.Evaluate()
+	assertStates(t, engine, Resolved, Firing, Resolved)
+	if a := engine.Alerts()[0]; a.ResolvedAt == nil || a.FiredAt == nil || a.ActiveAt != nil {
+		t.Errorf("unexpected resolved alert %+v", a)
+	}
+
+	events := engine.Events(now.Add(-time.Hour), now)
+	if len(events) != 5 || events[0].Name != "NoData" || events[4].State != Resolved {
+		t.Errorf("unexpected events %+v", events)
+	}
+
+	engine.SetRules(rules[:1])
+	if a := engine.Alerts(); len(a) != 1 || a[0].State != Resolved {
+		t.Errorf("expected unchanged rule to keep its state, got %+v", a)
+	}
+}
+
+func TestEngineMissingAndNonFiniteData(t *testing.T) {
+	store := storage.NewMemStorage()
+	rules := []Rule{
+		mustParse(t, "SlowPolls: rate PollCount[1m] < 1"),
+		mustParse(t, "Odd: gauge Ratio < 1"),
+	}
+	engine := New(store, rules)
+	now := time.Now()
+	engine.now = func() time.Time { return now }
+
+	store.UpdateCounter("PollCount", 1)
+	store.UpdateGauge("Ratio", math.Inf(-1))
+	now = now.Add(2 * time.Minute)
+	engine.Evaluate()
+	assertStates(t, engine, Inactive, Firing)
+
+	list := engine.Alerts()
+	if list[1].Value != nil {
+		t.Errorf("expected no value for an infinite measurement, got %v", *list[1].Value)
+	}
+	if _, err := json.Marshal(list); err != nil {
+		t.Errorf("expected alerts to encode, got %v", err)
+	}
+}
+
+func mustParse(t *testing.T, line string) Rule {
+	t.Helper()
+	rule, err := ParseRule(line)
+	if err != nil {
+		t.Fatalf("ParseRule(%q): %v", line, err)
+	}
+	return rule
+}
+
+func assertStates(t *testing.T, engine *Engine, want ...State) {
+	t.Helper()
+	for i, a := range engine.Alerts() {
+		if a.State != want[i] {
+			t.Errorf("alert %s: expected %s, got %s (value %v)", a.Name, want[i], a.State, a.Value)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package alerts
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/avointsev/yp7m-go/internal/logger"
+	"github.com/avointsev/yp7m-go/internal/server/storage"
+)
+
+// Kind is what a rule measures.
+type Kind string
+
+const (
+	// Value compares the current value of a gauge or counter.
+	Value Kind = "value"
+	// Rate compares the per-second increase of a counter over a window.
+	Rate Kind = "rate"
+	// Absent fires when a metric is missing or has not been updated for a window.
+	Absent Kind = "absent"
+)
+
+// Rule is one alerting rule. Rules are written one per line as
+//
+//	name: gauge HeapAlloc > 1e9 for 5m
+//	name: rate PollCount[1m] < 0.5 for 2m
+//	name: absent gauge HeapAlloc[5m]
+//
+// where the "for" clause is optional and operators are >, >=, <, <=, == and !=.
+type Rule struct {
+	Name       string        `json:"name"`
+	Expr       string        `json:"expr"`
+	Kind       Kind          `json:"-"`
+	MetricType string        `json:"-"`
+	Metric     string        `json:"-"`
+	Window     time.Duration `json:"-"`
+	Op         string        `json:"-"`
+	Threshold  float64       `json:"-"`
+	For        time.Duration `json:"for"`
+}
+
+// ErrInvalidRule is returned for rules that cannot be parsed.
+var ErrInvalidRule = errors.New(logger.ErrAlertRuleInvalid)
+
+// LoadRules reads rules from path, skipping blank lines and # comments.
+func LoadRules(path string) ([]Rule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rules []Rule
+	names := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule, err := ParseRule(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		if names[rule.Name] {
+			return nil, fmt.Errorf("%s:%d: %w: duplicate name %q", path, n, ErrInvalidRule, rule.Name)
+		}
+		names[rule.Name] = true
+		rules = append(rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return rules, nil
+}
+
+// ParseRule parses a single rule line.
+func ParseRule(line string) (Rule, error) {
+	name, expr, ok := strings.Cut(line, ":")
+	name, expr = strings.TrimSpace(name), strings.TrimSpace(expr)
+	if !ok || name == "" || expr == "" {
+		return Rule{}, fmt.Errorf("%w: expected name: expression", ErrInvalidRule)
+	}
+	rule := Rule{Name: name, Expr: expr}
+
+	fields := strings.Fields(expr)
+	if n := len(fields); n >= 2 && fields[n-2] == "for" {
+		d, err := time.ParseDuration(fields[n-1])
+		if err != nil || d < 0 {
+			return Rule{}, fmt.Errorf("%w: invalid for duration %q", ErrInvalidRule, fields[n-1])
+		}
+		rule.For = d
+		fields = fields[:n-2]
+	}
+	if len(fields) == 0 {
+		return Rule{}, fmt.Errorf("%w: empty expression", ErrInvalidRule)
+	}
+
+	var err error
+	switch fields[0] {
+	case storage.Gauge, storage.Counter:
+		if len(fields) != 4 {
+			return Rule{}, fmt.Errorf("%w: expected %s <metric> <op> <threshold>", ErrInvalidRule, fields[0])
+		}
+		rule.Kind, rule.MetricType, rule.Metric = Value, fields[0], fields[1]
+		err = rule.parseComparison(fields[2], fields[3])
+	case string(Rate):
+		if len(fields) != 4 {
+			return Rule{}, fmt.Errorf("%w: expected rate <counter>[<window>] <op> <threshold>", ErrInvalidRule)
+		}
+		rule.Kind, rule.MetricType = Rate, storage.Counter
+		if rule.Metric, rule.Window, err = parseWindow(fields[1]); err != nil {
+			return Rule{}, err
+		}
+		err = rule.parseComparison(fields[2], fields[3])
+	case string(Absent):
+		if len(fields) != 3 || (fields[1] != storage.Gauge && fields[1] != storage.Counter) {
+			return Rule{}, fmt.Errorf("%w: expected absent gauge|counter <metric>[<window>]", ErrInvalidRule)
+		}
+		rule.Kind, rule.MetricType = Absent, fields[1]
+		rule.Metric, rule.Window, err = parseWindow(fields[2])
+	default:
+		return Rule{}, fmt.Errorf("%w: unknown rule type %q", ErrInvalidRule, fields[0])
+	}
+	if err != nil {
+		return Rule{}, err
+	}
+	return rule, nil
+}
+
+func (r *Rule) parseComparison(op, threshold string) error {
+	switch op {
+	case ">", ">=", "<", "<=", "==", "!=":
+		r.Op = op
+	default:
+		return fmt.Errorf("%w: unknown operator %q", ErrInvalidRule, op)
+	}
+	value, err := strconv.ParseFloat(threshold, 64)
+	if err != nil {
+		return fmt.Errorf("%w: invalid threshold %q", ErrInvalidRule, threshold)
+	}
+	r.Threshold = value
+	return nil
+}
+
+// parseWindow splits metric[window] into the metric name and window.
+func parseWindow(field string) (string, time.Duration, error) {
+	i := strings.LastIndexByte(field, '[')
+	if i <= 0 || !strings.HasSuffix(field, "]") {
+		return "", 0, fmt.Errorf("%w: expected <metric>[<window>], got %q", ErrInvalidRule, field)
+	}
+	window, err := time.ParseDuration(field[i+1 : len(field)-1])
+	if err != nil || window <= 0 {
+		return "", 0, fmt.Errorf("%w: invalid window in %q", ErrInvalidRule, field)
+	}
+	return field[:i], window, nil
+}
+
+// compare reports whether value satisfies the rule's comparison.
+func (r Rule) compare(value float64) bool {
+	switch r.Op {
+	case ">":
+		return value > r.Threshold
+	case ">=":
+		return value >= r.Threshold
+	case "<":
+		return value < r.Threshold
+	case "<=":
+		return value <= r.Threshold
+	case "==":
+		return value == r.Threshold
+	case "!=":
+		return value != r.Threshold
+	}
+	return false
+}
@@ -0,0 +1,421 @@
+package expr
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/avointsev/yp7m-go/internal/labels"
+	"github.com/avointsev/yp7m-go/internal/logger"
+	"github.com/avointsev/yp7m-go/internal/server/storage"
+)
+
+// ErrEval is returned for expressions that parse but cannot be evaluated.
+var ErrEval = errors.New(logger.ErrExprEval)
+
+// Sample is one element of a vector. Name is cleared by operations that
+// change the meaning of the value, such as arithmetic and aggregation.
+type Sample struct {
+	Name   string
+	Labels labels.Labels
+	Value  float64
+}
+
+// Series returns the series key of the sample.
+func (s Sample) Series() string {
+	return labels.Series(s.Name, s.Labels)
+}
+
+// Result is the value of an expression: a scalar or a vector.
+type Result struct {
+	Scalar   float64
+	Vector   []Sample
+	IsScalar bool
+}
+
+// maxTime bounds history reads that should include every sample.
+var maxTime = time.Unix(1<<62, 0)
+
+// seriesRef is a stored gauge or counter.
+type seriesRef struct {
+	metricType string
+	key        string
+	name       string
+	labels     labels.Labels
+}
+
+// Evaluator evaluates expressions against the gauges and counters in a
+// storage, reading past values from their history.
+type Evaluator struct {
+	store  storage.StorageType
+	series []seriesRef
+	// samples caches the history of every series read by the evaluator, by type and key.
+	samples map[[2]string][]storage.Sample
+}
+
+// NewEvaluator snapshots the series in store. An evaluator is meant for one
+// query, possibly evaluated at many times; create a new one to see new series.
+func NewEvaluator(store storage.StorageType) *Evaluator {
+	e := &Evaluator{store: store, samples: make(map[[2]string][]storage.Sample)}
+	for key, value := range store.GetAllMetrics() {
+		var metricType string
+		switch value.(type) {
+		case float64:
+			metricType = storage.Gauge
+		case int64:
+			metricType = storage.Counter
+		default:
+			continue
+		}
+		name, l, err := labels.Parse(key)
+		if err != nil {
+			continue
+		}
+		e.series = append(e.series, seriesRef{metricType: metricType, key: key, name: name, labels: l})
+	}
+	return e
+}
+
+// Eval evaluates n at time at.
+func (e *Evaluator) Eval(n Node, at time.Time) (Result, error) {
+	switch n := n.(type) {
+	case NumberLiteral:
+		return Result{Scalar: n.Value, IsScalar: true}, nil
+	case Selector:
+		if n.Range > 0 {
+			return Result{}, fmt.Errorf("%w: range selector %s must be passed to a function", ErrEval, n.Name)
+		}
+		return Result{Vector: e.instant(n, at)}, nil
+	case Binary:
+		return e.binary(n, at)
+	case Call:
+		return e.call(n, at)
+	case Aggregate:
+		return e.aggregate(n, at)
+	}
+	return Result{}, fmt.Errorf("%w: unknown node %T", ErrEval, n)
+}
+
+// selected returns the series matching sel.
+func (e *Evaluator) selected(sel Selector) []seriesRef {
+	var refs []seriesRef
+	for _, ref := range e.series {
+		if ref.name != sel.Name {
+			continue
+		}
+		matched := true
+		for _, m := range sel.Matchers {
+			if !m.Matches(ref.labels[m.Label]) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
+
+func (e *Evaluator) history(ref seriesRef) []storage.Sample {
+	id := [2]string{ref.metricType, ref.key}
+	samples, ok := e.samples[id]
+	if !ok {
+		samples, _ = e.store.History(ref.metricType, ref.key, time.Time{}, maxTime)
+		e.samples[id] = samples
+	}
+	return samples
+}
+
+// valueAt returns the last recorded value at or before at. A series without
+// history, such as one restored from file, holds its current value since its
+// last update.
+func (e *Evaluator) valueAt(ref seriesRef, at time.Time) (float64, bool) {
+	samples := e.history(ref)
+	i := sort.Search(len(samples), func(i int) bool { return samples[i].Time.After(at) })
+	if i > 0 {
+		return samples[i-1].Value, true
+	}
+	if len(samples) > 0 {
+		return 0, false
+	}
+	f, err := e.store.Freshness(ref.metricType, ref.key)
+	if err != nil || f.Updated.After(at) {
+		return 0, false
+	}
+	v, err := e.store.GetMetric(ref.metricType, ref.key)
+	if err != nil {
+		return 0, false
+	}
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+func (e *Evaluator) instant(sel Selector, at time.Time) []Sample {
+	var vector []Sample
+	for _, ref := range e.selected(sel) {
+		if value, ok := e.valueAt(ref, at); ok {
+			vector = append(vector, Sample{Name: ref.name, Labels: ref.labels, Value: value})
+		}
+	}
+	return vector
+}
+
+// window returns the samples in (at-r, at] and the last sample before them.
+func (e *Evaluator) window(ref seriesRef, at time.Time, r time.Duration) ([]storage.Sample, *storage.Sample) {
+	samples := e.history(ref)
+	start := sort.Search(len(samples), func(i int) bool { return samples[i].Time.After(at.Add(-r)) })
+	end := sort.Search(len(samples), func(i int) bool { return samples[i].Time.After(at) })
+	var baseline *storage.Sample
+	if start > 0 {
+		baseline = &samples[start-1]
+	}
+	return samples[start:end], baseline
+}
+
+func (e *Evaluator) call(c Call, at time.Time) (Result, error) {
+	if c.Func == "abs" {
+		arg, err := e.Eval(c.Args[0], at)
+		if err != nil {
+			return Result{}, err
+		}
+		return apply(arg, math.Abs), nil
+	}
+
+	sel, ok := c.Args[0].(Selector)
+	if !ok {
+		return Result{}, fmt.Errorf("%w: %s expects a range selector", ErrEval, c.Func)
+	}
+	var vector []Sample
+	for _, ref := range e.selected(sel) {
+		samples, baseline := e.window(ref, at, sel.Range)
+		value, ok := overTime(c.Func, samples, baseline, sel.Range)
+		if ok {
+			vector = append(vector, Sample{Labels: ref.labels, Value: value})
+		}
+	}
+	return Result{Vector: vector}, nil
+}
+
+// overTime applies a range function to the samples of one series.
+func overTime(fn string, samples []storage.Sample, baseline *storage.Sample, r time.Duration) (float64, bool) {
+	switch fn {
+	case "rate", "increase":
+		// Without a sample before the window the first one in it is the
+		// baseline, since a counter restored from file has no earlier history.
+		if baseline == nil {
+			if len(samples) == 0 {
+				return 0, false
+			}
+			baseline, samples = &samples[0], samples[1:]
+		}
+		increase, last := 0.0, baseline.Value
+		for _, s := range samples {
+			if s.Value >= last {
+				increase += s.Value - last
+			} else {
+				increase += s.Value
+			}
+			last = s.Value
+		}
+		if fn == "rate" {
+			return increase / r.Seconds(), true
+		}
+		return increase, true
+	}
+
+	if len(samples) == 0 {
+		return 0, false
+	}
+	result := samples[0].Value
+	sum := 0.0
+	for _, s := range samples {
+		sum += s.Value
+		switch fn {
+		case "min_over_time":
+			result = math.Min(result, s.Value)
+		case "max_over_time":
+			result = math.Max(result, s.Value)
+		}
+	}
+	if fn == "avg_over_time" {
+		return sum / float64(len(samples)), true
+	}
+	return result, true
+}
+
+func apply(r Result, fn func(float64) float64) Result {
+	if r.IsScalar {
+		return Result{Scalar: fn(r.Scalar), IsScalar: true}
+	}
+	vector := make([]Sample, len(r.Vector))
+	for i, s := range r.Vector {
+		vector[i] = Sample{Labels: s.Labels, Value: fn(s.Value)}
+	}
+	return Result{Vector: vector}
+}
+
+func isComparison(op string) bool {
+	switch op {
+	case "==", "!=", ">", "<", ">=", "<=":
+		return true
+	}
+	return false
+}
+
+// operate applies op; comparisons return 1 for true and 0 for false.
+func operate(op string, l, r float64) float64 {
+	b := func(v bool) float64 {
+		if v {
+			return 1
+		}
+		return 0
+	}
+	switch op {
+	case "+":
+		return l + r
+	case "-":
+		return l - r
+	case "*":
+		return l * r
+	case "/":
+		return l / r
+	case "%":
+		return math.Mod(l, r)
+	case "==":
+		return b(l == r)
+	case "!=":
+		return b(l != r)
+	case ">":
+		return b(l > r)
+	case "<":
+		return b(l < r)
+	case ">=":
+		return b(l >= r)
+	case "<=":
+		return b(l <= r)
+	}
+	return math.NaN()
+}
+
+// binary applies an operator. Vectors are matched on identical labels; a
+// comparison involving a vector keeps the samples for which it holds.
+func (e *Evaluator) binary(b Binary, at time.Time) (Result, error) {
+	lhs, err := e.Eval(b.LHS, at)
+	if err != nil {
+		return Result{}, err
+	}
+	rhs, err := e.Eval(b.RHS, at)
+	if err != nil {
+		return Result{}, err
+	}
+	if lhs.IsScalar && rhs.IsScalar {
+		return Result{Scalar: operate(b.Op, lhs.Scalar, rhs.Scalar), IsScalar: true}, nil
+	}
+
+	combine := func(s Sample, l, r float64) (Sample, bool) {
+		if isComparison(b.Op) {
+			return s, operate(b.Op, l, r) == 1
+		}
+		return Sample{Labels: s.Labels, Value: operate(b.Op, l, r)}, true
+	}
+
+	var vector []Sample
+	switch {
+	case rhs.IsScalar:
+		for _, s := range lhs.Vector {
+			if out, ok := combine(s, s.Value, rhs.Scalar); ok {
+				vector = append(vector, out)
+			}
+		}
+	case lhs.IsScalar:
+		for _, s := range rhs.Vector {
+			if out, ok := combine(s, lhs.Scalar, s.Value); ok {
+				vector = append(vector, out)
+			}
+		}
+	default:
+		right := make(map[string]Sample, len(rhs.Vector))
+		for _, s := range rhs.Vector {
+			right[labels.Series("", s.Labels)] = s
+		}
+		for _, s := range lhs.Vector {
+			r, ok := right[labels.Series("", s.Labels)]
+			if !ok {
+				continue
+			}
+			if out, ok := combine(s, s.Value, r.Value); ok {
+				vector = append(vector, out)
+			}
+		}
+	}
+	return Result{Vector: vector}, nil
+}
+
+func (e *Evaluator) aggregate(a Aggregate, at time.Time) (Result, error) {
+	inner, err := e.Eval(a.Expr, at)
+	if err != nil {
+		return Result{}, err
+	}
+	if inner.IsScalar {
+		return Result{}, fmt.Errorf("%w: %s expects a vector", ErrEval, a.Op)
+	}
+
+	type group struct {
+		labels labels.Labels
+		values []float64
+	}
+	groups := make(map[string]*group)
+	var order []string
+	for _, s := range inner.Vector {
+		l := make(labels.Labels, len(a.By))
+		for _, key := range a.By {
+			if v, ok := s.Labels[key]; ok {
+				l[key] = v
+			}
+		}
+		key := labels.Series("", l)
+		g, ok := groups[key]
+		if !ok {
+			g = &group{labels: l}
+			groups[key] = g
+			order = append(order, key)
+		}
+		g.values = append(g.values, s.Value)
+	}
+
+	slices.Sort(order)
+	vector := make([]Sample, 0, len(order))
+	for _, key := range order {
+		g := groups[key]
+		value := g.values[0]
+		sum := 0.0
+		for _, v := range g.values {
+			sum += v
+			switch a.Op {
+			case "min":
+				value = math.Min(value, v)
+			case "max":
+				value = math.Max(value, v)
+			}
+		}
+		switch a.Op {
+		case "sum":
+			value = sum
+		case "avg":
+			value = sum / float64(len(g.values))
+		case "count":
+			value = float64(len(g.values))
+		}
+		vector = append(vector, Sample{Labels: g.labels, Value: value})
+	}
+	return Result{Vector: vector}, nil
+}
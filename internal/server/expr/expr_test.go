@@ -0,0 +1,115 @@
+package expr
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/avointsev/yp7m-go/internal/server/storage"
+)
+
+func TestParseErrors(t *testing.T) {
+	for _, input := range []string{
+		"",
+		"HeapInuse /",
+		"(HeapInuse",
+		`cpu{host="web1"`,
+		`cpu{host~"web1"}`,
+		`cpu{host=~"("}`,
+		"rate(requests)",
+		"abs(requests[5m])",
+		"requests[soon]",
+		"sum by (host (cpu)",
+		"HeapInuse $ 2",
+	} {
+		if _, err := Parse(input); !errors.Is(err, ErrSyntax) {
+			t.Errorf("Parse(%q): expected ErrSyntax, got %v", input, err)
+		}
+	}
+}
+
+func eval(t *testing.T, store storage.StorageType, input string, at time.Time) Result {
+	t.Helper()
+	n, err := Parse(input)
+	if err != nil {
+		t.Fatalf("Parse(%q): %v", input, err)
+	}
+	result, err := NewEvaluator(store).Eval(n, at)
+	if err != nil {
+		t.Fatalf("Eval(%q): %v", input, err)
+	}
+	return result
+}
+
+func TestEval(t *testing.T) {
+	store := storage.NewMemStorage()
+	store.UpdateGauge("HeapInuse", 30)
+	store.UpdateGauge("HeapSys", 120)
+	store.UpdateGauge(`cpu{host="web1",dc="eu"}`, 0.5)
+	store.UpdateGauge(`cpu{host="web2",dc="eu"}`, 0.25)
+	store.UpdateGauge(`cpu{host="db1",dc="us"}`, 1)
+	store.UpdateCounter(`requests{host="web1"}`, 10)
+	store.UpdateCounter(`requests{host="web2"}`, 5)
+	now := time.Now()
+
+	if r := eval(t, store, "HeapInuse / HeapSys * 100", now); len(r.Vector) != 1 || r.Vector[0].Value != 25 {
+		t.Errorf("expected 25%% heap utilization, got %+v", r)
+	}
+	if r := eval(t, store, "-2 * (1 + 2) >= -6", now); !r.IsScalar || r.Scalar != 1 {
+		t.Errorf("expected scalar 1, got %+v", r)
+	}
+	if r := eval(t, store, "sum(requests)", now); len(r.Vector) != 1 || r.Vector[0].Value != 15 {
+		t.Errorf("expected sum 15, got %+v", r)
+	}
+
+	r := eval(t, store, "avg by (dc) (cpu)", now)
+	if len(r.Vector) != 2 || r.Vector[0].Series() != `{dc="eu"}` || r.Vector[0].Value != 0.375 || r.Vector[1].Value != 1 {
+		t.Errorf("unexpected grouped average %+v", r)
+	}
+	r = eval(t, store, `cpu{host=~"web.*"} > 0.3`, now)
+	if len(r.Vector) != 1 || r.Vector[0].Series() != `cpu{dc="eu",host="web1"}` {
+		t.Errorf("expected filtered vector, got %+v", r)
+	}
+	if r := eval(t, store, `count(cpu{dc!="eu"})`, now); len(r.Vector) != 1 || r.Vector[0].Value != 1 {
+		t.Errorf("expected count 1, got %+v", r)
+	}
+	r = eval(t, store, `cpu / on_missing`, now)
+	if len(r.Vector) != 0 {
+		t.Errorf("expected no matches against a missing metric, got %+v", r)
+	}
+
+	if _, err := NewEvaluator(store).Eval(Selector{Name: "cpu", Range: time.Minute}, now); !errors.Is(err, ErrEval) {
+		t.Errorf("expected ErrEval for bare range selector, got %v", err)
+	}
+}
+
+func TestEvalOverTime(t *testing.T) {
+	store := storage.NewMemStorage()
+	now := time.Now()
+	for i, v := range []float64{4, 8, 6} {
+		store.UpdateGaugeAt("temp", v, now.Add(time.Duration(i-2)*time.Minute))
+	}
+	store.UpdateCounter("hits", 10)
+	store.UpdateCounter("hits", 50)
+	store.UpdateCounter("hits", 30)
+
+	if r := eval(t, store, "temp", now.Add(-90*time.Second)); len(r.Vector) != 1 || r.Vector[0].Value != 4 {
+		t.Errorf("expected value 4 at -90s, got %+v", r)
+	}
+	if r := eval(t, store, "temp", now.Add(-3*time.Minute)); len(r.Vector) != 0 {
+		t.Errorf("expected no value before the first sample, got %+v", r)
+	}
+	if r := eval(t, store, "avg_over_time(temp[3m])", now); len(r.Vector) != 1 || r.Vector[0].Value != 6 {
+		t.Errorf("expected average 6, got %+v", r)
+	}
+	if r := eval(t, store, "max_over_time(temp[90s])", now); len(r.Vector) != 1 || r.Vector[0].Value != 8 {
+		t.Errorf("expected max 8, got %+v", r)
+	}
+	if r := eval(t, store, "increase(hits[1m])", time.Now()); len(r.Vector) != 1 || r.Vector[0].Value != 80 {
+		t.Errorf("expected increase of 80 from the first sample, got %+v", r)
+	}
+	if r := eval(t, store, "rate(hits[1m])", time.Now()); len(r.Vector) != 1 || math.Abs(r.Vector[0].Value-80.0/60) > 1e-9 {
+		t.Errorf("expected rate 80/60, got %+v", r)
+	}
+}
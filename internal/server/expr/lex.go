@@ -0,0 +1,127 @@
+package expr
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokDuration
+	tokOp
+	tokLParen
+	tokRParen
+	tokLBrace
+	tokRBrace
+	tokComma
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// operators lists operator tokens, longest first so that ">=" wins over ">".
+var operators = []string{"==", "!=", "=~", "!~", ">=", "<=", "+", "-", "*", "/", "%", ">", "<", "="}
+
+func isIdentStart(r rune) bool {
+	return r == '_' || r == ':' || unicode.IsLetter(r)
+}
+
+func isIdent(r rune) bool {
+	return isIdentStart(r) || r == '.' || unicode.IsDigit(r)
+}
+
+// lex splits input into tokens. A bracketed range such as [5m] becomes a
+// single duration token.
+func lex(input string) ([]token, error) {
+	var tokens []token
+	runes := []rune(input)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{tokLParen, "(", i})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{tokRParen, ")", i})
+			i++
+		case r == '{':
+			tokens = append(tokens, token{tokLBrace, "{", i})
+			i++
+		case r == '}':
+			tokens = append(tokens, token{tokRBrace, "}", i})
+			i++
+		case r == ',':
+			tokens = append(tokens, token{tokComma, ",", i})
+			i++
+		case r == '[':
+			end := i + 1
+			for end < len(runes) && runes[end] != ']' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, fmt.Errorf("%w: unclosed range at %d", ErrSyntax, i)
+			}
+			tokens = append(tokens, token{tokDuration, strings.TrimSpace(string(runes[i+1 : end])), i})
+			i = end + 1
+		case r == '"':
+			var b strings.Builder
+			end := i + 1
+			for ; end < len(runes) && runes[end] != '"'; end++ {
+				if runes[end] == '\\' && end+1 < len(runes) {
+					end++
+					if runes[end] == 'n' {
+						b.WriteRune('\n')
+						continue
+					}
+				}
+				b.WriteRune(runes[end])
+			}
+			if end == len(runes) {
+				return nil, fmt.Errorf("%w: unclosed string at %d", ErrSyntax, i)
+			}
+			tokens = append(tokens, token{tokString, b.String(), i})
+			i = end + 1
+		case unicode.IsDigit(r) || (r == '.' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			end := i
+			for end < len(runes) && (unicode.IsDigit(runes[end]) || runes[end] == '.' ||
+				runes[end] == 'e' || runes[end] == 'E' ||
+				((runes[end] == '+' || runes[end] == '-') && (runes[end-1] == 'e' || runes[end-1] == 'E'))) {
+				end++
+			}
+			tokens = append(tokens, token{tokNumber, string(runes[i:end]), i})
+			i = end
+		case isIdentStart(r):
+			end := i
+			for end < len(runes) && isIdent(runes[end]) {
+				end++
+			}
+			tokens = append(tokens, token{tokIdent, string(runes[i:end]), i})
+			i = end
+		default:
+			matched := false
+			for _, op := range operators {
+				if strings.HasPrefix(string(runes[i:]), op) {
+					tokens = append(tokens, token{tokOp, op, i})
+					i += len([]rune(op))
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("%w: unexpected %q at %d", ErrSyntax, r, i)
+			}
+		}
+	}
+	return append(tokens, token{tokEOF, "", len(runes)}), nil
+}
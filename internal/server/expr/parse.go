@@ -0,0 +1,325 @@
+package expr
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/avointsev/yp7m-go/internal/logger"
+)
+
+// ErrSyntax is returned for expressions that cannot be parsed.
+var ErrSyntax = errors.New(logger.ErrExprSyntax)
+
+// Node is a parsed expression.
+type Node interface {
+	node()
+}
+
+// NumberLiteral is a constant.
+type NumberLiteral struct {
+	Value float64
+}
+
+// Matcher compares a label against a value: = and != test equality,
+// =~ and !~ match an anchored regular expression.
+type Matcher struct {
+	Label string
+	Op    string
+	Value string
+	re    *regexp.Regexp
+}
+
+// Matches reports whether value satisfies the matcher.
+func (m Matcher) Matches(value string) bool {
+	switch m.Op {
+	case "=":
+		return value == m.Value
+	case "!=":
+		return value != m.Value
+	case "=~":
+		return m.re.MatchString(value)
+	case "!~":
+		return !m.re.MatchString(value)
+	}
+	return false
+}
+
+// Selector selects the gauges and counters named Name whose labels satisfy
+// every matcher. A non-zero Range makes it a range selector.
+type Selector struct {
+	Name     string
+	Matchers []Matcher
+	Range    time.Duration
+}
+
+// Binary applies an arithmetic or comparison operator.
+type Binary struct {
+	Op       string
+	LHS, RHS Node
+}
+
+// Call applies a function to its arguments.
+type Call struct {
+	Func string
+	Args []Node
+}
+
+// Aggregate combines the samples of a vector, grouped by the By labels.
+type Aggregate struct {
+	Op   string
+	By   []string
+	Expr Node
+}
+
+func (NumberLiteral) node() {}
+func (Selector) node()      {}
+func (Binary) node()        {}
+func (Call) node()          {}
+func (Aggregate) node()     {}
+
+var aggregates = []string{"sum", "avg", "min", "max", "count"}
+
+// functions maps function names to whether their argument is a range selector.
+var functions = map[string]bool{
+	"rate":          true,
+	"increase":      true,
+	"avg_over_time": true,
+	"min_over_time": true,
+	"max_over_time": true,
+	"abs":           false,
+}
+
+// precedence of binary operators; higher binds tighter.
+var precedence = map[string]int{
+	"==": 1, "!=": 1, ">": 1, "<": 1, ">=": 1, "<=": 1,
+	"+": 2, "-": 2,
+	"*": 3, "/": 3, "%": 3,
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+// Parse parses an expression such as
+//
+//	HeapInuse / HeapSys
+//	sum by (host) (rate(requests{code=~"5.."}[5m]))
+func Parse(input string) (Node, error) {
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	n, err := p.expr(1)
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.errorf(t, "unexpected %q", t.text)
+	}
+	return n, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) expect(kind tokenKind, what string) (token, error) {
+	t := p.next()
+	if t.kind != kind {
+		return t, p.errorf(t, "expected %s, got %q", what, t.text)
+	}
+	return t, nil
+}
+
+func (p *parser) errorf(t token, format string, args ...any) error {
+	return fmt.Errorf("%w at %d: %s", ErrSyntax, t.pos, fmt.Sprintf(format, args...))
+}
+
+// expr parses binary operations whose precedence is at least minPrec.
+func (p *parser) expr(minPrec int) (Node, error) {
+	lhs, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		prec, ok := precedence[t.text]
+		if t.kind != tokOp || !ok || prec < minPrec {
+			return lhs, nil
+		}
+		p.next()
+		rhs, err := p.expr(prec + 1)
+		if err != nil {
+			return nil, err
+		}
+		lhs = Binary{Op: t.text, LHS: lhs, RHS: rhs}
+	}
+}
+
+func (p *parser) unary() (Node, error) {
+	if t := p.peek(); t.kind == tokOp && (t.text == "-" || t.text == "+") {
+		p.next()
+		n, err := p.unary()
+		if err != nil || t.text == "+" {
+			return n, err
+		}
+		if lit, ok := n.(NumberLiteral); ok {
+			return NumberLiteral{Value: -lit.Value}, nil
+		}
+		return Binary{Op: "*", LHS: NumberLiteral{Value: -1}, RHS: n}, nil
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (Node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		value, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, p.errorf(t, "invalid number %q", t.text)
+		}
+		return NumberLiteral{Value: value}, nil
+	case tokLParen:
+		n, err := p.expr(1)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokRParen, ")"); err != nil {
+			return nil, err
+		}
+		return n, nil
+	case tokIdent:
+		if slices.Contains(aggregates, t.text) {
+			if next := p.peek(); next.kind == tokLParen || next.text == "by" {
+				return p.aggregate(t.text)
+			}
+		}
+		if _, ok := functions[t.text]; ok && p.peek().kind == tokLParen {
+			return p.call(t)
+		}
+		return p.selector(t.text)
+	}
+	return nil, p.errorf(t, "unexpected %q", t.text)
+}
+
+func (p *parser) aggregate(op string) (Node, error) {
+	agg := Aggregate{Op: op}
+	var err error
+	if p.peek().text == "by" {
+		if agg.By, err = p.labelList(); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := p.expect(tokLParen, "("); err != nil {
+		return nil, err
+	}
+	if agg.Expr, err = p.expr(1); err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(tokRParen, ")"); err != nil {
+		return nil, err
+	}
+	if agg.By == nil && p.peek().text == "by" {
+		if agg.By, err = p.labelList(); err != nil {
+			return nil, err
+		}
+	}
+	return agg, nil
+}
+
+// labelList parses by (label, ...).
+func (p *parser) labelList() ([]string, error) {
+	p.next()
+	if _, err := p.expect(tokLParen, "("); err != nil {
+		return nil, err
+	}
+	by := []string{}
+	for p.peek().kind != tokRParen {
+		t, err := p.expect(tokIdent, "label name")
+		if err != nil {
+			return nil, err
+		}
+		by = append(by, t.text)
+		if p.peek().kind == tokComma {
+			p.next()
+		}
+	}
+	p.next()
+	return by, nil
+}
+
+func (p *parser) call(name token) (Node, error) {
+	p.next()
+	arg, err := p.expr(1)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(tokRParen, ")"); err != nil {
+		return nil, err
+	}
+	sel, isRange := arg.(Selector)
+	isRange = isRange && sel.Range > 0
+	if functions[name.text] != isRange {
+		if isRange {
+			return nil, p.errorf(name, "%s does not take a range", name.text)
+		}
+		return nil, p.errorf(name, "%s expects a range selector", name.text)
+	}
+	return Call{Func: name.text, Args: []Node{arg}}, nil
+}
+
+func (p *parser) selector(name string) (Node, error) {
+	sel := Selector{Name: name}
+	if p.peek().kind == tokLBrace {
+		p.next()
+		for p.peek().kind != tokRBrace {
+			label, err := p.expect(tokIdent, "label name")
+			if err != nil {
+				return nil, err
+			}
+			op := p.next()
+			if op.kind != tokOp || !slices.Contains([]string{"=", "!=", "=~", "!~"}, op.text) {
+				return nil, p.errorf(op, "expected label matcher, got %q", op.text)
+			}
+			value, err := p.expect(tokString, "quoted label value")
+			if err != nil {
+				return nil, err
+			}
+			m := Matcher{Label: label.text, Op: op.text, Value: value.text}
+			if op.text == "=~" || op.text == "!~" {
+				if m.re, err = regexp.Compile("^(?:" + value.text + ")$"); err != nil {
+					return nil, p.errorf(value, "invalid regular expression: %v", err)
+				}
+			}
+			sel.Matchers = append(sel.Matchers, m)
+			if p.peek().kind == tokComma {
+				p.next()
+			}
+		}
+		p.next()
+	}
+	if t := p.peek(); t.kind == tokDuration {
+		p.next()
+		d, err := time.ParseDuration(t.text)
+		if err != nil || d <= 0 {
+			return nil, p.errorf(t, "invalid range %q", t.text)
+		}
+		sel.Range = d
+	}
+	return sel, nil
+}
@@ -0,0 +1,316 @@
+// Package grafana implements the API of Grafana's JSON (simple JSON)
+// datasource. Query targets are expressions, so a plain metric name charts
+// that metric and anything /query accepts works as well; annotations come
+// from alert state changes.
+package grafana
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/avointsev/yp7m-go/internal/labels"
+	"github.com/avointsev/yp7m-go/internal/logger"
+	"github.com/avointsev/yp7m-go/internal/server/alerts"
+	"github.com/avointsev/yp7m-go/internal/server/expr"
+	"github.com/avointsev/yp7m-go/internal/server/storage"
+)
+
+const (
+	// defaultMaxPoints is used when a query does not set maxDataPoints.
+	defaultMaxPoints = 1000
+	// maxPoints caps the points evaluated per query.
+	maxPoints = 11000
+)
+
+// Router returns the datasource endpoints, to be mounted under a prefix.
+func Router(store storage.StorageType, engine *alerts.Engine) http.Handler {
+	r := chi.NewRouter()
+	r.Get("/", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	r.Post("/search", SearchHandler(store))
+	r.Post("/metrics", SearchHandler(store))
+	r.Post("/query", QueryHandler(store))
+	r.Post("/annotations", AnnotationsHandler(engine))
+	return r
+}
+
+// timeRange is the dashboard time range of a request.
+type timeRange struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+type searchRequest struct {
+	Target string `json:"target"`
+}
+
+// SearchHandler lists the metric names containing the requested target.
+func SearchHandler(store storage.StorageType) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req searchRequest
+		// An empty body searches for everything.
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			http.Error(w, logger.ErrGrafanaRequest, http.StatusBadRequest)
+			return
+		}
+
+		seen := make(map[string]bool)
+		names := []string{}
+		for series := range store.GetAllMetrics() {
+			name := labels.Name(series)
+			if !seen[name] && strings.Contains(name, req.Target) {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+		slices.Sort(names)
+		writeJSON(w, names)
+	}
+}
+
+type queryRequest struct {
+	Range         timeRange `json:"range"`
+	IntervalMs    int64     `json:"intervalMs"`
+	MaxDataPoints int       `json:"maxDataPoints"`
+	Targets       []struct {
+		Target string `json:"target"`
+		RefID  string `json:"refId"`
+		Type   string `json:"type"`
+		Hide   bool   `json:"hide"`
+	} `json:"targets"`
+}
+
+// timeSeries is a [value, unix milliseconds] series.
+type timeSeries struct {
+	Target     string      `json:"target"`
+	Datapoints [][2]number `json:"datapoints"`
+}
+
+// number is a value encoded as null when it is NaN or infinite, which JSON
+// cannot carry; Grafana shows such points as gaps.
+type number float64
+
+func (n number) MarshalJSON() ([]byte, error) {
+	f := float64(n)
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return []byte("null"), nil
+	}
+	return json.Marshal(f)
+}
+
+type tableColumn struct {
+	Text string `json:"text"`
+	Type string `json:"type"`
+}
+
+type table struct {
+	Type    string          `json:"type"`
+	Columns []tableColumn   `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+}
+
+// QueryHandler evaluates every target over the requested range. Targets of
+// type "table" return the values at the end of the range instead.
+func QueryHandler(store storage.StorageType) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req queryRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Range.From.After(req.Range.To) {
+			http.Error(w, logger.ErrGrafanaRequest, http.StatusBadRequest)
+			return
+		}
+		step := queryStep(req)
+
+		evaluator := expr.NewEvaluator(store)
+		response := []interface{}{}
+		for _, target := range req.Targets {
+			if target.Hide || target.Target == "" {
+				continue
+			}
+			node, err := expr.Parse(target.Target)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("%s: %v", target.RefID, err), http.StatusBadRequest)
+				return
+			}
+			if target.Type == "table" {
+				t, err := evalTable(evaluator, node, req.Range.To)
+				if err != nil {
+					http.Error(w, fmt.Sprintf("%s: %v", target.RefID, err), http.StatusBadRequest)
+					return
+				}
+				response = append(response, t)
+				continue
+			}
+			series, err := evalSeries(evaluator, node, target.Target, req.Range, step)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("%s: %v", target.RefID, err), http.StatusBadRequest)
+				return
+			}
+			for _, s := range series {
+				response = append(response, s)
+			}
+		}
+		writeJSON(w, response)
+	}
+}
+
+// queryStep spreads at most maxDataPoints points over the range, and no
+// closer than intervalMs.
+func queryStep(req queryRequest) time.Duration {
+	points := req.MaxDataPoints
+	if points <= 0 {
+		points = defaultMaxPoints
+	}
+	points = min(points, maxPoints)
+	step := req.Range.To.Sub(req.Range.From) / time.Duration(points)
+	step = max(step, time.Duration(req.IntervalMs)*time.Millisecond, time.Second)
+	return step
+}
+
+func evalSeries(e *expr.Evaluator, node expr.Node, target string, tr timeRange, step time.Duration) ([]*timeSeries, error) {
+	series := make(map[string]*timeSeries)
+	var order []string
+	for at := tr.From; !at.After(tr.To); at = at.Add(step) {
+		result, err := e.Eval(node, at)
+		if err != nil {
+			return nil, err
+		}
+		if result.IsScalar {
+			result.Vector = []expr.Sample{{Value: result.Scalar}}
+		}
+		for _, s := range result.Vector {
+			key := s.Series()
+			ts, ok := series[key]
+			if !ok {
+				name := key
+				if name == "" || name == "{}" {
+					name = target
+				}
+				ts = &timeSeries{Target: name, Datapoints: [][2]number{}}
+				series[key] = ts
+				order = append(order, key)
+			}
+			ts.Datapoints = append(ts.Datapoints, [2]number{number(s.Value), number(at.UnixMilli())})
+		}
+	}
+	slices.Sort(order)
+	list := make([]*timeSeries, 0, len(order))
+	for _, key := range order {
+		list = append(list, series[key])
+	}
+	return list, nil
+}
+
+// evalTable returns one row per series, with a column per label.
+func evalTable(e *expr.Evaluator, node expr.Node, at time.Time) (table, error) {
+	result, err := e.Eval(node, at)
+	if err != nil {
+		return table{}, err
+	}
+	if result.IsScalar {
+		result.Vector = []expr.Sample{{Value: result.Scalar}}
+	}
+	slices.SortFunc(result.Vector, func(a, b expr.Sample) int {
+		return cmp.Compare(a.Series(), b.Series())
+	})
+
+	var keys []string
+	for _, s := range result.Vector {
+		for k := range s.Labels {
+			if !slices.Contains(keys, k) {
+				keys = append(keys, k)
+			}
+		}
+	}
+	slices.Sort(keys)
+
+	t := table{Type: "table", Columns: []tableColumn{{Text: "Time", Type: "time"}, {Text: "Metric", Type: "string"}}}
+	for _, k := range keys {
+		t.Columns = append(t.Columns, tableColumn{Text: k, Type: "string"})
+	}
+	t.Columns = append(t.Columns, tableColumn{Text: "Value", Type: "number"})
+	t.Rows = [][]interface{}{}
+	for _, s := range result.Vector {
+		row := []interface{}{at.UnixMilli(), s.Name}
+		for _, k := range keys {
+			row = append(row, s.Labels[k])
+		}
+		t.Rows = append(t.Rows, append(row, number(s.Value)))
+	}
+	return t, nil
+}
+
+type annotationRequest struct {
+	Range      timeRange `json:"range"`
+	Annotation struct {
+		Name  string `json:"name"`
+		Query string `json:"query"`
+	} `json:"annotation"`
+}
+
+type annotation struct {
+	Annotation interface{} `json:"annotation"`
+	Time       int64       `json:"time"`
+	Title      string      `json:"title"`
+	Text       string      `json:"text"`
+	Tags       []string    `json:"tags"`
+}
+
+// AnnotationsHandler returns the alerts that fired or resolved in the range.
+// A non-empty annotation query keeps only alerts whose name contains it.
+func AnnotationsHandler(engine *alerts.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req annotationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, logger.ErrGrafanaRequest, http.StatusBadRequest)
+			return
+		}
+
+		list := []annotation{}
+		for _, ev := range engine.Events(req.Range.From, req.Range.To) {
+			if !strings.Contains(ev.Name, req.Annotation.Query) {
+				continue
+			}
+			list = append(list, annotation{
+				Annotation: req.Annotation,
+				Time:       ev.Time.UnixMilli(),
+				Title:      fmt.Sprintf("%s %s", ev.Name, ev.State),
+				Text:       eventText(ev),
+				Tags:       []string{"alert", string(ev.State)},
+			})
+		}
+		writeJSON(w, list)
+	}
+}
+
+// eventText describes the expression of an alert event and its value, if finite.
+func eventText(ev alerts.Event) string {
+	if ev.Value == nil {
+		return ev.Expr
+	}
+	return fmt.Sprintf("%s (value %g)", ev.Expr, *ev.Value)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, logger.ErrWriteResponce, http.StatusInternalServerError)
+		log.Printf(logger.LogDefaultFormat, logger.ErrWriteResponce, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(append(data, '\n')); err != nil {
+		log.Printf(logger.LogDefaultFormat, logger.ErrWriteResponce, err)
+	}
+}
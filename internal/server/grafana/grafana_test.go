@@ -0,0 +1,113 @@
+package grafana
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/avointsev/yp7m-go/internal/server/alerts"
+	"github.com/avointsev/yp7m-go/internal/server/storage"
+)
+
+func post(t *testing.T, h http.Handler, target, body string) (int, string) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec.Code, rec.Body.String()
+}
+
+func rangeJSON(from, to time.Time) string {
+	return fmt.Sprintf(`{"from":%q,"to":%q}`, from.Format(time.RFC3339), to.Format(time.RFC3339))
+}
+
+func TestRouter(t *testing.T) {
+	store := storage.NewMemStorage()
+	now := time.Now().Truncate(time.Second)
+	store.UpdateGaugeAt(`cpu{host="web1"}`, 0.5, now.Add(-2*time.Minute))
+	store.UpdateGaugeAt(`cpu{host="web2"}`, 0.25, now.Add(-2*time.Minute))
+	store.UpdateGauge("HeapAlloc", 2e9)
+	store.UpdateCounter("PollCount", 1)
+
+	rule, err := alerts.ParseRule("HighHeap: gauge HeapAlloc > 1e9")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	engine := alerts.New(store, []alerts.Rule{rule})
+	engine.Evaluate()
+	h := Router(store, engine)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", http.NoBody))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected status %v for the connection test; got %v", http.StatusOK, rec.Code)
+	}
+
+	if code, body := post(t, h, "/search", `{"target":"p"}`); code != http.StatusOK || strings.TrimSpace(body) != `["HeapAlloc","cpu"]` {
+		t.Errorf("unexpected search response %v %s", code, body)
+	}
+	if code, body := post(t, h, "/search", ""); code != http.StatusOK || strings.Count(body, ",") != 2 {
+		t.Errorf("expected all three names for an empty search, got %v %s", code, body)
+	}
+
+	body := fmt.Sprintf(`{"range":%s,"maxDataPoints":3,"targets":[
+		{"refId":"A","target":"cpu"},
+		{"refId":"B","target":"sum(cpu)"},
+		{"refId":"C","target":"cpu","hide":true}]}`, rangeJSON(now.Add(-3*time.Minute), now))
+	code, resp := post(t, h, "/query", body)
+	if code != http.StatusOK {
+		t.Fatalf("expected status %v; got %v (%s)", http.StatusOK, code, resp)
+	}
+	var series []timeSeries
+	if err := json.Unmarshal([]byte(resp), &series); err != nil {
+		t.Fatalf("could not decode response: %v", err)
+	}
+	if len(series) != 3 || series[0].Target != `cpu{host="web1"}` || series[2].Target != "sum(cpu)" {
+		t.Fatalf("unexpected series %+v", series)
+	}
+	if points := series[2].Datapoints; len(points) != 3 || points[2][0] != 0.75 || points[2][1] != number(now.UnixMilli()) {
+		t.Errorf("unexpected sum datapoints %v", points)
+	}
+
+	body = fmt.Sprintf(`{"range":%s,"targets":[{"refId":"A","target":"cpu","type":"table"}]}`,
+		rangeJSON(now.Add(-time.Minute), now))
+	if code, resp := post(t, h, "/query", body); code != http.StatusOK ||
+		!strings.Contains(resp, `{"text":"host","type":"string"}`) || !strings.Contains(resp, `"cpu","web2",0.25]`) {
+		t.Errorf("unexpected table response %v %s", code, resp)
+	}
+
+	body = fmt.Sprintf(`{"range":%s,"targets":[{"refId":"A","target":"cpu +"}]}`, rangeJSON(now, now))
+	if code, _ := post(t, h, "/query", body); code != http.StatusBadRequest {
+		t.Errorf("expected status %v for an invalid target; got %v", http.StatusBadRequest, code)
+	}
+
+	body = fmt.Sprintf(`{"range":%s,"annotation":{"name":"alerts","query":"Heap"}}`,
+		rangeJSON(now.Add(-time.Minute), now.Add(time.Minute)))
+	code, resp = post(t, h, "/annotations", body)
+	if code != http.StatusOK || !strings.Contains(resp, `"title":"HighHeap firing"`) {
+		t.Errorf("unexpected annotations %v %s", code, resp)
+	}
+}
+
+func TestQueryNonFiniteValues(t *testing.T) {
+	store := storage.NewMemStorage()
+	now := time.Now().Truncate(time.Second)
+	store.UpdateGaugeAt("a", 1, now.Add(-time.Minute))
+	store.UpdateGaugeAt("b", 0, now.Add(-time.Minute))
+	h := Router(store, alerts.New(store, nil))
+
+	body := fmt.Sprintf(`{"range":%s,"maxDataPoints":1,"targets":[
+		{"refId":"A","target":"a / b"},
+		{"refId":"B","target":"a / b","type":"table"}]}`, rangeJSON(now, now))
+	code, resp := post(t, h, "/query", body)
+	if code != http.StatusOK {
+		t.Fatalf("expected status %v; got %v (%s)", http.StatusOK, code, resp)
+	}
+	if !strings.Contains(resp, `"datapoints":[[null,`) || !strings.Contains(resp, `,null]]`) {
+		t.Errorf("expected infinite values as null, got %s", resp)
+	}
+}
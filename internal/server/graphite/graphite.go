@@ -0,0 +1,141 @@
+// Package graphite ingests metrics sent with the Graphite plaintext protocol.
+package graphite
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/avointsev/yp7m-go/internal/labels"
+	"github.com/avointsev/yp7m-go/internal/logger"
+	"github.com/avointsev/yp7m-go/internal/server/storage"
+)
+
+var errInvalidLine = errors.New("invalid graphite line")
+
+// ParseLine parses "path value timestamp". A missing or negative timestamp
+// means now. Tagged paths ("path;tag=value") are mapped to labels.
+func ParseLine(line string, now time.Time) (string, float64, time.Time, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || len(fields) > 3 {
+		return "", 0, time.Time{}, errInvalidLine
+	}
+
+	value, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return "", 0, time.Time{}, errInvalidLine
+	}
+
+	ts := now
+	if len(fields) == 3 {
+		seconds, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			return "", 0, time.Time{}, errInvalidLine
+		}
+		if seconds >= 0 {
+			ts = time.Unix(0, int64(seconds*float64(time.Second)))
+		}
+	}
+
+	parts := strings.Split(fields[0], ";")
+	if parts[0] == "" {
+		return "", 0, time.Time{}, errInvalidLine
+	}
+	tags := make(labels.Labels, len(parts)-1)
+	for _, tag := range parts[1:] {
+		key, val, ok := strings.Cut(tag, "=")
+		if !ok || key == "" {
+			return "", 0, time.Time{}, errInvalidLine
+		}
+		tags[key] = val
+	}
+	return labels.Series(parts[0], tags), value, ts, nil
+}
+
+// Server stores Graphite plaintext lines received over TCP as gauges.
+type Server struct {
+	store storage.StorageType
+	conns map[net.Conn]struct{}
+	mu    sync.Mutex
+	wg    sync.WaitGroup
+}
+
+// New creates a Graphite server writing into store.
+func New(store storage.StorageType) *Server {
+	return &Server{
+		store: store,
+		conns: make(map[net.Conn]struct{}),
+	}
+}
+
+// ListenAndServe accepts connections on addr until ctx is cancelled.
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("%s: %w", logger.ErrGraphiteListener, err)
+	}
+	return s.Serve(ctx, listener)
+}
+
+// Serve accepts connections from listener until ctx is cancelled and waits
+// for open connections to finish.
+func (s *Server) Serve(ctx context.Context, listener net.Listener) error {
+	go func() {
+		<-ctx.Done()
+		_ = listener.Close()
+		s.mu.Lock()
+		for conn := range s.conns {
+			_ = conn.Close()
+		}
+		s.mu.Unlock()
+	}()
+
+	defer s.wg.Wait()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return fmt.Errorf("%s: %w", logger.ErrGraphiteListener, err)
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		_ = conn.Close()
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		series, value, ts, err := ParseLine(line, time.Now())
+		if err != nil {
+			log.Printf("%s: %q", logger.ErrGraphiteParse, line)
+			continue
+		}
+		s.store.UpdateGaugeAt(series, value, ts)
+	}
+}
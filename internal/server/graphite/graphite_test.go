@@ -0,0 +1,76 @@
+package graphite
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/avointsev/yp7m-go/internal/server/storage"
+)
+
+func TestParseLine(t *testing.T) {
+	now := time.Unix(1700000100, 0)
+
+	series, value, ts, err := ParseLine("servers.web1.load 1.5 1700000000", now)
+	if err != nil || series != "servers.web1.load" || value != 1.5 || !ts.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("unexpected result %s %v %v %v", series, value, ts, err)
+	}
+
+	series, _, ts, err = ParseLine("disk.used;host=web1;dc=eu 42 -1", now)
+	if err != nil || series != `disk.used{dc="eu",host="web1"}` || !ts.Equal(now) {
+		t.Errorf("unexpected tagged result %s %v %v", series, ts, err)
+	}
+
+	for _, line := range []string{"only.path", "path notanumber 1", "path 1 2 3", ";tag=a 1"} {
+		if _, _, _, err := ParseLine(line, now); err == nil {
+			t.Errorf("expected error for %q", line)
+		}
+	}
+}
+
+func TestServe(t *testing.T) {
+	store := storage.NewMemStorage()
+	s := New(store)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Serve(ctx, listener)
+	}()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	ts := time.Now().Add(-time.Minute).Truncate(time.Second)
+	if _, err := conn.Write([]byte("cron.backup.duration 93 " + strconv.FormatInt(ts.Unix(), 10) + "\n")); err != nil {
+		t.Fatalf("could not write: %v", err)
+	}
+	if err := conn.Close(); err != nil {
+		t.Fatalf("could not close: %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := store.GetMetric(storage.Gauge, "cron.backup.duration"); err == nil {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("unexpected serve error: %v", err)
+	}
+
+	samples, err := store.History(storage.Gauge, "cron.backup.duration", ts.Add(-time.Second), ts.Add(time.Second))
+	if err != nil || len(samples) != 1 || !samples[0].Time.Equal(ts) || samples[0].Value != 93 {
+		t.Errorf("expected sample at the sent timestamp, got %v %v", samples, err)
+	}
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+
+	"github.com/avointsev/yp7m-go/internal/logger"
+	"github.com/avointsev/yp7m-go/internal/server/agents"
+)
+
+var agentsPage = template.Must(template.New("agents").Parse(`
+			<html>
+				<body>
+					<h2>Agents</h2>
+					<table>
+						<tr><th>ID</th><th>Hostname</th><th>Version</th><th>Started</th><th>Last seen</th><th>Status</th></tr>
+						{{range .}}
+							<tr>
+								<td>{{.ID}}</td>
+								<td>{{.Hostname}}</td>
+								<td>{{.Version}}</td>
+								<td>{{.StartTime.Format "2006-01-02 15:04:05"}}</td>
+								<td>{{.LastSeen.Format "2006-01-02 15:04:05"}}</td>
+								<td>{{.Status}}</td>
+							</tr>
+						{{end}}
+					</table>
+				</body>
+			</html>
+		`))
+
+// AgentsHandler lists the known agents and their status as JSON.
+func AgentsHandler(registry *agents.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(registry.List()); err != nil {
+			log.Printf(logger.LogDefaultFormat, logger.ErrWriteResponce, err)
+		}
+	}
+}
+
+// AgentsPageHandler renders the known agents and their status as HTML.
+func AgentsPageHandler(registry *agents.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if err := agentsPage.Execute(w, registry.List()); err != nil {
+			http.Error(w, logger.ErrHTMLTemplateExecute, http.StatusInternalServerError)
+			log.Printf("%s: %v", logger.ErrHTMLTemplateExecute, err)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+
+	"github.com/avointsev/yp7m-go/internal/logger"
+	"github.com/avointsev/yp7m-go/internal/server/alerts"
+)
+
+var alertsPage = template.Must(template.New("alerts").Parse(`
+			<html>
+				<body>
+					<h2>Alerts</h2>
+					<table>
+						<tr><th>Name</th><th>Rule</th><th>State</th><th>Value</th><th>Since</th></tr>
+						{{range .}}
+							<tr>
+								<td>{{.Name}}</td>
+								<td>{{.Expr}}</td>
+								<td>{{.State}}</td>
+								<td>{{with .Value}}{{.}}{{end}}</td>
+								<td>{{with .ActiveAt}}{{.Format "2006-01-02 15:04:05"}}{{else}}{{with .ResolvedAt}}{{.Format "2006-01-02 15:04:05"}}{{end}}{{end}}</td>
+							</tr>
+						{{end}}
+					</table>
+				</body>
+			</html>
+		`))
+
+// AlertsHandler lists every alerting rule and its current state as JSON.
+func AlertsHandler(engine *alerts.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(engine.Alerts()); err != nil {
+			log.Printf(logger.LogDefaultFormat, logger.ErrWriteResponce, err)
+		}
+	}
+}
+
+// AlertsPageHandler renders every alerting rule and its current state as HTML.
+func AlertsPageHandler(engine *alerts.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if err := alertsPage.Execute(w, engine.Alerts()); err != nil {
+			http.Error(w, logger.ErrHTMLTemplateExecute, http.StatusInternalServerError)
+			log.Printf("%s: %v", logger.ErrHTMLTemplateExecute, err)
+		}
+	}
+}
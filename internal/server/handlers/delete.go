@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/avointsev/yp7m-go/internal/labels"
+	"github.com/avointsev/yp7m-go/internal/logger"
+	"github.com/avointsev/yp7m-go/internal/server/storage"
+)
+
+// DeleteMetricHandler removes a single metric and its history.
+func DeleteMetricHandler(store storage.StorageType) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		metricType := chi.URLParam(r, "type")
+		metricName := chi.URLParam(r, "name")
+
+		if err := store.Delete(metricType, metricName); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		writeText(w, "Metric "+metricName+" "+logger.OkMetricDeleted)
+	}
+}
+
+// ResetCounterHandler sets a counter back to zero.
+func ResetCounterHandler(store storage.StorageType) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		metricName := chi.URLParam(r, "name")
+
+		if err := store.ResetCounter(metricName); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		writeText(w, "Counter "+metricName+" "+logger.OkCounterReset)
+	}
+}
+
+// DeleteMatchingHandler removes every metric matching the prefix parameter and
+// all label parameters, given as key=value, and reports how many were removed.
+func DeleteMatchingHandler(store storage.StorageType) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		prefix := query.Get("prefix")
+		selector := make(labels.Labels)
+		for _, pair := range query["label"] {
+			key, value, ok := strings.Cut(pair, "=")
+			if !ok || key == "" {
+				http.Error(w, logger.ErrDeleteSelector, http.StatusBadRequest)
+				return
+			}
+			selector[key] = value
+		}
+		if prefix == "" && len(selector) == 0 {
+			http.Error(w, logger.ErrDeleteSelector, http.StatusBadRequest)
+			return
+		}
+
+		deleted := store.DeleteMatching(prefix, selector)
+		log.Printf("%d metrics %s", deleted, logger.OkMetricDeleted)
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(map[string]int{"deleted": deleted}); err != nil {
+			log.Printf(logger.LogDefaultFormat, logger.ErrWriteResponce, err)
+		}
+	}
+}
+
+func writeText(w http.ResponseWriter, message string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if _, err := w.Write([]byte(message)); err != nil {
+		log.Printf(logger.LogDefaultFormat, logger.ErrWriteResponce, err)
+		return
+	}
+	log.Println(message)
+}
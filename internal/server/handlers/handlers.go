@@ -1,19 +1,28 @@
 package handlers
 
 import (
+	"cmp"
 	"html/template"
 	"log"
+	"math"
 	"net/http"
+	"slices"
 	"strconv"
+	"time"
 
+	"github.com/avointsev/yp7m-go/internal/hll"
 	"github.com/avointsev/yp7m-go/internal/logger"
 	"github.com/avointsev/yp7m-go/internal/server/storage"
+	"github.com/avointsev/yp7m-go/internal/sketch"
 	"github.com/go-chi/chi/v5"
 )
 
 const (
-	Gauge   = "gauge"
-	Counter = "counter"
+	Gauge     = "gauge"
+	Counter   = "counter"
+	Histogram = "histogram"
+	Summary   = "summary"
+	Set       = "set"
 )
 
 func UpdateMetricHandler(store storage.StorageType) http.HandlerFunc {
@@ -27,6 +36,11 @@ func UpdateMetricHandler(store storage.StorageType) http.HandlerFunc {
 			log.Printf("%s: not pointed metric value", logger.ErrMetricNotFound)
 			return
 		}
+		if reserved(store, metricName) {
+			http.Error(w, logger.ErrMetricReserved, http.StatusBadRequest)
+			log.Printf(logger.LogDefaultFormat, logger.ErrMetricReserved, metricName)
+			return
+		}
 
 		var responseMessage string
 
@@ -119,6 +133,39 @@ func GetMetricHandler(store storage.StorageType) http.HandlerFunc {
 				log.Printf("%s for metric %s: %v", logger.ErrWriteResponce, metricName, err)
 				return
 			}
+		case Histogram:
+			histogram, ok := value.(storage.Histogram)
+			if !ok {
+				http.Error(w, logger.ErrMetricInvalidType, http.StatusInternalServerError)
+				log.Printf("%s: expected histogram but got %T", logger.ErrMetricInvalidType, value)
+				return
+			}
+			if _, err = w.Write([]byte(histogram.String())); err != nil {
+				log.Printf("%s for metric %s: %v", logger.ErrWriteResponce, metricName, err)
+				return
+			}
+		case Summary:
+			summary, ok := value.(*sketch.Sketch)
+			if !ok {
+				http.Error(w, logger.ErrMetricInvalidType, http.StatusInternalServerError)
+				log.Printf("%s: expected sketch but got %T", logger.ErrMetricInvalidType, value)
+				return
+			}
+			if _, err = w.Write([]byte(summary.String())); err != nil {
+				log.Printf("%s for metric %s: %v", logger.ErrWriteResponce, metricName, err)
+				return
+			}
+		case Set:
+			set, ok := value.(*hll.HLL)
+			if !ok {
+				http.Error(w, logger.ErrMetricInvalidType, http.StatusInternalServerError)
+				log.Printf("%s: expected hll but got %T", logger.ErrMetricInvalidType, value)
+				return
+			}
+			if _, err = w.Write([]byte(strconv.FormatUint(set.Estimate(), 10))); err != nil {
+				log.Printf("%s for metric %s: %v", logger.ErrWriteResponce, metricName, err)
+				return
+			}
 		default:
 			http.Error(w, logger.ErrMetricInvalidType, http.StatusNotFound)
 			return
@@ -126,15 +173,63 @@ func GetMetricHandler(store storage.StorageType) http.HandlerFunc {
 	}
 }
 
+// QuantileHandler answers the quantile given by the q parameter of a summary metric,
+// optionally restricted to the trailing window parameter (e.g. 5m).
+func QuantileHandler(store storage.StorageType) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		metricName := chi.URLParam(r, "name")
+
+		q, err := strconv.ParseFloat(r.URL.Query().Get("q"), 64)
+		if err != nil || math.IsNaN(q) {
+			http.Error(w, logger.ErrSummaryQuantile, http.StatusBadRequest)
+			return
+		}
+		var window time.Duration
+		if raw := r.URL.Query().Get("window"); raw != "" {
+			if window, err = time.ParseDuration(raw); err != nil {
+				http.Error(w, logger.ErrSummaryWindow, http.StatusBadRequest)
+				return
+			}
+		}
+
+		value, err := store.GetSummaryQuantile(metricName, q, window)
+		if err != nil {
+			status := http.StatusBadRequest
+			if err.Error() == logger.ErrMetricNotFound {
+				status = http.StatusNotFound
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain")
+		if _, err := w.Write([]byte(strconv.FormatFloat(value, 'f', -1, 64))); err != nil {
+			log.Printf("%s for metric %s: %v", logger.ErrWriteResponce, metricName, err)
+		}
+	}
+}
+
+// metricRow is a metric listed on the root page.
+type metricRow struct {
+	storage.Freshness
+	Name  string
+	Value interface{}
+}
+
 func RootHandler(store storage.StorageType) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		tmpl, err := template.New("metrics").Parse(`
 			<html>
 				<body>
+					<p><a href="/ui/agents">Agents</a> | <a href="/ui/alerts">Alerts</a></p>
 					<h2>Metrics List</h2>
 					<ul>
-						{{range $name, $value := .}}
-							<li>{{$name}}: {{$value}}</li>
+						{{range .}}
+							{{if .Stale}}
+								<li style="color: gray">{{.Name}}: {{.Value}} (stale since {{.Updated.Format "2006-01-02 15:04:05"}})</li>
+							{{else}}
+								<li>{{.Name}}: {{.Value}}</li>
+							{{end}}
 						{{end}}
 					</ul>
 				</body>
@@ -147,8 +242,17 @@ func RootHandler(store storage.StorageType) http.HandlerFunc {
 		}
 
 		metrics := store.GetAllMetrics()
+		freshness := store.AllFreshness()
+		rows := make([]metricRow, 0, len(metrics))
+		for name, value := range metrics {
+			rows = append(rows, metricRow{Name: name, Value: value, Freshness: freshness[name]})
+		}
+		slices.SortFunc(rows, func(a, b metricRow) int {
+			return cmp.Compare(a.Name, b.Name)
+		})
+
 		w.Header().Set("Content-Type", "text/html")
-		if err := tmpl.Execute(w, metrics); err != nil {
+		if err := tmpl.Execute(w, rows); err != nil {
 			http.Error(w, logger.ErrHTMLTemplateExecute, http.StatusInternalServerError)
 			log.Printf("%s: %v", logger.ErrHTMLTemplateExecute, err)
 		}
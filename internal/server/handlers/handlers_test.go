@@ -1,12 +1,22 @@
 package handlers
 
 import (
+	"encoding/json"
+	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/avointsev/yp7m-go/internal/models"
+	"github.com/avointsev/yp7m-go/internal/server/agents"
+	"github.com/avointsev/yp7m-go/internal/server/alerts"
+	"github.com/avointsev/yp7m-go/internal/server/selfmetrics"
 	"github.com/avointsev/yp7m-go/internal/server/storage"
 	"github.com/go-chi/chi/v5"
 )
@@ -17,6 +27,16 @@ func setupRouter(store storage.StorageType) *chi.Mux {
 	r.Get("/", RootHandler(store))
 	r.Get("/value/{type}/{name}", GetMetricHandler(store))
 	r.Post("/update/{type}/{name}/{value}", UpdateMetricHandler(store))
+	r.Post("/update/", UpdateJSONHandler(store))
+	r.Post("/value/", ValueJSONHandler(store))
+	r.Get("/metrics", PrometheusHandler(store))
+	r.Get("/quantile/{name}", QuantileHandler(store))
+	r.Get("/history/{type}/{name}", HistoryHandler(store))
+	r.Delete("/value/{type}/{name}", DeleteMetricHandler(store))
+	r.Delete("/value/", DeleteMatchingHandler(store))
+	r.Post("/reset/{name}", ResetCounterHandler(store))
+	r.Get("/query", QueryHandler(store))
+	r.Get("/query_range", QueryRangeHandler(store))
 	return r
 }
 
@@ -142,3 +162,400 @@ func TestInvalidRequest(t *testing.T) {
 		t.Errorf("expected status %v; got %v", http.StatusNotFound, res.StatusCode)
 	}
 }
+
+// doRequest serves a request through the router and returns the status and body.
+func doRequest(t *testing.T, r http.Handler, method, target, body string) (int, string) {
+	t.Helper()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	res := rec.Result()
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			t.Errorf("could not close response body: %v", err)
+		}
+	}()
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("could not read response body: %v", err)
+	}
+	return res.StatusCode, string(data)
+}
+
+// TestUpdateJSONHandler tests the JSON update and value API.
+func TestUpdateJSONHandler(t *testing.T) {
+	store := storage.NewMemStorage()
+	r := setupRouter(store)
+
+	status, body := doRequest(t, r, http.MethodPost, "/update/", `{"id":"PollCount","type":"counter","delta":3}`)
+	if status != http.StatusOK {
+		t.Fatalf("expected status %v; got %v (%s)", http.StatusOK, status, body)
+	}
+	if !strings.Contains(body, `"delta":3`) {
+		t.Errorf("expected counter in response; got %q", body)
+	}
+
+	status, _ = doRequest(t, r, http.MethodPost, "/update/", `{"id":"Alloc","type":"gauge"}`)
+	if status != http.StatusBadRequest {
+		t.Errorf("expected status %v for missing value; got %v", http.StatusBadRequest, status)
+	}
+
+	status, body = doRequest(t, r, http.MethodPost, "/value/", `{"id":"PollCount","type":"counter"}`)
+	if status != http.StatusOK || !strings.Contains(body, `"delta":3`) {
+		t.Errorf("expected stored counter; got %v %q", status, body)
+	}
+}
+
+// TestValueJSONNonFinite tests that values JSON cannot represent never produce an empty 200 response.
+func TestValueJSONNonFinite(t *testing.T) {
+	store := storage.NewMemStorage()
+	r := setupRouter(store)
+
+	store.UpdateGauge("ratio", math.NaN())
+	status, body := doRequest(t, r, http.MethodPost, "/value/", `{"id":"ratio","type":"gauge"}`)
+	if status != http.StatusOK || !strings.Contains(body, `"value":null`) {
+		t.Errorf("expected NaN gauge encoded as null; got %v %q", status, body)
+	}
+
+	huge := storage.Histogram{Bounds: []float64{1}, Counts: []uint64{1}, Sum: math.MaxFloat64, Count: 1}
+	for range 2 {
+		if err := store.UpdateHistogram("latency", huge); err != nil {
+			t.Fatalf("UpdateHistogram: %v", err)
+		}
+	}
+	status, body = doRequest(t, r, http.MethodPost, "/value/", `{"id":"latency","type":"histogram"}`)
+	if status != http.StatusInternalServerError {
+		t.Errorf("expected status %v for an overflowed sum; got %v %q", http.StatusInternalServerError, status, body)
+	}
+}
+
+// TestHistogramHandlers tests histogram ingestion and Prometheus exposition.
+func TestHistogramHandlers(t *testing.T) {
+	store := storage.NewMemStorage()
+	r := setupRouter(store)
+
+	payload := `{"id":"latency","type":"histogram","buckets":[{"le":0.1,"count":2},{"le":1,"count":3}],"sum":1.2,"count":4}`
+	for range 2 {
+		if status, body := doRequest(t, r, http.MethodPost, "/update/", payload); status != http.StatusOK {
+			t.Fatalf("expected status %v; got %v (%s)", http.StatusOK, status, body)
+		}
+	}
+
+	status, body := doRequest(t, r, http.MethodGet, "/metrics", "")
+	if status != http.StatusOK {
+		t.Fatalf("expected status %v; got %v", http.StatusOK, status)
+	}
+	for _, expected := range []string{
+		"# TYPE latency histogram",
+		`latency_bucket{le="0.1"} 4`,
+		`latency_bucket{le="+Inf"} 8`,
+		"latency_count 8",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("expected exposition to contain %q; got %q", expected, body)
+		}
+	}
+
+	status, body = doRequest(t, r, http.MethodGet, "/value/histogram/latency", "")
+	if status != http.StatusOK || !strings.Contains(body, "p99=") {
+		t.Errorf("expected histogram summary with quantiles; got %v %q", status, body)
+	}
+}
+
+// TestSummaryHandlers tests summary ingestion from observations and quantile queries.
+func TestSummaryHandlers(t *testing.T) {
+	store := storage.NewMemStorage()
+	r := setupRouter(store)
+
+	payload := `{"id":"rtt","type":"summary","observations":[1,2,3,4,5,6,7,8,9,10]}`
+	if status, body := doRequest(t, r, http.MethodPost, "/update/", payload); status != http.StatusOK {
+		t.Fatalf("expected status %v; got %v (%s)", http.StatusOK, status, body)
+	}
+
+	status, body := doRequest(t, r, http.MethodGet, "/quantile/rtt?q=0.5&window=5m", "")
+	if status != http.StatusOK {
+		t.Fatalf("expected status %v; got %v (%s)", http.StatusOK, status, body)
+	}
+	if !strings.HasPrefix(body, "5") {
+		t.Errorf("expected median near 5; got %q", body)
+	}
+
+	for _, q := range []string{"2", "NaN"} {
+		if status, _ := doRequest(t, r, http.MethodGet, "/quantile/rtt?q="+q, ""); status != http.StatusBadRequest {
+			t.Errorf("expected status %v for quantile %s; got %v", http.StatusBadRequest, q, status)
+		}
+	}
+	if status, _ := doRequest(t, r, http.MethodGet, "/quantile/missing?q=0.5", ""); status != http.StatusNotFound {
+		t.Errorf("expected status %v for missing metric; got %v", http.StatusNotFound, status)
+	}
+}
+
+// TestSetHandlers tests distinct counting from members posted by several clients.
+func TestSetHandlers(t *testing.T) {
+	store := storage.NewMemStorage()
+	r := setupRouter(store)
+
+	for _, payload := range []string{
+		`{"id":"visitors","type":"set","members":["alice","bob"]}`,
+		`{"id":"visitors","type":"set","members":["bob","carol","alice"]}`,
+	} {
+		if status, body := doRequest(t, r, http.MethodPost, "/update/", payload); status != http.StatusOK {
+			t.Fatalf("expected status %v; got %v (%s)", http.StatusOK, status, body)
+		}
+	}
+
+	status, body := doRequest(t, r, http.MethodGet, "/value/set/visitors", "")
+	if status != http.StatusOK || body != "3" {
+		t.Errorf("expected 3 distinct members; got %v %q", status, body)
+	}
+}
+
+// TestPrometheusLabels tests that labelled series are grouped into one metric family.
+func TestPrometheusLabels(t *testing.T) {
+	store := storage.NewMemStorage()
+	store.UpdateGauge(`cpu{host="b"}`, 2)
+	store.UpdateGauge("cpu_total", 3)
+	store.UpdateGauge(`cpu{host="a"}`, 1)
+
+	_, body := doRequest(t, setupRouter(store), http.MethodGet, "/metrics", "")
+	expected := "# TYPE cpu gauge\ncpu{host=\"a\"} 1\ncpu{host=\"b\"} 2\n# TYPE cpu_total gauge\ncpu_total 3\n"
+	if body != expected {
+		t.Errorf("expected %q; got %q", expected, body)
+	}
+}
+
+// TestHistoryHandler tests the gauge history endpoint.
+func TestHistoryHandler(t *testing.T) {
+	store := storage.NewMemStorage()
+	base := time.Now().Add(-10 * time.Minute).Truncate(time.Second)
+	store.UpdateGaugeAt("temp", 20, base)
+	store.UpdateGaugeAt("temp", 21, base.Add(time.Minute))
+	r := setupRouter(store)
+
+	from := strconv.FormatInt(base.Add(30*time.Second).Unix(), 10)
+	status, body := doRequest(t, r, http.MethodGet, "/history/gauge/temp?from="+from, "")
+	if status != http.StatusOK {
+		t.Fatalf("expected status %v; got %v", http.StatusOK, status)
+	}
+	var samples []storage.Sample
+	if err := json.Unmarshal([]byte(body), &samples); err != nil {
+		t.Fatalf("could not decode response: %v", err)
+	}
+	if len(samples) != 1 || samples[0].Value != 21 {
+		t.Errorf("expected one sample with value 21, got %v", samples)
+	}
+
+	if status, _ := doRequest(t, r, http.MethodGet, "/history/gauge/temp?from=bad", ""); status != http.StatusBadRequest {
+		t.Errorf("expected status %v for bad range; got %v", http.StatusBadRequest, status)
+	}
+	if status, _ := doRequest(t, r, http.MethodGet, "/history/gauge/missing", ""); status != http.StatusNotFound {
+		t.Errorf("expected status %v for missing metric; got %v", http.StatusNotFound, status)
+	}
+}
+
+// TestAgentsHandler tests the agent list in JSON and HTML.
+func TestAgentsHandler(t *testing.T) {
+	registry := agents.New(time.Minute, 5*time.Minute, time.Hour)
+	registry.Seen(models.Agent{ID: "web1", Hostname: "web1.example.com"}, "10.0.0.1:5000")
+
+	r := chi.NewRouter()
+	r.Get("/agents", AgentsHandler(registry))
+	r.Get("/ui/agents", AgentsPageHandler(registry))
+
+	status, body := doRequest(t, r, http.MethodGet, "/agents", "")
+	if status != http.StatusOK {
+		t.Fatalf("expected status %v; got %v", http.StatusOK, status)
+	}
+	var list []agents.Entry
+	if err := json.Unmarshal([]byte(body), &list); err != nil {
+		t.Fatalf("could not decode response: %v", err)
+	}
+	if len(list) != 1 || list[0].ID != "web1" || list[0].Status != agents.Online {
+		t.Errorf("unexpected agents %+v", list)
+	}
+
+	status, body = doRequest(t, r, http.MethodGet, "/ui/agents", "")
+	if status != http.StatusOK || !strings.Contains(body, "web1.example.com") || !strings.Contains(body, "online") {
+		t.Errorf("expected agent in page, got %v %q", status, body)
+	}
+}
+
+// TestStaleMetrics tests that stale metrics are marked in JSON and on the root page.
+func TestStaleMetrics(t *testing.T) {
+	store := storage.NewMemStorage()
+	store.SetExpiry(time.Nanosecond, 0)
+	store.UpdateGauge("frozen", 1)
+	time.Sleep(time.Millisecond)
+	r := setupRouter(store)
+
+	status, body := doRequest(t, r, http.MethodPost, "/value/", `{"id":"frozen","type":"gauge"}`)
+	if status != http.StatusOK {
+		t.Fatalf("expected status %v; got %v", http.StatusOK, status)
+	}
+	var metric models.Metrics
+	if err := json.Unmarshal([]byte(body), &metric); err != nil {
+		t.Fatalf("could not decode response: %v", err)
+	}
+	if !metric.Stale || metric.UpdatedAt == nil {
+		t.Errorf("expected stale metric with update time, got %s", body)
+	}
+
+	if _, body := doRequest(t, r, http.MethodGet, "/", ""); !strings.Contains(body, "stale since") {
+		t.Errorf("expected stale marker on root page, got %q", body)
+	}
+}
+
+// TestDeleteHandlers tests single and bulk deletion and counter reset.
+func TestDeleteHandlers(t *testing.T) {
+	store := storage.NewMemStorage()
+	store.UpdateGauge("typo", 1)
+	store.UpdateGauge(`disk{host="web1"}`, 2)
+	store.UpdateGauge(`disk{host="web2"}`, 3)
+	store.UpdateCounter("PollCount", 9)
+	r := setupRouter(store)
+
+	if status, _ := doRequest(t, r, http.MethodDelete, "/value/gauge/typo", ""); status != http.StatusOK {
+		t.Errorf("expected status %v; got %v", http.StatusOK, status)
+	}
+	if status, _ := doRequest(t, r, http.MethodDelete, "/value/gauge/typo", ""); status != http.StatusNotFound {
+		t.Errorf("expected status %v for missing metric; got %v", http.StatusNotFound, status)
+	}
+
+	if status, _ := doRequest(t, r, http.MethodPost, "/reset/PollCount", ""); status != http.StatusOK {
+		t.Errorf("expected status %v; got %v", http.StatusOK, status)
+	}
+	if _, body := doRequest(t, r, http.MethodGet, "/value/counter/PollCount", ""); body != "0" {
+		t.Errorf("expected reset counter 0, got %q", body)
+	}
+	if status, _ := doRequest(t, r, http.MethodPost, "/reset/missing", ""); status != http.StatusNotFound {
+		t.Errorf("expected status %v for missing counter; got %v", http.StatusNotFound, status)
+	}
+
+	if status, _ := doRequest(t, r, http.MethodDelete, "/value/", ""); status != http.StatusBadRequest {
+		t.Errorf("expected status %v without a selector; got %v", http.StatusBadRequest, status)
+	}
+	status, body := doRequest(t, r, http.MethodDelete, "/value/?prefix=di&label=host=web1", "")
+	if status != http.StatusOK || strings.TrimSpace(body) != `{"deleted":1}` {
+		t.Errorf("expected one deleted metric, got %v %q", status, body)
+	}
+	if _, err := store.GetMetric(storage.Gauge, `disk{host="web2"}`); err != nil {
+		t.Errorf("expected unmatched series to be kept: %v", err)
+	}
+}
+
+// TestAlertsHandler tests the alert list in JSON and HTML.
+func TestAlertsHandler(t *testing.T) {
+	store := storage.NewMemStorage()
+	store.UpdateGauge("HeapAlloc", 2e9)
+	rule, err := alerts.ParseRule("HighHeap: gauge HeapAlloc > 1e9")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	engine := alerts.New(store, []alerts.Rule{rule})
+	engine.Evaluate()
+
+	r := chi.NewRouter()
+	r.Get("/alerts", AlertsHandler(engine))
+	r.Get("/ui/alerts", AlertsPageHandler(engine))
+
+	status, body := doRequest(t, r, http.MethodGet, "/alerts", "")
+	if status != http.StatusOK {
+		t.Fatalf("expected status %v; got %v", http.StatusOK, status)
+	}
+	var list []alerts.Alert
+	if err := json.Unmarshal([]byte(body), &list); err != nil {
+		t.Fatalf("could not decode response: %v", err)
+	}
+	if len(list) != 1 || list[0].Name != "HighHeap" || list[0].State != alerts.Firing ||
+		list[0].Value == nil || *list[0].Value != 2e9 {
+		t.Errorf("unexpected alerts %+v", list)
+	}
+
+	status, body = doRequest(t, r, http.MethodGet, "/ui/alerts", "")
+	if status != http.StatusOK || !strings.Contains(body, "HighHeap") || !strings.Contains(body, "firing") {
+		t.Errorf("expected alert in page, got %v %q", status, body)
+	}
+}
+
+// TestQueryHandlers tests instant and range expression queries.
+func TestQueryHandlers(t *testing.T) {
+	store := storage.NewMemStorage()
+	now := time.Now().Truncate(time.Second)
+	store.UpdateGaugeAt(`cpu{host="web1"}`, 0.5, now.Add(-2*time.Minute))
+	store.UpdateGaugeAt(`cpu{host="web1"}`, 0.75, now.Add(-time.Minute))
+	store.UpdateGaugeAt(`cpu{host="web2"}`, 0.25, now.Add(-2*time.Minute))
+	r := setupRouter(store)
+
+	status, body := doRequest(t, r, http.MethodGet, "/query?query="+url.QueryEscape(`cpu{host="web1"} * 100`), "")
+	want := `"result":[{"metric":{"host":"web1"},"value":[`
+	if status != http.StatusOK || !strings.Contains(body, `"resultType":"vector"`) || !strings.Contains(body, want) ||
+		!strings.Contains(body, `"75"]`) {
+		t.Errorf("unexpected instant query response %v %s", status, body)
+	}
+
+	status, body = doRequest(t, r, http.MethodGet, "/query?query=1%2B1", "")
+	if status != http.StatusOK || !strings.Contains(body, `"resultType":"scalar"`) || !strings.Contains(body, `"2"]`) {
+		t.Errorf("unexpected scalar query response %v %s", status, body)
+	}
+
+	target := fmt.Sprintf("/query_range?query=sum(cpu)&start=%d&end=%d&step=60",
+		now.Add(-2*time.Minute).Unix(), now.Unix())
+	status, body = doRequest(t, r, http.MethodGet, target, "")
+	if status != http.StatusOK {
+		t.Fatalf("expected status %v; got %v (%s)", http.StatusOK, status, body)
+	}
+	var resp struct {
+		Data struct {
+			ResultType string `json:"resultType"`
+			Result     []struct {
+				Values [][2]any `json:"values"`
+			} `json:"result"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(body), &resp); err != nil {
+		t.Fatalf("could not decode response: %v", err)
+	}
+	if resp.Data.ResultType != "matrix" || len(resp.Data.Result) != 1 || len(resp.Data.Result[0].Values) != 3 {
+		t.Fatalf("unexpected range response %s", body)
+	}
+	for i, want := range []string{"0.75", "1", "1"} {
+		if got := resp.Data.Result[0].Values[i][1]; got != want {
+			t.Errorf("step %d: expected %s, got %v", i, want, got)
+		}
+	}
+
+	for _, target := range []string{
+		"/query?query=" + url.QueryEscape("cpu +"),
+		"/query?query=cpu&time=yesterday",
+		"/query_range?query=cpu&step=0",
+		"/query_range?query=cpu&start=100&end=50",
+		"/query_range?query=cpu&start=0&end=100000&step=1",
+	} {
+		status, body := doRequest(t, r, http.MethodGet, target, "")
+		if status != http.StatusBadRequest || !strings.Contains(body, `"status":"error"`) {
+			t.Errorf("%s: expected bad request, got %v %s", target, status, body)
+		}
+	}
+}
+
+// TestReservedNamesRejected checks that writes to the reserved namespace are refused with 400.
+func TestReservedNamesRejected(t *testing.T) {
+	store := storage.NewMemStorage()
+	r := setupRouter(selfmetrics.New().Wrap(store))
+
+	name := selfmetrics.Prefix + "x"
+	if status, _ := doRequest(t, r, http.MethodPost, "/update/gauge/"+name+"/1", ""); status != http.StatusBadRequest {
+		t.Errorf("expected status %v for reserved gauge; got %v", http.StatusBadRequest, status)
+	}
+	body := `{"id":"` + name + `","type":"counter","delta":1}`
+	if status, _ := doRequest(t, r, http.MethodPost, "/update/", body); status != http.StatusBadRequest {
+		t.Errorf("expected status %v for reserved counter; got %v", http.StatusBadRequest, status)
+	}
+	if status, _ := doRequest(t, r, http.MethodPost, "/update/gauge/allowed/1", ""); status != http.StatusOK {
+		t.Errorf("expected status %v for a regular gauge; got %v", http.StatusOK, status)
+	}
+	if len(store.GetAllMetrics()) != 1 {
+		t.Errorf("expected only the regular gauge to be stored, got %v", store.GetAllMetrics())
+	}
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/avointsev/yp7m-go/internal/logger"
+	"github.com/avointsev/yp7m-go/internal/server/storage"
+)
+
+// defaultHistoryRange is used when a history request has no from parameter.
+const defaultHistoryRange = time.Hour
+
+// HistoryHandler returns the recorded samples of a gauge or counter as JSON.
+// The from and to parameters accept RFC 3339 times or Unix seconds.
+func HistoryHandler(store storage.StorageType) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		metricType := chi.URLParam(r, "type")
+		metricName := chi.URLParam(r, "name")
+
+		now := time.Now()
+		to, err := parseTime(r.URL.Query().Get("to"), now)
+		if err != nil {
+			http.Error(w, logger.ErrHistoryRange, http.StatusBadRequest)
+			return
+		}
+		from, err := parseTime(r.URL.Query().Get("from"), to.Add(-defaultHistoryRange))
+		if err != nil || from.After(to) {
+			http.Error(w, logger.ErrHistoryRange, http.StatusBadRequest)
+			return
+		}
+
+		samples, err := store.History(metricType, metricName, from, to)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if samples == nil {
+			samples = []storage.Sample{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(samples); err != nil {
+			log.Printf("%s for metric %s: %v", logger.ErrWriteResponce, metricName, err)
+		}
+	}
+}
+
+// parseTime accepts RFC 3339 or Unix seconds and returns fallback for an empty value.
+func parseTime(raw string, fallback time.Time) (time.Time, error) {
+	if raw == "" {
+		return fallback, nil
+	}
+	if seconds, err := strconv.ParseFloat(raw, 64); err == nil {
+		return time.Unix(0, int64(seconds*float64(time.Second))), nil
+	}
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t, nil
+}
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+
+	"github.com/avointsev/yp7m-go/internal/hll"
+	"github.com/avointsev/yp7m-go/internal/logger"
+	"github.com/avointsev/yp7m-go/internal/models"
+	"github.com/avointsev/yp7m-go/internal/server/storage"
+	"github.com/avointsev/yp7m-go/internal/sketch"
+)
+
+// UpdateJSONHandler applies a metric passed as JSON and responds with its stored value.
+func UpdateJSONHandler(store storage.StorageType) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var metric models.Metrics
+		if err := json.NewDecoder(r.Body).Decode(&metric); err != nil {
+			http.Error(w, logger.ErrMetricInvalidJSON, http.StatusBadRequest)
+			log.Printf(logger.LogDefaultFormat, logger.ErrMetricInvalidJSON, err)
+			return
+		}
+		if metric.ID == "" {
+			http.Error(w, logger.ErrMetricNotFound, http.StatusNotFound)
+			return
+		}
+
+		if err := updateMetric(store, metric); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			log.Printf("%s for metric %s", err, metric.ID)
+			return
+		}
+
+		writeMetricJSON(w, store, metric.MType, metric.ID)
+	}
+}
+
+// ValueJSONHandler responds with the stored value of the metric named in the JSON request.
+func ValueJSONHandler(store storage.StorageType) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var metric models.Metrics
+		if err := json.NewDecoder(r.Body).Decode(&metric); err != nil {
+			http.Error(w, logger.ErrMetricInvalidJSON, http.StatusBadRequest)
+			log.Printf(logger.LogDefaultFormat, logger.ErrMetricInvalidJSON, err)
+			return
+		}
+
+		writeMetricJSON(w, store, metric.MType, metric.ID)
+	}
+}
+
+// reserver is implemented by stores that refuse writes to some metric names.
+type reserver interface {
+	Reserved(name string) bool
+}
+
+// reserved reports whether store refuses writes to name.
+func reserved(store storage.StorageType, name string) bool {
+	r, ok := store.(reserver)
+	return ok && r.Reserved(name)
+}
+
+func updateMetric(store storage.StorageType, metric models.Metrics) error {
+	if reserved(store, metric.ID) {
+		return errors.New(logger.ErrMetricReserved)
+	}
+	switch metric.MType {
+	case Gauge:
+		if metric.Value == nil {
+			return errors.New(logger.ErrMetricInvalidGaugeValue)
+		}
+		store.UpdateGauge(metric.ID, *metric.Value)
+	case Counter:
+		if metric.Delta == nil {
+			return errors.New(logger.ErrMetricInvalidCounterValue)
+		}
+		store.UpdateCounter(metric.ID, *metric.Delta)
+	case Histogram:
+		if metric.Sum == nil || metric.Count == nil {
+			return errors.New(logger.ErrHistogramInvalid)
+		}
+		h := storage.Histogram{
+			Bounds: make([]float64, 0, len(metric.Buckets)),
+			Counts: make([]uint64, 0, len(metric.Buckets)),
+			Sum:    *metric.Sum,
+			Count:  *metric.Count,
+		}
+		for _, b := range metric.Buckets {
+			h.Bounds = append(h.Bounds, b.UpperBound)
+			h.Counts = append(h.Counts, b.Count)
+		}
+		return store.UpdateHistogram(metric.ID, h)
+	case Summary:
+		summary := sketch.New(sketch.DefaultAlpha)
+		if metric.Sketch != nil {
+			summary = metric.Sketch.Clone()
+		}
+		for _, v := range metric.Observations {
+			summary.Add(v)
+		}
+		if summary.Count == 0 {
+			return errors.New(logger.ErrSummaryInvalid)
+		}
+		return store.UpdateSummary(metric.ID, summary)
+	case Set:
+		set := hll.New(hll.DefaultPrecision)
+		if metric.HLL != nil {
+			if err := metric.HLL.Validate(); err != nil {
+				return err
+			}
+			set = metric.HLL.Clone()
+		}
+		for _, member := range metric.Members {
+			set.Add(member)
+		}
+		return store.UpdateSet(metric.ID, set)
+	default:
+		return errors.New(logger.ErrMetricInvalidType)
+	}
+	return nil
+}
+
+// toModel converts a stored value into its JSON representation.
+func toModel(metricType, name string, value interface{}) (models.Metrics, bool) {
+	metric := models.Metrics{ID: name, MType: metricType}
+	switch v := value.(type) {
+	case float64:
+		metric.Value = &v
+	case int64:
+		metric.Delta = &v
+	case storage.Histogram:
+		metric.Sum, metric.Count = &v.Sum, &v.Count
+		for i, bound := range v.Bounds {
+			metric.Buckets = append(metric.Buckets, models.Bucket{UpperBound: bound, Count: v.Counts[i]})
+		}
+	case *sketch.Sketch:
+		metric.Sum, metric.Count, metric.Sketch = &v.Sum, &v.Count, v
+	case *hll.HLL:
+		estimate := v.Estimate()
+		metric.Count, metric.HLL = &estimate, v
+	default:
+		return metric, false
+	}
+	return metric, true
+}
+
+func writeMetricJSON(w http.ResponseWriter, store storage.StorageType, metricType, name string) {
+	value, err := store.GetMetric(metricType, name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	metric, ok := toModel(metricType, name, value)
+	if !ok {
+		http.Error(w, logger.ErrMetricInvalidType, http.StatusInternalServerError)
+		log.Printf("%s: unexpected value %T", logger.ErrMetricInvalidType, value)
+		return
+	}
+	if freshness, err := store.Freshness(metricType, name); err == nil {
+		metric.UpdatedAt, metric.Stale = &freshness.Updated, freshness.Stale
+	}
+
+	body, err := marshalMetric(metric)
+	if err != nil {
+		http.Error(w, logger.ErrWriteResponce, http.StatusInternalServerError)
+		log.Printf("%s for metric %s: %v", logger.ErrWriteResponce, name, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(append(body, '\n')); err != nil {
+		log.Printf("%s for metric %s: %v", logger.ErrWriteResponce, name, err)
+	}
+}
+
+// marshalMetric encodes metric as JSON. JSON has no NaN or infinities, so a
+// non-finite gauge is written as "value": null.
+func marshalMetric(metric models.Metrics) ([]byte, error) {
+	if metric.Value == nil || !math.IsNaN(*metric.Value) && !math.IsInf(*metric.Value, 0) {
+		return json.Marshal(metric)
+	}
+	return json.Marshal(struct {
+		Value *float64 `json:"value"`
+		models.Metrics
+	}{Metrics: metric})
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"cmp"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/avointsev/yp7m-go/internal/hll"
+	"github.com/avointsev/yp7m-go/internal/labels"
+	"github.com/avointsev/yp7m-go/internal/logger"
+	"github.com/avointsev/yp7m-go/internal/server/storage"
+	"github.com/avointsev/yp7m-go/internal/sketch"
+)
+
+type promSample struct {
+	value  interface{}
+	labels labels.Labels
+	name   string
+}
+
+// PrometheusHandler exposes all metrics in the Prometheus text exposition format.
+// Series sharing a metric name are grouped under a single TYPE line.
+func PrometheusHandler(store storage.StorageType) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		metrics := store.GetAllMetrics()
+		samples := make([]promSample, 0, len(metrics))
+		for series, value := range metrics {
+			name, l, err := labels.Parse(series)
+			if err != nil {
+				name, l = series, nil
+			}
+			samples = append(samples, promSample{name: promName(name), labels: l, value: value})
+		}
+		slices.SortFunc(samples, func(a, b promSample) int {
+			return cmp.Or(cmp.Compare(a.name, b.name), cmp.Compare(labels.Series("", a.labels), labels.Series("", b.labels)))
+		})
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		var out strings.Builder
+		family := ""
+		for _, sample := range samples {
+			if sample.name != family {
+				family = sample.name
+				out.WriteString("# TYPE " + family + " " + promType(sample.value) + "\n")
+			}
+			writePrometheusMetric(&out, sample)
+		}
+		if _, err := w.Write([]byte(out.String())); err != nil {
+			log.Printf("%s: %v", logger.ErrWriteResponce, err)
+		}
+	}
+}
+
+func promType(value interface{}) string {
+	switch value.(type) {
+	case int64:
+		return "counter"
+	case storage.Histogram:
+		return "histogram"
+	case *sketch.Sketch:
+		return "summary"
+	default:
+		return "gauge"
+	}
+}
+
+func writePrometheusMetric(out *strings.Builder, s promSample) {
+	line := func(suffix string, value string, extra ...string) {
+		out.WriteString(promSeries(s.name+suffix, s.labels, extra...) + " " + value + "\n")
+	}
+
+	switch v := s.value.(type) {
+	case float64:
+		line("", promFloat(v))
+	case int64:
+		line("", strconv.FormatInt(v, 10))
+	case storage.Histogram:
+		for i, bound := range v.Bounds {
+			line("_bucket", strconv.FormatUint(v.Counts[i], 10), "le", promFloat(bound))
+		}
+		line("_bucket", strconv.FormatUint(v.Count, 10), "le", "+Inf")
+		line("_sum", promFloat(v.Sum))
+		line("_count", strconv.FormatUint(v.Count, 10))
+	case *sketch.Sketch:
+		for _, q := range []float64{0.5, 0.95, 0.99} {
+			line("", promFloat(v.Quantile(q)), "quantile", promFloat(q))
+		}
+		line("_sum", promFloat(v.Sum))
+		line("_count", strconv.FormatUint(v.Count, 10))
+	case *hll.HLL:
+		line("", strconv.FormatUint(v.Estimate(), 10))
+	}
+}
+
+// promSeries renders name with its labels followed by extra label pairs.
+func promSeries(name string, l labels.Labels, extra ...string) string {
+	if len(extra) == 0 {
+		return labels.Series(name, promLabels(l))
+	}
+	all := promLabels(l)
+	if all == nil {
+		all = make(labels.Labels)
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		all[extra[i]] = extra[i+1]
+	}
+	return labels.Series(name, all)
+}
+
+func promLabels(l labels.Labels) labels.Labels {
+	if len(l) == 0 {
+		return nil
+	}
+	sanitized := make(labels.Labels, len(l))
+	for k, v := range l {
+		sanitized[promName(k)] = v
+	}
+	return sanitized
+}
+
+// promName replaces characters that are not allowed in Prometheus metric names.
+func promName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_', r == ':':
+			return r
+		case r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
+
+func promFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/avointsev/yp7m-go/internal/logger"
+	"github.com/avointsev/yp7m-go/internal/server/expr"
+	"github.com/avointsev/yp7m-go/internal/server/storage"
+)
+
+// maxQueryPoints caps the steps of a range query.
+const maxQueryPoints = 11000
+
+// queryResponse follows the Prometheus HTTP API, so existing clients can read it.
+type queryResponse struct {
+	Status    string     `json:"status"`
+	Data      *queryData `json:"data,omitempty"`
+	ErrorType string     `json:"errorType,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+type queryData struct {
+	ResultType string `json:"resultType"`
+	Result     any    `json:"result"`
+}
+
+// querySample is a [unix seconds, "value"] pair.
+type querySample [2]any
+
+type vectorSeries struct {
+	Metric map[string]string `json:"metric"`
+	Value  querySample       `json:"value"`
+}
+
+type matrixSeries struct {
+	Metric map[string]string `json:"metric"`
+	Values []querySample     `json:"values"`
+}
+
+func newQuerySample(t time.Time, value float64) querySample {
+	return querySample{float64(t.UnixMilli()) / 1000, strconv.FormatFloat(value, 'f', -1, 64)}
+}
+
+func metricLabels(s expr.Sample) map[string]string {
+	m := make(map[string]string, len(s.Labels)+1)
+	for k, v := range s.Labels {
+		m[k] = v
+	}
+	if s.Name != "" {
+		m["__name__"] = s.Name
+	}
+	return m
+}
+
+// QueryHandler evaluates the query parameter at the time parameter, which
+// defaults to now, and returns a vector or scalar.
+func QueryHandler(store storage.StorageType) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		node, err := expr.Parse(r.URL.Query().Get("query"))
+		if err != nil {
+			writeQueryError(w, err)
+			return
+		}
+		at, err := parseTime(r.URL.Query().Get("time"), time.Now())
+		if err != nil {
+			writeQueryError(w, fmt.Errorf("%s: time", logger.ErrQueryParam))
+			return
+		}
+		result, err := expr.NewEvaluator(store).Eval(node, at)
+		if err != nil {
+			writeQueryError(w, err)
+			return
+		}
+
+		data := &queryData{ResultType: "vector"}
+		if result.IsScalar {
+			data.ResultType = "scalar"
+			data.Result = newQuerySample(at, result.Scalar)
+		} else {
+			vector := make([]vectorSeries, 0, len(result.Vector))
+			for _, s := range result.Vector {
+				vector = append(vector, vectorSeries{Metric: metricLabels(s), Value: newQuerySample(at, s.Value)})
+			}
+			data.Result = vector
+		}
+		writeQueryResponse(w, http.StatusOK, queryResponse{Status: "success", Data: data})
+	}
+}
+
+// QueryRangeHandler evaluates the query parameter at every step between start
+// and end and returns a matrix. Step takes seconds or a duration such as 30s.
+func QueryRangeHandler(store storage.StorageType) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		node, err := expr.Parse(query.Get("query"))
+		if err != nil {
+			writeQueryError(w, err)
+			return
+		}
+		now := time.Now()
+		end, err := parseTime(query.Get("end"), now)
+		if err != nil {
+			writeQueryError(w, fmt.Errorf("%s: end", logger.ErrQueryParam))
+			return
+		}
+		start, err := parseTime(query.Get("start"), end.Add(-defaultHistoryRange))
+		if err != nil || start.After(end) {
+			writeQueryError(w, fmt.Errorf("%s: start", logger.ErrQueryParam))
+			return
+		}
+		step, err := parseStep(query.Get("step"))
+		if err != nil || end.Sub(start)/step >= maxQueryPoints {
+			writeQueryError(w, fmt.Errorf("%s: step", logger.ErrQueryParam))
+			return
+		}
+
+		evaluator := expr.NewEvaluator(store)
+		series := make(map[string]*matrixSeries)
+		var order []string
+		for at := start; !at.After(end); at = at.Add(step) {
+			result, err := evaluator.Eval(node, at)
+			if err != nil {
+				writeQueryError(w, err)
+				return
+			}
+			if result.IsScalar {
+				result.Vector = []expr.Sample{{Value: result.Scalar}}
+			}
+			for _, s := range result.Vector {
+				key := s.Series()
+				m, ok := series[key]
+				if !ok {
+					m = &matrixSeries{Metric: metricLabels(s)}
+					series[key] = m
+					order = append(order, key)
+				}
+				m.Values = append(m.Values, newQuerySample(at, s.Value))
+			}
+		}
+
+		matrix := make([]*matrixSeries, 0, len(order))
+		for _, key := range order {
+			matrix = append(matrix, series[key])
+		}
+		writeQueryResponse(w, http.StatusOK, queryResponse{
+			Status: "success",
+			Data:   &queryData{ResultType: "matrix", Result: matrix},
+		})
+	}
+}
+
+// parseStep accepts seconds or a Go duration; it defaults to one minute.
+func parseStep(raw string) (time.Duration, error) {
+	if raw == "" {
+		return time.Minute, nil
+	}
+	var step time.Duration
+	if seconds, err := strconv.ParseFloat(raw, 64); err == nil {
+		step = time.Duration(seconds * float64(time.Second))
+	} else if step, err = time.ParseDuration(raw); err != nil {
+		return 0, err
+	}
+	if step <= 0 {
+		return 0, fmt.Errorf("%s: step must be positive", logger.ErrQueryParam)
+	}
+	return step, nil
+}
+
+func writeQueryError(w http.ResponseWriter, err error) {
+	writeQueryResponse(w, http.StatusBadRequest, queryResponse{Status: "error", ErrorType: "bad_data", Error: err.Error()})
+}
+
+func writeQueryResponse(w http.ResponseWriter, status int, resp queryResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf(logger.LogDefaultFormat, logger.ErrWriteResponce, err)
+	}
+}
@@ -0,0 +1,91 @@
+// Package influx ingests metrics written in the InfluxDB line protocol.
+package influx
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/avointsev/yp7m-go/internal/cumulative"
+	"github.com/avointsev/yp7m-go/internal/labels"
+	"github.com/avointsev/yp7m-go/internal/logger"
+	"github.com/avointsev/yp7m-go/internal/server/storage"
+)
+
+// MetricName maps a measurement and field to a metric name. The conventional
+// "value" field maps to the bare measurement name.
+func MetricName(measurement, field string) string {
+	if field == "value" {
+		return measurement
+	}
+	return measurement + "_" + field
+}
+
+// Handler accepts line protocol bodies on POST /write. Float and boolean
+// fields become gauges recorded at the point timestamp. Integer fields become
+// gauges unless their metric name matches one of counterPatterns (path.Match
+// syntax), in which case they are treated as cumulative counters and stored as
+// deltas, the first reading of each series being a baseline. String fields are
+// ignored.
+func Handler(store storage.StorageType, counterPatterns []string) http.HandlerFunc {
+	tracker := cumulative.New()
+
+	isCounter := func(name string) bool {
+		for _, pattern := range counterPatterns {
+			if ok, _ := path.Match(pattern, name); ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		precision := r.URL.Query().Get("precision")
+
+		var failed []string
+		scanner := bufio.NewScanner(r.Body)
+		lineNumber := 0
+		for scanner.Scan() {
+			lineNumber++
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			point, err := ParseLine(line, precision)
+			if err != nil {
+				failed = append(failed, fmt.Sprintf("line %d: %v", lineNumber, err))
+				continue
+			}
+
+			for _, field := range point.Fields {
+				series := labels.Series(MetricName(point.Measurement, field.Key), point.Tags)
+				switch {
+				case field.Kind == KindString:
+				case field.Kind == KindInteger && isCounter(labels.Name(series)):
+					store.UpdateCounter(series, int64(math.Round(tracker.Delta(series, field.Value))))
+				case point.Time.IsZero():
+					store.UpdateGauge(series, field.Value)
+				default:
+					store.UpdateGaugeAt(series, field.Value, point.Time)
+				}
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			http.Error(w, logger.ErrInfluxRead, http.StatusBadRequest)
+			log.Printf(logger.LogDefaultFormat, logger.ErrInfluxRead, err)
+			return
+		}
+
+		if len(failed) > 0 {
+			message := logger.ErrInfluxParse + ": " + strings.Join(failed, "; ")
+			http.Error(w, message, http.StatusBadRequest)
+			log.Println(message)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,83 @@
+package influx
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/avointsev/yp7m-go/internal/server/storage"
+)
+
+func TestParseLine(t *testing.T) {
+	point, err := ParseLine(`disk\ io,host=web\,1,dev=sda read_bytes=10i,busy=0.5,ok=t,msg="a b,c" 1700000000`, "s")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if point.Measurement != "disk io" {
+		t.Errorf("expected escaped measurement, got %q", point.Measurement)
+	}
+	if point.Tags["host"] != "web,1" || point.Tags["dev"] != "sda" {
+		t.Errorf("unexpected tags %v", point.Tags)
+	}
+	if len(point.Fields) != 4 {
+		t.Fatalf("expected 4 fields, got %+v", point.Fields)
+	}
+	if point.Fields[0] != (Field{Key: "read_bytes", Value: 10, Kind: KindInteger}) {
+		t.Errorf("unexpected integer field %+v", point.Fields[0])
+	}
+	if point.Fields[3].Kind != KindString {
+		t.Errorf("expected string field, got %+v", point.Fields[3])
+	}
+	if !point.Time.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("unexpected timestamp %v", point.Time)
+	}
+
+	for _, line := range []string{"cpu", "cpu value", "cpu,host value=1", "cpu value=1x"} {
+		if _, err := ParseLine(line, ""); err == nil {
+			t.Errorf("expected error for %q", line)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	store := storage.NewMemStorage()
+	handler := Handler(store, []string{"net_bytes_*"})
+
+	write := func(body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/write", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec.Code
+	}
+
+	body := "cpu,host=a usage=12.5,procs=3i\nnet,host=a bytes_recv=100i\ntemp value=21.5\n"
+	if code := write(body); code != http.StatusNoContent {
+		t.Fatalf("expected status %v, got %v", http.StatusNoContent, code)
+	}
+	if code := write("net,host=a bytes_recv=160i\n"); code != http.StatusNoContent {
+		t.Fatalf("expected status %v, got %v", http.StatusNoContent, code)
+	}
+
+	if value, _ := store.GetMetric(storage.Gauge, `cpu_usage{host="a"}`); value != 12.5 {
+		t.Errorf("expected gauge 12.5, got %v", value)
+	}
+	if value, _ := store.GetMetric(storage.Gauge, `cpu_procs{host="a"}`); value != 3.0 {
+		t.Errorf("expected integer gauge 3, got %v", value)
+	}
+	if value, _ := store.GetMetric(storage.Counter, `net_bytes_recv{host="a"}`); value != int64(60) {
+		t.Errorf("expected increase 60 after the baseline reading, got %v", value)
+	}
+	if value, _ := store.GetMetric(storage.Gauge, "temp"); value != 21.5 {
+		t.Errorf("expected value field as bare measurement, got %v", value)
+	}
+
+	if code := write("good value=1\nbad\n"); code != http.StatusBadRequest {
+		t.Errorf("expected status %v for invalid line, got %v", http.StatusBadRequest, code)
+	}
+	if value, _ := store.GetMetric(storage.Gauge, "good"); value != 1.0 {
+		t.Errorf("expected valid lines to be stored despite errors, got %v", value)
+	}
+}
@@ -0,0 +1,170 @@
+package influx
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Field value kinds of the line protocol.
+const (
+	KindFloat = iota
+	KindInteger
+	KindBool
+	KindString
+)
+
+var errInvalidLine = errors.New("invalid line protocol")
+
+// Field is a single field of a point.
+type Field struct {
+	Key   string
+	Value float64
+	Kind  int
+}
+
+// Point is a parsed line: measurement, tags, fields and an optional timestamp.
+type Point struct {
+	Time        time.Time
+	Tags        map[string]string
+	Measurement string
+	Fields      []Field
+}
+
+// ParseLine parses a single line such as
+// `cpu,host=a usage_idle=92.5,procs=12i 1700000000000000000`.
+// Timestamps are nanoseconds unless precision is one of s, ms or us.
+func ParseLine(line, precision string) (Point, error) {
+	seriesPart, rest, ok := cutUnescaped(line, ' ')
+	if !ok {
+		return Point{}, errInvalidLine
+	}
+	fieldPart, timePart, _ := cutUnescaped(strings.TrimLeft(rest, " "), ' ')
+
+	var point Point
+	parts := splitUnescaped(seriesPart, ',')
+	point.Measurement = unescape(parts[0])
+	if point.Measurement == "" {
+		return Point{}, errInvalidLine
+	}
+	point.Tags = make(map[string]string, len(parts)-1)
+	for _, tag := range parts[1:] {
+		key, value, ok := cutUnescaped(tag, '=')
+		if !ok || key == "" {
+			return Point{}, errInvalidLine
+		}
+		point.Tags[unescape(key)] = unescape(value)
+	}
+
+	for _, field := range splitUnescaped(fieldPart, ',') {
+		key, raw, ok := cutUnescaped(field, '=')
+		if !ok || key == "" || raw == "" {
+			return Point{}, errInvalidLine
+		}
+		f, err := parseFieldValue(raw)
+		if err != nil {
+			return Point{}, err
+		}
+		f.Key = unescape(key)
+		point.Fields = append(point.Fields, f)
+	}
+	if len(point.Fields) == 0 {
+		return Point{}, errInvalidLine
+	}
+
+	if timePart = strings.TrimSpace(timePart); timePart != "" {
+		ts, err := strconv.ParseInt(timePart, 10, 64)
+		if err != nil {
+			return Point{}, errInvalidLine
+		}
+		point.Time = timestamp(ts, precision)
+	}
+	return point, nil
+}
+
+func parseFieldValue(raw string) (Field, error) {
+	switch {
+	case strings.HasPrefix(raw, `"`):
+		return Field{Kind: KindString}, nil
+	case raw == "t" || raw == "T" || raw == "true" || raw == "True" || raw == "TRUE":
+		return Field{Kind: KindBool, Value: 1}, nil
+	case raw == "f" || raw == "F" || raw == "false" || raw == "False" || raw == "FALSE":
+		return Field{Kind: KindBool, Value: 0}, nil
+	case strings.HasSuffix(raw, "i"):
+		v, err := strconv.ParseInt(raw[:len(raw)-1], 10, 64)
+		if err != nil {
+			return Field{}, errInvalidLine
+		}
+		return Field{Kind: KindInteger, Value: float64(v)}, nil
+	case strings.HasSuffix(raw, "u"):
+		v, err := strconv.ParseUint(raw[:len(raw)-1], 10, 64)
+		if err != nil {
+			return Field{}, errInvalidLine
+		}
+		return Field{Kind: KindInteger, Value: float64(v)}, nil
+	default:
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return Field{}, errInvalidLine
+		}
+		return Field{Kind: KindFloat, Value: v}, nil
+	}
+}
+
+func timestamp(ts int64, precision string) time.Time {
+	switch precision {
+	case "s":
+		return time.Unix(ts, 0)
+	case "ms":
+		return time.UnixMilli(ts)
+	case "us":
+		return time.UnixMicro(ts)
+	default:
+		return time.Unix(0, ts)
+	}
+}
+
+// cutUnescaped splits s around the first sep not preceded by a backslash or inside quotes.
+func cutUnescaped(s string, sep byte) (string, string, bool) {
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			quoted = !quoted
+		case sep:
+			if !quoted {
+				return s[:i], s[i+1:], true
+			}
+		}
+	}
+	return s, "", false
+}
+
+func splitUnescaped(s string, sep byte) []string {
+	var parts []string
+	for {
+		part, rest, ok := cutUnescaped(s, sep)
+		parts = append(parts, part)
+		if !ok {
+			return parts
+		}
+		s = rest
+	}
+}
+
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,291 @@
+// Package notify delivers alert state changes to webhooks. Alerts that fire
+// or resolve in the same evaluation are grouped into one payload per status,
+// firing alerts are repeated only after the repeat interval, and failed
+// deliveries are retried with exponential backoff and then again after the
+// next evaluation. Every webhook is served by its own worker.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/avointsev/yp7m-go/internal/logger"
+	"github.com/avointsev/yp7m-go/internal/server/alerts"
+)
+
+const (
+	// DefaultRepeat is how often a still-firing alert is notified again.
+	DefaultRepeat = 4 * time.Hour
+	// DefaultRetries is how many times a failed delivery is retried.
+	DefaultRetries = 3
+
+	queueSize      = 64
+	initialBackoff = time.Second
+	requestTimeout = 10 * time.Second
+)
+
+// Payload is the JSON body posted to webhooks.
+type Payload struct {
+	Status alerts.State   `json:"status"`
+	SentAt time.Time      `json:"sent_at"`
+	Alerts []alerts.Alert `json:"alerts"`
+}
+
+// sent remembers the last notification of a firing alert.
+type sent struct {
+	firedAt time.Time
+	at      time.Time
+}
+
+// target is one webhook. Each target is served by its own worker with its own
+// record of delivered alerts, so a slow or failing webhook does not hold back
+// the others and does not suppress notifications it never received.
+type target struct {
+	url     string
+	sent    map[string]sent
+	latest  []alerts.Alert
+	pending bool
+	wake    chan struct{}
+	stop    context.CancelFunc
+	mu      sync.Mutex
+}
+
+func newTarget(url string) *target {
+	return &target{
+		url:  url,
+		sent: make(map[string]sent),
+		wake: make(chan struct{}, 1),
+	}
+}
+
+// offer replaces the alerts waiting for the worker with list.
+func (t *target) offer(list []alerts.Alert) {
+	t.mu.Lock()
+	t.latest, t.pending = list, true
+	t.mu.Unlock()
+	select {
+	case t.wake <- struct{}{}:
+	default:
+	}
+}
+
+// take returns the alerts offered since the last call, if any.
+func (t *target) take() ([]alerts.Alert, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	list, pending := t.latest, t.pending
+	t.latest, t.pending = nil, false
+	return list, pending
+}
+
+// Notifier decides which alert changes to send and delivers them.
+type Notifier struct {
+	client  *http.Client
+	queue   chan []alerts.Alert
+	targets map[string]*target
+	urls    []string
+	repeat  time.Duration
+	retries int
+	backoff time.Duration
+	now     func() time.Time
+	mu      sync.Mutex
+}
+
+// New creates a notifier posting to urls.
+func New(urls []string, repeat time.Duration, retries int) *Notifier {
+	return &Notifier{
+		client:  &http.Client{Timeout: requestTimeout},
+		queue:   make(chan []alerts.Alert, queueSize),
+		targets: make(map[string]*target),
+		urls:    urls,
+		repeat:  repeat,
+		retries: retries,
+		backoff: initialBackoff,
+		now:     time.Now,
+	}
+}
+
+// Configure replaces the webhook URLs, repeat interval and retry count.
+func (n *Notifier) Configure(urls []string, repeat time.Duration, retries int) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.urls, n.repeat, n.retries = urls, repeat, retries
+}
+
+// Notify passes the state of every alert to the webhook workers. It never
+// blocks; a list is dropped when the queue is full, and the changes it carried
+// are sent with the next one.
+func (n *Notifier) Notify(list []alerts.Alert) {
+	select {
+	case n.queue <- list:
+	default:
+		log.Printf("%s: queue full, dropped %d alerts", logger.ErrWebhookSend, len(list))
+	}
+}
+
+// changes groups the alerts t has to be sent by status. Nothing is recorded
+// until record is called for a delivered payload.
+func (n *Notifier) changes(t *target, list []alerts.Alert) []Payload {
+	n.mu.Lock()
+	repeat := n.repeat
+	n.mu.Unlock()
+
+	now := n.now()
+	known := make(map[string]bool, len(list))
+	for _, a := range list {
+		known[a.Name] = true
+	}
+	for name := range t.sent {
+		if !known[name] {
+			delete(t.sent, name)
+		}
+	}
+
+	firing := Payload{Status: alerts.Firing, SentAt: now}
+	resolved := Payload{Status: alerts.Resolved, SentAt: now}
+	for _, a := range list {
+		last, notified := t.sent[a.Name]
+		switch a.State {
+		case alerts.Firing:
+			if notified && last.firedAt.Equal(*a.FiredAt) && now.Sub(last.at) < repeat {
+				continue
+			}
+			firing.Alerts = append(firing.Alerts, a)
+		case alerts.Resolved:
+			if notified {
+				resolved.Alerts = append(resolved.Alerts, a)
+			}
+		}
+	}
+
+	var payloads []Payload
+	for _, p := range []Payload{firing, resolved} {
+		if len(p.Alerts) > 0 {
+			payloads = append(payloads, p)
+		}
+	}
+	return payloads
+}
+
+// record marks the alerts of a payload delivered to t.
+func (n *Notifier) record(t *target, p Payload) {
+	for _, a := range p.Alerts {
+		if p.Status == alerts.Firing {
+			t.sent[a.Name] = sent{firedAt: *a.FiredAt, at: p.SentAt}
+		} else {
+			delete(t.sent, a.Name)
+		}
+	}
+}
+
+// Run hands the alert states to one worker per webhook until ctx is cancelled.
+func (n *Notifier) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case list := <-n.queue:
+			n.mu.Lock()
+			urls := n.urls
+			n.mu.Unlock()
+			for _, t := range n.sync(ctx, urls) {
+				t.offer(list)
+			}
+		}
+	}
+}
+
+// sync starts a worker for every new URL, stops the workers of removed ones
+// and returns the current targets.
+func (n *Notifier) sync(ctx context.Context, urls []string) []*target {
+	current := make(map[string]bool, len(urls))
+	targets := make([]*target, 0, len(urls))
+	for _, url := range urls {
+		current[url] = true
+		t, ok := n.targets[url]
+		if !ok {
+			t = newTarget(url)
+			var workerCtx context.Context
+			workerCtx, t.stop = context.WithCancel(ctx)
+			n.targets[url] = t
+			go n.work(workerCtx, t)
+		}
+		targets = append(targets, t)
+	}
+	for url, t := range n.targets {
+		if !current[url] {
+			t.stop()
+			delete(n.targets, url)
+		}
+	}
+	return targets
+}
+
+// work delivers the changes of the latest alert states offered to t.
+func (n *Notifier) work(ctx context.Context, t *target) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.wake:
+		}
+		list, ok := t.take()
+		if !ok {
+			continue
+		}
+		n.mu.Lock()
+		retries := n.retries
+		n.mu.Unlock()
+		for _, p := range n.changes(t, list) {
+			if err := n.deliver(ctx, t.url, p, retries); err != nil {
+				log.Printf("%s to %s: %v", logger.ErrWebhookSend, t.url, err)
+				continue
+			}
+			n.record(t, p)
+		}
+	}
+}
+
+// deliver posts p to url, retrying failures with exponential backoff.
+func (n *Notifier) deliver(ctx context.Context, url string, p Payload, retries int) error {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	backoff := n.backoff
+	for attempt := 0; ; attempt++ {
+		err = n.post(ctx, url, body)
+		if err == nil || attempt >= retries {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (n *Notifier) post(ctx context.Context, url string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s: %d", logger.ErrWebhookResponse, resp.StatusCode)
+	}
+	return nil
+}
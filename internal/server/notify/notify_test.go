@@ -0,0 +1,165 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/avointsev/yp7m-go/internal/server/alerts"
+)
+
+func alert(name string, state alerts.State, firedAt time.Time) alerts.Alert {
+	a := alerts.Alert{Rule: alerts.Rule{Name: name}, State: state, FiredAt: &firedAt}
+	if state == alerts.Resolved {
+		a.ResolvedAt = &firedAt
+	}
+	return a
+}
+
+func TestChanges(t *testing.T) {
+	n := New(nil, time.Hour, 0)
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	n.now = func() time.Time { return now }
+	fired := now
+	target := newTarget("http://example.com/hook")
+	deliver := func(list ...alerts.Alert) []Payload {
+		payloads := n.changes(target, list)
+		for _, p := range payloads {
+			n.record(target, p)
+		}
+		return payloads
+	}
+
+	payloads := deliver(
+		alert("a", alerts.Firing, fired),
+		alert("b", alerts.Firing, fired),
+		alert("c", alerts.Resolved, fired),
+		alerts.Alert{Rule: alerts.Rule{Name: "d"}, State: alerts.Pending},
+	)
+	if len(payloads) != 1 || payloads[0].Status != alerts.Firing || len(payloads[0].Alerts) != 2 {
+		t.Fatalf("expected one grouped firing payload, got %+v", payloads)
+	}
+
+	now = now.Add(time.Minute)
+	if payloads := deliver(alert("a", alerts.Firing, fired), alert("b", alerts.Firing, fired)); len(payloads) != 0 {
+		t.Errorf("expected duplicates to be suppressed, got %+v", payloads)
+	}
+
+	now = now.Add(time.Hour)
+	payloads = deliver(alert("a", alerts.Firing, fired), alert("b", alerts.Resolved, now))
+	if len(payloads) != 2 || len(payloads[0].Alerts) != 1 || payloads[1].Status != alerts.Resolved {
+		t.Fatalf("expected a repeat and a resolution, got %+v", payloads)
+	}
+	if payloads := deliver(alert("a", alerts.Firing, fired), alert("b", alerts.Resolved, now)); len(payloads) != 0 {
+		t.Errorf("expected resolution to be sent once, got %+v", payloads)
+	}
+}
+
+func TestChangesRetryUndelivered(t *testing.T) {
+	n := New(nil, time.Hour, 0)
+	fired := time.Now()
+	target := newTarget("http://example.com/hook")
+
+	list := []alerts.Alert{alert("a", alerts.Firing, fired)}
+	if payloads := n.changes(target, list); len(payloads) != 1 {
+		t.Fatalf("expected a firing payload, got %+v", payloads)
+	}
+	payloads := n.changes(target, list)
+	if len(payloads) != 1 {
+		t.Fatalf("expected an undelivered alert to be sent again, got %+v", payloads)
+	}
+	n.record(target, payloads[0])
+
+	list = []alerts.Alert{alert("a", alerts.Resolved, fired)}
+	if payloads := n.changes(target, list); len(payloads) != 1 || payloads[0].Status != alerts.Resolved {
+		t.Fatalf("expected a resolution, got %+v", payloads)
+	}
+	if payloads := n.changes(target, list); len(payloads) != 1 {
+		t.Errorf("expected an undelivered resolution to be sent again, got %+v", payloads)
+	}
+}
+
+func TestRunRetriesAndDeliversToSink(t *testing.T) {
+	sink := NewSink()
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		sink.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	n := New([]string{server.URL + SinkPath}, time.Hour, 2)
+	n.backoff = time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go n.Run(ctx)
+
+	n.Notify([]alerts.Alert{alert("HighHeap", alerts.Firing, time.Now())})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		rec := httptest.NewRecorder()
+		sink.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, SinkPath, http.NoBody))
+		var payloads []Payload
+		if err := json.Unmarshal(rec.Body.Bytes(), &payloads); err != nil {
+			t.Fatalf("could not decode sink: %v", err)
+		}
+		if len(payloads) == 1 {
+			if payloads[0].Status != alerts.Firing || payloads[0].Alerts[0].Name != "HighHeap" {
+				t.Errorf("unexpected payload %+v", payloads[0])
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected delivery after retry, got %d calls", calls.Load())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("expected 2 delivery attempts, got %d", calls.Load())
+	}
+}
+
+func TestDeadWebhookDoesNotBlockOthers(t *testing.T) {
+	release := make(chan struct{})
+	dead := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer dead.Close()
+	defer close(release)
+
+	delivered := make(chan struct{}, 1)
+	alive := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		delivered <- struct{}{}
+	}))
+	defer alive.Close()
+
+	n := New([]string{dead.URL, alive.URL}, time.Hour, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go n.Run(ctx)
+
+	n.Notify([]alerts.Alert{alert("HighHeap", alerts.Firing, time.Now())})
+	select {
+	case <-delivered:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected delivery to the live webhook while the other one hangs")
+	}
+}
+
+func TestSinkRejectsInvalidJSON(t *testing.T) {
+	rec := httptest.NewRecorder()
+	NewSink().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, SinkPath, strings.NewReader("{")))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status %v; got %v", http.StatusBadRequest, rec.Code)
+	}
+}
@@ -0,0 +1,57 @@
+package notify
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/avointsev/yp7m-go/internal/logger"
+)
+
+// SinkPath is where the server mounts the test sink.
+const SinkPath = "/webhook/sink"
+
+// sinkSize is how many payloads the sink keeps.
+const sinkSize = 100
+
+// Sink is a local webhook receiver for testing notifications. POST records a
+// payload and GET lists the most recent ones.
+type Sink struct {
+	payloads []json.RawMessage
+	mu       sync.Mutex
+}
+
+// NewSink creates an empty sink.
+func NewSink() *Sink {
+	return &Sink{}
+}
+
+func (s *Sink) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		var payload json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, logger.ErrMetricInvalidJSON, http.StatusBadRequest)
+			return
+		}
+		s.mu.Lock()
+		s.payloads = append(s.payloads, payload)
+		if len(s.payloads) > sinkSize {
+			s.payloads = s.payloads[len(s.payloads)-sinkSize:]
+		}
+		s.mu.Unlock()
+		log.Printf("%s: %s", logger.OkWebhookSinkRx, payload)
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodGet:
+		s.mu.Lock()
+		payloads := append([]json.RawMessage{}, s.payloads...)
+		s.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(payloads); err != nil {
+			log.Printf(logger.LogDefaultFormat, logger.ErrWriteResponce, err)
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,198 @@
+package otlp
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/avointsev/yp7m-go/internal/labels"
+)
+
+// jsonInt accepts 64-bit integers encoded either as JSON numbers or, as the
+// protobuf JSON mapping requires, as strings.
+type jsonInt int64
+
+func (i *jsonInt) UnmarshalJSON(data []byte) error {
+	v, err := strconv.ParseInt(strings.Trim(string(data), `"`), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid integer %s: %w", data, err)
+	}
+	*i = jsonInt(v)
+	return nil
+}
+
+// jsonTemporality accepts the enum as a number or by name.
+type jsonTemporality Temporality
+
+func (t *jsonTemporality) UnmarshalJSON(data []byte) error {
+	switch strings.Trim(string(data), `"`) {
+	case "1", "AGGREGATION_TEMPORALITY_DELTA":
+		*t = jsonTemporality(TemporalityDelta)
+	case "2", "AGGREGATION_TEMPORALITY_CUMULATIVE":
+		*t = jsonTemporality(TemporalityCumulative)
+	default:
+		*t = jsonTemporality(TemporalityUnspecified)
+	}
+	return nil
+}
+
+type jsonRequest struct {
+	ResourceMetrics []struct {
+		Resource struct {
+			Attributes []jsonKeyValue `json:"attributes"`
+		} `json:"resource"`
+		ScopeMetrics []struct {
+			Metrics []jsonMetric `json:"metrics"`
+		} `json:"scopeMetrics"`
+	} `json:"resourceMetrics"`
+}
+
+type jsonKeyValue struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue *string  `json:"stringValue"`
+		BoolValue   *bool    `json:"boolValue"`
+		IntValue    *jsonInt `json:"intValue"`
+		DoubleValue *float64 `json:"doubleValue"`
+		BytesValue  []byte   `json:"bytesValue"`
+	} `json:"value"`
+}
+
+type jsonMetric struct {
+	Name  string `json:"name"`
+	Gauge *struct {
+		DataPoints []jsonNumberPoint `json:"dataPoints"`
+	} `json:"gauge"`
+	Sum *struct {
+		DataPoints             []jsonNumberPoint `json:"dataPoints"`
+		AggregationTemporality jsonTemporality   `json:"aggregationTemporality"`
+		IsMonotonic            bool              `json:"isMonotonic"`
+	} `json:"sum"`
+	Histogram *struct {
+		DataPoints             []jsonHistogramPoint `json:"dataPoints"`
+		AggregationTemporality jsonTemporality      `json:"aggregationTemporality"`
+	} `json:"histogram"`
+	ExponentialHistogram *jsonUnsupported `json:"exponentialHistogram"`
+	Summary              *jsonUnsupported `json:"summary"`
+}
+
+type jsonNumberPoint struct {
+	Attributes   []jsonKeyValue `json:"attributes"`
+	TimeUnixNano jsonInt        `json:"timeUnixNano"`
+	AsDouble     *float64       `json:"asDouble"`
+	AsInt        *jsonInt       `json:"asInt"`
+	Flags        uint32         `json:"flags"`
+}
+
+type jsonHistogramPoint struct {
+	Attributes     []jsonKeyValue `json:"attributes"`
+	TimeUnixNano   jsonInt        `json:"timeUnixNano"`
+	Count          jsonInt        `json:"count"`
+	Sum            float64        `json:"sum"`
+	BucketCounts   []jsonInt      `json:"bucketCounts"`
+	ExplicitBounds []float64      `json:"explicitBounds"`
+	Flags          uint32         `json:"flags"`
+}
+
+type jsonUnsupported struct {
+	DataPoints []json.RawMessage `json:"dataPoints"`
+}
+
+// DecodeJSON parses an ExportMetricsServiceRequest in the OTLP JSON encoding.
+func DecodeJSON(data []byte) (Request, error) {
+	var raw jsonRequest
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return Request{}, fmt.Errorf("decode OTLP JSON: %w", err)
+	}
+
+	var req Request
+	for _, rm := range raw.ResourceMetrics {
+		resource := Resource{Attributes: jsonAttributes(rm.Resource.Attributes)}
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				resource.Metrics = append(resource.Metrics, m.metric())
+			}
+		}
+		req.Resources = append(req.Resources, resource)
+	}
+	return req, nil
+}
+
+func (m jsonMetric) metric() Metric {
+	metric := Metric{Name: m.Name}
+	switch {
+	case m.Gauge != nil:
+		metric.Kind = KindGauge
+		metric.Points = jsonNumberPoints(m.Gauge.DataPoints)
+	case m.Sum != nil:
+		metric.Kind = KindSum
+		metric.Temporality = Temporality(m.Sum.AggregationTemporality)
+		metric.Monotonic = m.Sum.IsMonotonic
+		metric.Points = jsonNumberPoints(m.Sum.DataPoints)
+	case m.Histogram != nil:
+		metric.Kind = KindHistogram
+		metric.Temporality = Temporality(m.Histogram.AggregationTemporality)
+		for _, p := range m.Histogram.DataPoints {
+			point := Point{
+				Attributes:   jsonAttributes(p.Attributes),
+				TimeUnixNano: uint64(p.TimeUnixNano),
+				Flags:        p.Flags,
+				Count:        uint64(p.Count),
+				Sum:          p.Sum,
+				Bounds:       p.ExplicitBounds,
+			}
+			for _, c := range p.BucketCounts {
+				point.BucketCounts = append(point.BucketCounts, uint64(c))
+			}
+			metric.Points = append(metric.Points, point)
+		}
+	case m.ExponentialHistogram != nil:
+		metric.Points = make([]Point, len(m.ExponentialHistogram.DataPoints))
+	case m.Summary != nil:
+		metric.Points = make([]Point, len(m.Summary.DataPoints))
+	}
+	return metric
+}
+
+func jsonNumberPoints(points []jsonNumberPoint) []Point {
+	out := make([]Point, 0, len(points))
+	for _, p := range points {
+		point := Point{
+			Attributes:   jsonAttributes(p.Attributes),
+			TimeUnixNano: uint64(p.TimeUnixNano),
+			Flags:        p.Flags,
+		}
+		switch {
+		case p.AsDouble != nil:
+			point.Value = *p.AsDouble
+		case p.AsInt != nil:
+			point.Value = float64(*p.AsInt)
+		}
+		out = append(out, point)
+	}
+	return out
+}
+
+// jsonAttributes converts scalar attributes to labels. Array and key-value
+// list values have no label representation and are dropped.
+func jsonAttributes(attrs []jsonKeyValue) labels.Labels {
+	l := make(labels.Labels, len(attrs))
+	for _, kv := range attrs {
+		v := kv.Value
+		switch {
+		case v.StringValue != nil:
+			l[kv.Key] = *v.StringValue
+		case v.BoolValue != nil:
+			l[kv.Key] = strconv.FormatBool(*v.BoolValue)
+		case v.IntValue != nil:
+			l[kv.Key] = strconv.FormatInt(int64(*v.IntValue), 10)
+		case v.DoubleValue != nil:
+			l[kv.Key] = strconv.FormatFloat(*v.DoubleValue, 'g', -1, 64)
+		case v.BytesValue != nil:
+			l[kv.Key] = base64.StdEncoding.EncodeToString(v.BytesValue)
+		}
+	}
+	return l
+}
@@ -0,0 +1,62 @@
+package otlp
+
+import (
+	"github.com/avointsev/yp7m-go/internal/labels"
+)
+
+// Kind is the data type of an OTLP metric.
+type Kind int
+
+const (
+	KindUnsupported Kind = iota
+	KindGauge
+	KindSum
+	KindHistogram
+)
+
+// Temporality is the OTLP aggregation temporality of sums and histograms.
+type Temporality int
+
+const (
+	TemporalityUnspecified Temporality = iota
+	TemporalityDelta
+	TemporalityCumulative
+)
+
+// flagNoRecordedValue marks a data point that carries no value.
+const flagNoRecordedValue = 1
+
+// Request is the decoded content of an ExportMetricsServiceRequest. Both the
+// protobuf and the JSON encoding decode into it.
+type Request struct {
+	Resources []Resource
+}
+
+// Resource holds the metrics reported by one resource, such as a service instance.
+type Resource struct {
+	Attributes labels.Labels
+	Metrics    []Metric
+}
+
+// Metric is a single OTLP metric. Points of unsupported kinds are kept only
+// to be counted as rejected.
+type Metric struct {
+	Name        string
+	Kind        Kind
+	Temporality Temporality
+	Monotonic   bool
+	Points      []Point
+}
+
+// Point is a number or histogram data point. BucketCounts are per bucket, not
+// cumulative, and have one more entry than Bounds for the overflow bucket.
+type Point struct {
+	Attributes   labels.Labels
+	TimeUnixNano uint64
+	Value        float64
+	Flags        uint32
+	Count        uint64
+	Sum          float64
+	BucketCounts []uint64
+	Bounds       []float64
+}
@@ -0,0 +1,271 @@
+// Package otlp receives metrics sent with the OpenTelemetry OTLP/HTTP protocol.
+package otlp
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"math"
+	"mime"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/avointsev/yp7m-go/internal/cumulative"
+	"github.com/avointsev/yp7m-go/internal/labels"
+	"github.com/avointsev/yp7m-go/internal/logger"
+	"github.com/avointsev/yp7m-go/internal/server/storage"
+)
+
+const (
+	contentTypeProto = "application/x-protobuf"
+	contentTypeJSON  = "application/json"
+)
+
+// maxBodySize limits the request body both as sent and after gzip decompression.
+const maxBodySize = 8 << 20
+
+var errBodyTooLarge = errors.New("body exceeds size limit")
+
+// Receiver applies OTLP metrics to storage. Cumulative sums and histograms are
+// converted to the deltas the additive storage expects; the first cumulative
+// point of a series is only a baseline.
+type Receiver struct {
+	store      storage.StorageType
+	tracker    *cumulative.Tracker
+	remainders map[string]float64
+	mu         sync.Mutex
+}
+
+// NewReceiver creates a receiver writing into store.
+func NewReceiver(store storage.StorageType) *Receiver {
+	return &Receiver{
+		store:      store,
+		tracker:    cumulative.New(),
+		remainders: make(map[string]float64),
+	}
+}
+
+// Handler serves POST /v1/metrics in both the protobuf and the JSON encoding,
+// optionally gzip-compressed. The response uses the request encoding.
+func Handler(store storage.StorageType) http.HandlerFunc {
+	receiver := NewReceiver(store)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if contentType != contentTypeProto && contentType != contentTypeJSON {
+			http.Error(w, logger.ErrOTLPContentType, http.StatusUnsupportedMediaType)
+			return
+		}
+
+		body, err := readBody(w, r)
+		if errors.Is(err, errBodyTooLarge) {
+			http.Error(w, logger.ErrOTLPTooLarge, http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			http.Error(w, logger.ErrOTLPRead, http.StatusBadRequest)
+			log.Printf(logger.LogDefaultFormat, logger.ErrOTLPRead, err)
+			return
+		}
+
+		var req Request
+		if contentType == contentTypeProto {
+			req, err = DecodeProto(body)
+		} else {
+			req, err = DecodeJSON(body)
+		}
+		if err != nil {
+			http.Error(w, logger.ErrOTLPDecode, http.StatusBadRequest)
+			log.Printf(logger.LogDefaultFormat, logger.ErrOTLPDecode, err)
+			return
+		}
+
+		rejected := receiver.Apply(req)
+		message := ""
+		if rejected > 0 {
+			message = fmt.Sprintf("%s: %d", logger.ErrOTLPRejected, rejected)
+			log.Println(message)
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		if contentType == contentTypeProto {
+			_, err = w.Write(encodeResponse(rejected, message))
+		} else {
+			err = json.NewEncoder(w).Encode(jsonResponse(rejected, message))
+		}
+		if err != nil {
+			log.Printf(logger.LogDefaultFormat, logger.ErrWriteResponce, err)
+		}
+	}
+}
+
+// readBody reads the request body, decompressing gzip. Both the compressed
+// and the decompressed stream are limited to maxBodySize.
+func readBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	var body io.Reader = http.MaxBytesReader(w, r.Body, maxBodySize)
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, fmt.Errorf("open gzip body: %w", tooLarge(err))
+		}
+		defer func() {
+			_ = gz.Close()
+		}()
+		body = gz
+	}
+	data, err := io.ReadAll(io.LimitReader(body, maxBodySize+1))
+	if err != nil {
+		return nil, fmt.Errorf("read body: %w", tooLarge(err))
+	}
+	if len(data) > maxBodySize {
+		return nil, errBodyTooLarge
+	}
+	return data, nil
+}
+
+// tooLarge maps the error of an exhausted http.MaxBytesReader to errBodyTooLarge.
+func tooLarge(err error) error {
+	var maxBytes *http.MaxBytesError
+	if errors.As(err, &maxBytes) {
+		return errBodyTooLarge
+	}
+	return err
+}
+
+// jsonResponse builds an ExportMetricsServiceResponse in the JSON encoding.
+func jsonResponse(rejected int64, message string) map[string]any {
+	if rejected == 0 {
+		return map[string]any{}
+	}
+	return map[string]any{
+		"partialSuccess": map[string]any{
+			"rejectedDataPoints": rejected,
+			"errorMessage":       message,
+		},
+	}
+}
+
+// Apply stores every data point of req and returns the number of rejected
+// points. Resource attributes become labels, overridden by point attributes.
+// Gauges and non-monotonic sums are stored as gauges, monotonic sums as
+// counters and explicit-bucket histograms as histograms. Exponential
+// histograms and summaries are not supported and are rejected. NaN gauge and
+// sum points are skipped like staleness markers; infinite ones are rejected.
+func (r *Receiver) Apply(req Request) int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var rejected int64
+	for _, resource := range req.Resources {
+		for _, metric := range resource.Metrics {
+			for _, point := range metric.Points {
+				if metric.Kind == KindUnsupported || metric.Name == "" {
+					rejected++
+					continue
+				}
+				if point.Flags&flagNoRecordedValue != 0 {
+					continue
+				}
+				attrs := maps.Clone(resource.Attributes)
+				if attrs == nil {
+					attrs = make(labels.Labels)
+				}
+				maps.Copy(attrs, point.Attributes)
+				if err := r.applyPoint(metric, point, labels.Series(metric.Name, attrs)); err != nil {
+					rejected++
+				}
+			}
+		}
+	}
+	return rejected
+}
+
+var (
+	errHistogramBuckets = errors.New("bucket counts do not match bounds")
+	errNonFinite        = errors.New("value is not finite")
+)
+
+func (r *Receiver) applyPoint(metric Metric, point Point, series string) error {
+	if metric.Kind == KindGauge || metric.Kind == KindSum {
+		if math.IsNaN(point.Value) {
+			return nil
+		}
+		if math.IsInf(point.Value, 0) {
+			return errNonFinite
+		}
+	}
+	switch {
+	case metric.Kind == KindGauge:
+		r.setGauge(series, point.Value, point.TimeUnixNano)
+	case metric.Kind == KindSum && metric.Monotonic:
+		delta := point.Value
+		if metric.Temporality != TemporalityDelta {
+			delta = r.tracker.Delta(series, point.Value)
+		}
+		delta += r.remainders[series]
+		whole := math.Trunc(delta)
+		r.remainders[series] = delta - whole
+		r.store.UpdateCounter(series, int64(whole))
+	case metric.Kind == KindSum:
+		value := point.Value
+		if metric.Temporality == TemporalityDelta {
+			if current, err := r.store.GetMetric(string(storage.Gauge), series); err == nil {
+				if v, ok := current.(float64); ok {
+					value += v
+				}
+			}
+		}
+		r.setGauge(series, value, point.TimeUnixNano)
+	case metric.Kind == KindHistogram:
+		h, err := toHistogram(point)
+		if err != nil {
+			return err
+		}
+		if metric.Temporality != TemporalityDelta {
+			delta, ok := r.tracker.HistogramDelta(series, cumulative.Histogram(h))
+			if !ok {
+				return nil
+			}
+			h = storage.Histogram(delta)
+		}
+		return r.store.UpdateHistogram(series, h)
+	}
+	return nil
+}
+
+func (r *Receiver) setGauge(series string, value float64, timeUnixNano uint64) {
+	if timeUnixNano == 0 {
+		r.store.UpdateGauge(series, value)
+		return
+	}
+	r.store.UpdateGaugeAt(series, value, time.Unix(0, int64(timeUnixNano)))
+}
+
+// toHistogram converts per-bucket counts into the cumulative storage form.
+// The overflow bucket is represented by Count.
+func toHistogram(point Point) (storage.Histogram, error) {
+	if len(point.BucketCounts) != 0 && len(point.BucketCounts) != len(point.Bounds)+1 {
+		return storage.Histogram{}, errHistogramBuckets
+	}
+	h := storage.Histogram{
+		Bounds: point.Bounds,
+		Counts: make([]uint64, len(point.Bounds)),
+		Sum:    point.Sum,
+		Count:  point.Count,
+	}
+	if len(point.BucketCounts) == 0 {
+		h.Bounds, h.Counts = nil, nil
+		return h, nil
+	}
+	var total uint64
+	for i := range point.Bounds {
+		total += point.BucketCounts[i]
+		h.Counts[i] = total
+	}
+	return h, h.Validate()
+}
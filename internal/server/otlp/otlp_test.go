@@ -0,0 +1,216 @@
+package otlp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/avointsev/yp7m-go/internal/server/storage"
+)
+
+func post(t *testing.T, h http.Handler, contentType string, body []byte, gzipped bool) *httptest.ResponseRecorder {
+	t.Helper()
+	if gzipped {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		if _, err := gz.Write(body); err != nil {
+			t.Fatalf("could not compress: %v", err)
+		}
+		if err := gz.Close(); err != nil {
+			t.Fatalf("could not compress: %v", err)
+		}
+		body = buf.Bytes()
+	}
+	req := httptest.NewRequest(http.MethodPost, "/v1/metrics", bytes.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	if gzipped {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+const jsonBody = `{"resourceMetrics":[{
+  "resource":{"attributes":[{"key":"service.name","value":{"stringValue":"checkout"}}]},
+  "scopeMetrics":[{"metrics":[
+    {"name":"queue_size","gauge":{"dataPoints":[{"asInt":"7","timeUnixNano":"%d"}]}},
+    {"name":"requests","sum":{"aggregationTemporality":2,"isMonotonic":true,"dataPoints":[
+      {"asDouble":%g,"attributes":[{"key":"code","value":{"intValue":"200"}}]}]}},
+    {"name":"latency","histogram":{"aggregationTemporality":"AGGREGATION_TEMPORALITY_CUMULATIVE","dataPoints":[
+      {"count":"%d","sum":%g,"bucketCounts":["%d","%d","0"],"explicitBounds":[0.1,1]}]}},
+    {"name":"sizes","summary":{"dataPoints":[{}]}}
+  ]}]
+}]}`
+
+func TestHandlerJSON(t *testing.T) {
+	store := storage.NewMemStorage()
+	h := Handler(store)
+	now := time.Now()
+
+	body := []byte(fmt.Sprintf(jsonBody, now.UnixNano(), 10.5, 3, 1.5, 1, 2))
+	rec := post(t, h, "application/json", body, true)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %v; got %v (%s)", http.StatusOK, rec.Code, rec.Body)
+	}
+	if !strings.Contains(rec.Body.String(), `"rejectedDataPoints":1`) {
+		t.Errorf("expected the summary point to be rejected, got %s", rec.Body)
+	}
+
+	gauge := `queue_size{service.name="checkout"}`
+	if v, err := store.GetMetric(storage.Gauge, gauge); err != nil || v != 7.0 {
+		t.Errorf("expected gauge 7, got %v (%v)", v, err)
+	}
+
+	body = []byte(fmt.Sprintf(jsonBody, now.UnixNano(), 13.0, 5, 2.5, 2, 3))
+	if rec := post(t, h, "application/json", body, false); rec.Code != http.StatusOK {
+		t.Fatalf("expected status %v; got %v", http.StatusOK, rec.Code)
+	}
+
+	counter := `requests{code="200",service.name="checkout"}`
+	if v, err := store.GetMetric(storage.Counter, counter); err != nil || v != int64(2) {
+		t.Errorf("expected counter 2 from the increase over the baseline, got %v (%v)", v, err)
+	}
+	v, err := store.GetMetric(storage.HistogramType, `latency{service.name="checkout"}`)
+	hist, ok := v.(storage.Histogram)
+	if err != nil || !ok || hist.Count != 2 || hist.Counts[0] != 1 || hist.Counts[1] != 2 || hist.Sum != 1 {
+		t.Errorf("expected histogram of the increase over the baseline, got %+v (%v)", v, err)
+	}
+}
+
+func TestHandlerProto(t *testing.T) {
+	store := storage.NewMemStorage()
+	h := Handler(store)
+
+	attr := func(key, value string) []byte {
+		var anyValue, kv []byte
+		anyValue = protowire.AppendTag(anyValue, anyString, protowire.BytesType)
+		anyValue = protowire.AppendString(anyValue, value)
+		kv = protowire.AppendTag(kv, keyValueKey, protowire.BytesType)
+		kv = protowire.AppendString(kv, key)
+		kv = protowire.AppendTag(kv, keyValueValue, protowire.BytesType)
+		return protowire.AppendBytes(kv, anyValue)
+	}
+
+	var point []byte
+	point = protowire.AppendTag(point, numberAttrs, protowire.BytesType)
+	point = protowire.AppendBytes(point, attr("cpu", "0"))
+	point = protowire.AppendTag(point, numberAsDouble, protowire.Fixed64Type)
+	point = protowire.AppendFixed64(point, math.Float64bits(0.25))
+
+	var gauge []byte
+	gauge = protowire.AppendTag(gauge, dataPoints, protowire.BytesType)
+	gauge = protowire.AppendBytes(gauge, point)
+
+	var histPoint []byte
+	histPoint = protowire.AppendTag(histPoint, histogramCount, protowire.Fixed64Type)
+	histPoint = protowire.AppendFixed64(histPoint, 4)
+	histPoint = protowire.AppendTag(histPoint, histogramSum, protowire.Fixed64Type)
+	histPoint = protowire.AppendFixed64(histPoint, math.Float64bits(2))
+	var counts, bounds []byte
+	for _, c := range []uint64{1, 2, 1} {
+		counts = protowire.AppendFixed64(counts, c)
+	}
+	for _, b := range []float64{0.5, 1} {
+		bounds = protowire.AppendFixed64(bounds, math.Float64bits(b))
+	}
+	histPoint = protowire.AppendTag(histPoint, histogramBucketCounts, protowire.BytesType)
+	histPoint = protowire.AppendBytes(histPoint, counts)
+	histPoint = protowire.AppendTag(histPoint, histogramBounds, protowire.BytesType)
+	histPoint = protowire.AppendBytes(histPoint, bounds)
+
+	var histogram []byte
+	histogram = protowire.AppendTag(histogram, dataPoints, protowire.BytesType)
+	histogram = protowire.AppendBytes(histogram, histPoint)
+	histogram = protowire.AppendTag(histogram, aggregationTemporality, protowire.VarintType)
+	histogram = protowire.AppendVarint(histogram, uint64(TemporalityDelta))
+
+	metric := func(name string, kind protowire.Number, data []byte) []byte {
+		var m []byte
+		m = protowire.AppendTag(m, metricName, protowire.BytesType)
+		m = protowire.AppendString(m, name)
+		m = protowire.AppendTag(m, kind, protowire.BytesType)
+		return protowire.AppendBytes(m, data)
+	}
+
+	var scope []byte
+	scope = protowire.AppendTag(scope, scopeMetricsMetrics, protowire.BytesType)
+	scope = protowire.AppendBytes(scope, metric("cpu_usage", metricGauge, gauge))
+	scope = protowire.AppendTag(scope, scopeMetricsMetrics, protowire.BytesType)
+	scope = protowire.AppendBytes(scope, metric("duration", metricHistogram, histogram))
+
+	var resource []byte
+	resource = protowire.AppendTag(resource, resourceAttributes, protowire.BytesType)
+	resource = protowire.AppendBytes(resource, attr("host.name", "web1"))
+
+	var rm []byte
+	rm = protowire.AppendTag(rm, resourceMetricsResource, protowire.BytesType)
+	rm = protowire.AppendBytes(rm, resource)
+	rm = protowire.AppendTag(rm, resourceMetricsScopeMetrics, protowire.BytesType)
+	rm = protowire.AppendBytes(rm, scope)
+
+	var req []byte
+	req = protowire.AppendTag(req, requestResourceMetrics, protowire.BytesType)
+	req = protowire.AppendBytes(req, rm)
+
+	rec := post(t, h, "application/x-protobuf", req, false)
+	if rec.Code != http.StatusOK || rec.Body.Len() != 0 {
+		t.Fatalf("expected empty success response, got %v %q", rec.Code, rec.Body)
+	}
+	if v, err := store.GetMetric(storage.Gauge, `cpu_usage{cpu="0",host.name="web1"}`); err != nil || v != 0.25 {
+		t.Errorf("expected gauge 0.25, got %v (%v)", v, err)
+	}
+	v, err := store.GetMetric(storage.HistogramType, `duration{host.name="web1"}`)
+	if hist, ok := v.(storage.Histogram); err != nil || !ok || hist.Count != 4 || hist.Counts[1] != 3 {
+		t.Errorf("unexpected histogram %+v (%v)", v, err)
+	}
+
+	if rec := post(t, h, "application/x-protobuf", req[:len(req)-2], false); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status %v for truncated body; got %v", http.StatusBadRequest, rec.Code)
+	}
+	if rec := post(t, h, "text/plain", req, false); rec.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("expected status %v for text body; got %v", http.StatusUnsupportedMediaType, rec.Code)
+	}
+}
+
+func TestHandlerBodyLimit(t *testing.T) {
+	h := Handler(storage.NewMemStorage())
+	body := make([]byte, maxBodySize+1)
+
+	if rec := post(t, h, "application/json", body, false); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status %v for an oversized body; got %v", http.StatusRequestEntityTooLarge, rec.Code)
+	}
+	if rec := post(t, h, "application/json", body, true); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status %v for an oversized decompressed body; got %v", http.StatusRequestEntityTooLarge, rec.Code)
+	}
+}
+
+func TestApplyNonFinite(t *testing.T) {
+	store := storage.NewMemStorage()
+	receiver := NewReceiver(store)
+
+	req := Request{Resources: []Resource{{Metrics: []Metric{
+		{Name: "temp", Kind: KindGauge, Points: []Point{{Value: math.NaN()}}},
+		{Name: "load", Kind: KindGauge, Points: []Point{{Value: math.Inf(1)}}},
+		{Name: "hits", Kind: KindSum, Monotonic: true, Temporality: TemporalityDelta, Points: []Point{{Value: math.Inf(1)}}},
+	}}}}
+	if rejected := receiver.Apply(req); rejected != 2 {
+		t.Errorf("expected the infinite points to be rejected, got %d", rejected)
+	}
+	for _, name := range []string{"temp", "load"} {
+		if _, err := store.GetMetric(storage.Gauge, name); err == nil {
+			t.Errorf("expected non-finite gauge %s to be dropped", name)
+		}
+	}
+	if _, err := store.GetMetric(storage.Counter, "hits"); err == nil {
+		t.Error("expected infinite counter to be dropped")
+	}
+}
@@ -0,0 +1,279 @@
+package otlp
+
+import (
+	"encoding/base64"
+	"math"
+	"strconv"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/avointsev/yp7m-go/internal/labels"
+	"github.com/avointsev/yp7m-go/internal/protoutil"
+)
+
+// Field numbers from opentelemetry/proto/metrics/v1/metrics.proto and
+// opentelemetry/proto/common/v1/common.proto.
+const (
+	requestResourceMetrics = 1
+
+	resourceMetricsResource     = 1
+	resourceMetricsScopeMetrics = 2
+	resourceAttributes          = 1
+	scopeMetricsMetrics         = 2
+
+	metricName                 = 1
+	metricGauge                = 5
+	metricSum                  = 7
+	metricHistogram            = 9
+	metricExponentialHistogram = 10
+	metricSummary              = 11
+
+	dataPoints             = 1
+	aggregationTemporality = 2
+	sumIsMonotonic         = 3
+
+	numberTime     = 3
+	numberAsDouble = 4
+	numberAsInt    = 6
+	numberAttrs    = 7
+	numberFlags    = 8
+
+	histogramTime         = 3
+	histogramCount        = 4
+	histogramSum          = 5
+	histogramBucketCounts = 6
+	histogramBounds       = 7
+	histogramAttrs        = 9
+	histogramFlags        = 10
+
+	keyValueKey   = 1
+	keyValueValue = 2
+
+	anyString = 1
+	anyBool   = 2
+	anyInt    = 3
+	anyDouble = 4
+	anyBytes  = 7
+
+	partialSuccess         = 1
+	partialSuccessRejected = 1
+	partialSuccessMessage  = 2
+)
+
+type walkFunc = func(num protowire.Number, typ protowire.Type, value []byte) error
+
+// DecodeProto parses a protobuf-encoded ExportMetricsServiceRequest.
+func DecodeProto(data []byte) (Request, error) {
+	var req Request
+	err := protoutil.Walk(data, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		if num != requestResourceMetrics || typ != protowire.BytesType {
+			return nil
+		}
+		resource, err := decodeResourceMetrics(value)
+		req.Resources = append(req.Resources, resource)
+		return err
+	})
+	return req, err
+}
+
+func decodeResourceMetrics(data []byte) (Resource, error) {
+	resource := Resource{Attributes: make(labels.Labels)}
+	err := protoutil.Walk(data, bytesFields(func(num protowire.Number, value []byte) error {
+		switch num {
+		case resourceMetricsResource:
+			return protoutil.Walk(value, bytesFields(func(num protowire.Number, value []byte) error {
+				if num != resourceAttributes {
+					return nil
+				}
+				return decodeAttribute(value, resource.Attributes)
+			}))
+		case resourceMetricsScopeMetrics:
+			return protoutil.Walk(value, bytesFields(func(num protowire.Number, value []byte) error {
+				if num != scopeMetricsMetrics {
+					return nil
+				}
+				metric, err := decodeMetric(value)
+				resource.Metrics = append(resource.Metrics, metric)
+				return err
+			}))
+		}
+		return nil
+	}))
+	return resource, err
+}
+
+func decodeMetric(data []byte) (Metric, error) {
+	var metric Metric
+	err := protoutil.Walk(data, bytesFields(func(num protowire.Number, value []byte) error {
+		switch num {
+		case metricName:
+			metric.Name = string(value)
+		case metricGauge:
+			metric.Kind = KindGauge
+			return protoutil.Walk(value, metric.numberData)
+		case metricSum:
+			metric.Kind = KindSum
+			return protoutil.Walk(value, metric.numberData)
+		case metricHistogram:
+			metric.Kind = KindHistogram
+			return protoutil.Walk(value, metric.histogramData)
+		case metricExponentialHistogram, metricSummary:
+			metric.Kind = KindUnsupported
+			return protoutil.Walk(value, bytesFields(func(num protowire.Number, _ []byte) error {
+				if num == dataPoints {
+					metric.Points = append(metric.Points, Point{})
+				}
+				return nil
+			}))
+		}
+		return nil
+	}))
+	return metric, err
+}
+
+// numberData decodes a field of the Gauge or Sum message.
+func (m *Metric) numberData(num protowire.Number, typ protowire.Type, value []byte) error {
+	switch {
+	case num == dataPoints && typ == protowire.BytesType:
+		point, err := decodeNumberPoint(value)
+		m.Points = append(m.Points, point)
+		return err
+	case num == aggregationTemporality && typ == protowire.VarintType:
+		m.Temporality = Temporality(protoutil.Varint(value))
+	case num == sumIsMonotonic && typ == protowire.VarintType:
+		m.Monotonic = protoutil.Varint(value) != 0
+	}
+	return nil
+}
+
+// histogramData decodes a field of the Histogram message.
+func (m *Metric) histogramData(num protowire.Number, typ protowire.Type, value []byte) error {
+	switch {
+	case num == dataPoints && typ == protowire.BytesType:
+		point, err := decodeHistogramPoint(value)
+		m.Points = append(m.Points, point)
+		return err
+	case num == aggregationTemporality && typ == protowire.VarintType:
+		m.Temporality = Temporality(protoutil.Varint(value))
+	}
+	return nil
+}
+
+func decodeNumberPoint(data []byte) (Point, error) {
+	point := Point{Attributes: make(labels.Labels)}
+	err := protoutil.Walk(data, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		switch {
+		case num == numberTime && typ == protowire.Fixed64Type:
+			point.TimeUnixNano = protoutil.Fixed64(value)
+		case num == numberAsDouble && typ == protowire.Fixed64Type:
+			point.Value = protoutil.Double(value)
+		case num == numberAsInt && typ == protowire.Fixed64Type:
+			point.Value = float64(int64(protoutil.Fixed64(value)))
+		case num == numberAttrs && typ == protowire.BytesType:
+			return decodeAttribute(value, point.Attributes)
+		case num == numberFlags && typ == protowire.VarintType:
+			point.Flags = uint32(protoutil.Varint(value))
+		}
+		return nil
+	})
+	return point, err
+}
+
+func decodeHistogramPoint(data []byte) (Point, error) {
+	point := Point{Attributes: make(labels.Labels)}
+	err := protoutil.Walk(data, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		switch {
+		case num == histogramTime && typ == protowire.Fixed64Type:
+			point.TimeUnixNano = protoutil.Fixed64(value)
+		case num == histogramCount && typ == protowire.Fixed64Type:
+			point.Count = protoutil.Fixed64(value)
+		case num == histogramSum && typ == protowire.Fixed64Type:
+			point.Sum = protoutil.Double(value)
+		case num == histogramBucketCounts && typ == protowire.Fixed64Type:
+			point.BucketCounts = append(point.BucketCounts, protoutil.Fixed64(value))
+		case num == histogramBucketCounts && typ == protowire.BytesType:
+			counts, err := protoutil.PackedFixed64(value)
+			point.BucketCounts = append(point.BucketCounts, counts...)
+			return err
+		case num == histogramBounds && typ == protowire.Fixed64Type:
+			point.Bounds = append(point.Bounds, protoutil.Double(value))
+		case num == histogramBounds && typ == protowire.BytesType:
+			bits, err := protoutil.PackedFixed64(value)
+			for _, b := range bits {
+				point.Bounds = append(point.Bounds, math.Float64frombits(b))
+			}
+			return err
+		case num == histogramAttrs && typ == protowire.BytesType:
+			return decodeAttribute(value, point.Attributes)
+		case num == histogramFlags && typ == protowire.VarintType:
+			point.Flags = uint32(protoutil.Varint(value))
+		}
+		return nil
+	})
+	return point, err
+}
+
+// decodeAttribute adds a KeyValue with a scalar value to l. Array and
+// key-value list values have no label representation and are dropped.
+func decodeAttribute(data []byte, l labels.Labels) error {
+	var key string
+	var value *string
+	err := protoutil.Walk(data, bytesFields(func(num protowire.Number, v []byte) error {
+		switch num {
+		case keyValueKey:
+			key = string(v)
+		case keyValueValue:
+			return protoutil.Walk(v, func(num protowire.Number, typ protowire.Type, raw []byte) error {
+				var s string
+				switch {
+				case num == anyString && typ == protowire.BytesType:
+					s = string(raw)
+				case num == anyBool && typ == protowire.VarintType:
+					s = strconv.FormatBool(protoutil.Varint(raw) != 0)
+				case num == anyInt && typ == protowire.VarintType:
+					s = strconv.FormatInt(int64(protoutil.Varint(raw)), 10)
+				case num == anyDouble && typ == protowire.Fixed64Type:
+					s = strconv.FormatFloat(protoutil.Double(raw), 'g', -1, 64)
+				case num == anyBytes && typ == protowire.BytesType:
+					s = base64.StdEncoding.EncodeToString(raw)
+				default:
+					return nil
+				}
+				value = &s
+				return nil
+			})
+		}
+		return nil
+	}))
+	if err == nil && value != nil {
+		l[key] = *value
+	}
+	return err
+}
+
+// bytesFields adapts fn to protoutil.Walk, skipping fields that are not length-delimited.
+func bytesFields(fn func(num protowire.Number, value []byte) error) walkFunc {
+	return func(num protowire.Number, typ protowire.Type, value []byte) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+		return fn(num, value)
+	}
+}
+
+// encodeResponse builds an ExportMetricsServiceResponse, with a partial
+// success only when points were rejected.
+func encodeResponse(rejected int64, message string) []byte {
+	if rejected == 0 {
+		return nil
+	}
+	var ps []byte
+	ps = protowire.AppendTag(ps, partialSuccessRejected, protowire.VarintType)
+	ps = protowire.AppendVarint(ps, uint64(rejected))
+	ps = protowire.AppendTag(ps, partialSuccessMessage, protowire.BytesType)
+	ps = protowire.AppendString(ps, message)
+
+	var resp []byte
+	resp = protowire.AppendTag(resp, partialSuccess, protowire.BytesType)
+	return protowire.AppendBytes(resp, ps)
+}
@@ -0,0 +1,154 @@
+// Package recording evaluates recording rules, which compute new metrics
+// from existing ones on an interval and store the results as gauges.
+package recording
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/avointsev/yp7m-go/internal/labels"
+	"github.com/avointsev/yp7m-go/internal/logger"
+	"github.com/avointsev/yp7m-go/internal/server/expr"
+	"github.com/avointsev/yp7m-go/internal/server/storage"
+)
+
+// DefaultInterval is how often rules are evaluated unless configured otherwise.
+const DefaultInterval = 15 * time.Second
+
+// ErrInvalidRule is returned for rules that cannot be parsed.
+var ErrInvalidRule = errors.New(logger.ErrRecordingRuleInvalid)
+
+// Rule stores the result of Expr as the gauge Name. Rules are written one
+// per line as
+//
+//	HeapUtilization = HeapInuse / HeapSys
+//	requests_by_code = sum by (code) (requests)
+//
+// Vector results keep their labels, so the second rule stores one series per code.
+type Rule struct {
+	Name string
+	Expr string
+	node expr.Node
+}
+
+// ParseRule parses a single rule line.
+func ParseRule(line string) (Rule, error) {
+	name, source, ok := strings.Cut(line, "=")
+	name, source = strings.TrimSpace(name), strings.TrimSpace(source)
+	if !ok || name == "" || source == "" {
+		return Rule{}, fmt.Errorf("%w: expected name = expression", ErrInvalidRule)
+	}
+	if strings.ContainsAny(name, "{} \t") {
+		return Rule{}, fmt.Errorf("%w: invalid name %q", ErrInvalidRule, name)
+	}
+	node, err := expr.Parse(source)
+	if err != nil {
+		return Rule{}, fmt.Errorf("%w: %w", ErrInvalidRule, err)
+	}
+	return Rule{Name: name, Expr: source, node: node}, nil
+}
+
+// LoadRules reads rules from path, skipping blank lines and # comments.
+func LoadRules(path string) ([]Rule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rules []Rule
+	names := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule, err := ParseRule(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		if names[rule.Name] {
+			return nil, fmt.Errorf("%s:%d: %w: duplicate name %q", path, n, ErrInvalidRule, rule.Name)
+		}
+		names[rule.Name] = true
+		rules = append(rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return rules, nil
+}
+
+// Engine evaluates recording rules on an interval.
+type Engine struct {
+	store storage.StorageType
+	rules []Rule
+	now   func() time.Time
+	mu    sync.Mutex
+}
+
+// New creates an engine reading from and writing to store.
+func New(store storage.StorageType, rules []Rule) *Engine {
+	return &Engine{store: store, rules: rules, now: time.Now}
+}
+
+// SetRules replaces the rules.
+func (e *Engine) SetRules(rules []Rule) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.rules = rules
+}
+
+// Evaluate runs every rule once, in file order, so a rule can use the
+// results of the rules above it. Non-finite results are not stored.
+func (e *Engine) Evaluate() {
+	e.mu.Lock()
+	rules := e.rules
+	e.mu.Unlock()
+
+	for _, rule := range rules {
+		result, err := expr.NewEvaluator(e.store).Eval(rule.node, e.now())
+		if err != nil {
+			log.Printf("%s %s: %v", logger.ErrExprEval, rule.Name, err)
+			continue
+		}
+		if result.IsScalar {
+			e.record(rule.Name, result.Scalar)
+			continue
+		}
+		for _, s := range result.Vector {
+			e.record(labels.Series(rule.Name, s.Labels), s.Value)
+		}
+	}
+}
+
+func (e *Engine) record(series string, value float64) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return
+	}
+	e.store.UpdateGauge(series, value)
+}
+
+// Run evaluates the rules every interval until ctx is cancelled.
+func (e *Engine) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			e.Evaluate()
+		}
+	}
+}
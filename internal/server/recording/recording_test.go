@@ -0,0 +1,72 @@
+package recording
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/avointsev/yp7m-go/internal/server/storage"
+)
+
+func TestParseRule(t *testing.T) {
+	rule, err := ParseRule("HeapUtilization = HeapInuse / HeapSys")
+	if err != nil || rule.Name != "HeapUtilization" || rule.Expr != "HeapInuse / HeapSys" {
+		t.Errorf("unexpected rule %+v (%v)", rule, err)
+	}
+	for _, line := range []string{"HeapInuse / HeapSys", "= HeapInuse", `x{a="b"} = HeapInuse`, "x = HeapInuse /"} {
+		if _, err := ParseRule(line); !errors.Is(err, ErrInvalidRule) {
+			t.Errorf("ParseRule(%q): expected ErrInvalidRule, got %v", line, err)
+		}
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules")
+	content := "# derived\nratio = a / b\nratio = b / a\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("could not write rules: %v", err)
+	}
+	if _, err := LoadRules(path); !errors.Is(err, ErrInvalidRule) {
+		t.Errorf("expected duplicate name error, got %v", err)
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	store := storage.NewMemStorage()
+	store.UpdateGauge("HeapInuse", 30)
+	store.UpdateGauge("HeapSys", 120)
+	store.UpdateGauge("Zero", 0)
+	store.UpdateCounter(`requests{host="web1",code="200"}`, 10)
+	store.UpdateCounter(`requests{host="web2",code="200"}`, 5)
+	store.UpdateCounter(`requests{host="web2",code="500"}`, 1)
+
+	var rules []Rule
+	for _, line := range []string{
+		"HeapUtilization = HeapInuse / HeapSys",
+		"HeapPercent = HeapUtilization * 100",
+		"requests_by_code = sum by (code) (requests)",
+		"Broken = HeapInuse / Zero",
+	} {
+		rule, err := ParseRule(line)
+		if err != nil {
+			t.Fatalf("ParseRule(%q): %v", line, err)
+		}
+		rules = append(rules, rule)
+	}
+	New(store, rules).Evaluate()
+
+	for series, want := range map[string]float64{
+		"HeapUtilization":              0.25,
+		"HeapPercent":                  25,
+		`requests_by_code{code="200"}`: 15,
+		`requests_by_code{code="500"}`: 1,
+	} {
+		if v, err := store.GetMetric(storage.Gauge, series); err != nil || v != want {
+			t.Errorf("%s: expected %v, got %v (%v)", series, want, v, err)
+		}
+	}
+	if _, err := store.GetMetric(storage.Gauge, "Broken"); err == nil {
+		t.Error("expected infinite result not to be stored")
+	}
+}
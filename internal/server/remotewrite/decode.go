@@ -0,0 +1,109 @@
+package remotewrite
+
+import (
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/avointsev/yp7m-go/internal/labels"
+	"github.com/avointsev/yp7m-go/internal/protoutil"
+)
+
+// Field numbers of the prometheus.WriteRequest message and its children.
+const (
+	writeRequestTimeseries = 1
+
+	timeSeriesLabels  = 1
+	timeSeriesSamples = 2
+
+	labelName  = 1
+	labelValue = 2
+
+	sampleValue     = 1
+	sampleTimestamp = 2
+)
+
+// Sample is a single value with a timestamp in milliseconds.
+type Sample struct {
+	Value     float64
+	Timestamp int64
+}
+
+// TimeSeries is a labelled series with its samples. The metric name is
+// carried in the __name__ label.
+type TimeSeries struct {
+	Labels  labels.Labels
+	Samples []Sample
+}
+
+// Decode parses an uncompressed protobuf WriteRequest. Fields other than
+// timeseries (such as metadata) are skipped.
+func Decode(data []byte) ([]TimeSeries, error) {
+	var series []TimeSeries
+	err := protoutil.Walk(data, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		if num != writeRequestTimeseries || typ != protowire.BytesType {
+			return nil
+		}
+		ts, err := decodeTimeSeries(value)
+		if err != nil {
+			return err
+		}
+		series = append(series, ts)
+		return nil
+	})
+	return series, err
+}
+
+func decodeTimeSeries(data []byte) (TimeSeries, error) {
+	ts := TimeSeries{Labels: make(labels.Labels)}
+	err := protoutil.Walk(data, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+		switch num {
+		case timeSeriesLabels:
+			name, val, err := decodeLabel(value)
+			if err != nil {
+				return err
+			}
+			ts.Labels[name] = val
+		case timeSeriesSamples:
+			sample, err := decodeSample(value)
+			if err != nil {
+				return err
+			}
+			ts.Samples = append(ts.Samples, sample)
+		}
+		return nil
+	})
+	return ts, err
+}
+
+func decodeLabel(data []byte) (string, string, error) {
+	var name, value string
+	err := protoutil.Walk(data, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+		switch num {
+		case labelName:
+			name = string(v)
+		case labelValue:
+			value = string(v)
+		}
+		return nil
+	})
+	return name, value, err
+}
+
+func decodeSample(data []byte) (Sample, error) {
+	var s Sample
+	err := protoutil.Walk(data, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		switch {
+		case num == sampleValue && typ == protowire.Fixed64Type:
+			s.Value = protoutil.Double(v)
+		case num == sampleTimestamp && typ == protowire.VarintType:
+			s.Timestamp = int64(protoutil.Varint(v))
+		}
+		return nil
+	})
+	return s, err
+}
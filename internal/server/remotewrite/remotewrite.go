@@ -0,0 +1,85 @@
+// Package remotewrite receives samples sent with the Prometheus remote_write protocol.
+package remotewrite
+
+import (
+	"errors"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/golang/snappy"
+
+	"github.com/avointsev/yp7m-go/internal/labels"
+	"github.com/avointsev/yp7m-go/internal/logger"
+	"github.com/avointsev/yp7m-go/internal/server/storage"
+)
+
+// nameLabel carries the metric name in remote_write series.
+const nameLabel = "__name__"
+
+// Limits on the compressed request body and on the size snappy may expand it to.
+const (
+	maxBodySize    = 8 << 20
+	maxDecodedSize = 32 << 20
+)
+
+// Handler accepts snappy-compressed protobuf WriteRequests on POST /api/v1/write.
+// Every sample is stored as a gauge recorded at its timestamp; NaN values,
+// which include Prometheus staleness markers, are skipped. Bodies above
+// maxBodySize, or declaring more than maxDecodedSize once decompressed, are
+// rejected with 413.
+func Handler(store storage.StorageType) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		compressed, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				http.Error(w, logger.ErrRemoteWriteTooLarge, http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, logger.ErrRemoteWriteRead, http.StatusBadRequest)
+			log.Printf(logger.LogDefaultFormat, logger.ErrRemoteWriteRead, err)
+			return
+		}
+		size, err := snappy.DecodedLen(compressed)
+		if err != nil {
+			http.Error(w, logger.ErrRemoteWriteDecode, http.StatusBadRequest)
+			log.Printf(logger.LogDefaultFormat, logger.ErrRemoteWriteDecode, err)
+			return
+		}
+		if size > maxDecodedSize {
+			http.Error(w, logger.ErrRemoteWriteTooLarge, http.StatusRequestEntityTooLarge)
+			return
+		}
+		data, err := snappy.Decode(nil, compressed)
+		if err != nil {
+			http.Error(w, logger.ErrRemoteWriteDecode, http.StatusBadRequest)
+			log.Printf(logger.LogDefaultFormat, logger.ErrRemoteWriteDecode, err)
+			return
+		}
+		series, err := Decode(data)
+		if err != nil {
+			http.Error(w, logger.ErrRemoteWriteDecode, http.StatusBadRequest)
+			log.Printf(logger.LogDefaultFormat, logger.ErrRemoteWriteDecode, err)
+			return
+		}
+
+		for _, ts := range series {
+			name := ts.Labels[nameLabel]
+			if name == "" {
+				continue
+			}
+			delete(ts.Labels, nameLabel)
+			key := labels.Series(name, ts.Labels)
+			for _, sample := range ts.Samples {
+				if math.IsNaN(sample.Value) {
+					continue
+				}
+				store.UpdateGaugeAt(key, sample.Value, time.UnixMilli(sample.Timestamp))
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,114 @@
+package remotewrite
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/avointsev/yp7m-go/internal/server/storage"
+)
+
+// encodeSeries builds a WriteRequest with a single series.
+func encodeSeries(lbls [][2]string, samples []Sample) []byte {
+	var series []byte
+	for _, l := range lbls {
+		var label []byte
+		label = protowire.AppendTag(label, labelName, protowire.BytesType)
+		label = protowire.AppendString(label, l[0])
+		label = protowire.AppendTag(label, labelValue, protowire.BytesType)
+		label = protowire.AppendString(label, l[1])
+		series = protowire.AppendTag(series, timeSeriesLabels, protowire.BytesType)
+		series = protowire.AppendBytes(series, label)
+	}
+	for _, s := range samples {
+		var sample []byte
+		sample = protowire.AppendTag(sample, sampleValue, protowire.Fixed64Type)
+		sample = protowire.AppendFixed64(sample, math.Float64bits(s.Value))
+		sample = protowire.AppendTag(sample, sampleTimestamp, protowire.VarintType)
+		sample = protowire.AppendVarint(sample, uint64(s.Timestamp))
+		series = protowire.AppendTag(series, timeSeriesSamples, protowire.BytesType)
+		series = protowire.AppendBytes(series, sample)
+	}
+
+	var req []byte
+	req = protowire.AppendTag(req, writeRequestTimeseries, protowire.BytesType)
+	req = protowire.AppendBytes(req, series)
+	// An unknown metadata field must be skipped.
+	req = protowire.AppendTag(req, 3, protowire.BytesType)
+	req = protowire.AppendBytes(req, []byte{0x08, 0x01})
+	return req
+}
+
+func TestDecode(t *testing.T) {
+	data := encodeSeries([][2]string{{"__name__", "up"}, {"job", "node"}}, []Sample{{Value: 1, Timestamp: 1700000000000}})
+	series, err := Decode(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(series) != 1 || series[0].Labels["job"] != "node" || series[0].Samples[0] != (Sample{Value: 1, Timestamp: 1700000000000}) {
+		t.Errorf("unexpected series %+v", series)
+	}
+
+	if _, err := Decode(data[:len(data)-3]); err == nil {
+		t.Error("expected error for truncated request, got nil")
+	}
+}
+
+func TestHandler(t *testing.T) {
+	store := storage.NewMemStorage()
+	now := time.Now().Truncate(time.Millisecond)
+	data := encodeSeries(
+		[][2]string{{"__name__", "node_load1"}, {"instance", "web1"}},
+		[]Sample{
+			{Value: 0.5, Timestamp: now.Add(-time.Minute).UnixMilli()},
+			{Value: 0.7, Timestamp: now.UnixMilli()},
+			{Value: math.NaN(), Timestamp: now.Add(time.Second).UnixMilli()},
+		},
+	)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/write", bytes.NewReader(snappy.Encode(nil, data)))
+	rec := httptest.NewRecorder()
+	Handler(store)(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected status %v; got %v", http.StatusNoContent, rec.Code)
+	}
+
+	series := `node_load1{instance="web1"}`
+	if value, err := store.GetMetric(storage.Gauge, series); err != nil || value != 0.7 {
+		t.Errorf("expected latest value 0.7, got %v (%v)", value, err)
+	}
+	samples, err := store.History(storage.Gauge, series, now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil || len(samples) != 2 {
+		t.Errorf("expected 2 samples without the stale marker, got %v (%v)", samples, err)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/write", bytes.NewReader(data))
+	rec = httptest.NewRecorder()
+	Handler(store)(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status %v for uncompressed body; got %v", http.StatusBadRequest, rec.Code)
+	}
+}
+
+func TestHandlerLimits(t *testing.T) {
+	store := storage.NewMemStorage()
+	bodies := map[string][]byte{
+		"oversized body":          make([]byte, maxBodySize+1),
+		"oversized decoded block": binary.AppendUvarint(nil, maxDecodedSize+1),
+	}
+	for name, body := range bodies {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/write", bytes.NewReader(body))
+		rec := httptest.NewRecorder()
+		Handler(store)(rec, req)
+		if rec.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("%s: expected status %v; got %v", name, http.StatusRequestEntityTooLarge, rec.Code)
+		}
+	}
+}
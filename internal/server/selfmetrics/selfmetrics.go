@@ -0,0 +1,188 @@
+// Package selfmetrics records how the server itself performs: HTTP requests,
+// storage operations, stored series and ingestion rate. The values are written
+// into the server's own storage under the reserved Prefix, so they are served
+// by the UI, the JSON API and /metrics like any other metric.
+package selfmetrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/avointsev/yp7m-go/internal/labels"
+	"github.com/avointsev/yp7m-go/internal/server/storage"
+)
+
+// Prefix is the reserved namespace of server metrics. Writes to it from
+// clients are dropped by the instrumented store.
+const Prefix = "yp7m_server_"
+
+// DefaultInterval is how often recorded values are written to storage.
+const DefaultInterval = 10 * time.Second
+
+// Names of the recorded metrics.
+const (
+	RequestsTotal   = Prefix + "http_requests_total"
+	RequestDuration = Prefix + "http_request_duration_seconds"
+	StorageDuration = Prefix + "storage_operation_duration_seconds"
+	Series          = Prefix + "series"
+	IngestedTotal   = Prefix + "ingested_samples_total"
+	IngestionRate   = Prefix + "ingestion_rate"
+	RejectedTotal   = Prefix + "reserved_writes_rejected_total"
+)
+
+// unmatchedRoute labels requests that did not match any route.
+const unmatchedRoute = "unmatched"
+
+var (
+	requestBounds = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+	storageBounds = []float64{1e-6, 1e-5, 1e-4, 1e-3, 1e-2, 0.1}
+)
+
+// Recorder accumulates server measurements between flushes.
+type Recorder struct {
+	requests       map[string]int64
+	requestLatency map[string]*storage.Histogram
+	storageLatency map[string]*storage.Histogram
+	ingested       map[string]int64
+	rejected       int64
+	lastFlush      time.Time
+	now            func() time.Time
+	mu             sync.Mutex
+}
+
+// New creates an empty recorder.
+func New() *Recorder {
+	r := &Recorder{now: time.Now}
+	r.reset()
+	r.lastFlush = r.now()
+	return r
+}
+
+func (r *Recorder) reset() {
+	r.requests = make(map[string]int64)
+	r.requestLatency = make(map[string]*storage.Histogram)
+	r.storageLatency = make(map[string]*storage.Histogram)
+	r.ingested = make(map[string]int64)
+	r.rejected = 0
+}
+
+// Middleware counts requests by route pattern and status code and observes
+// their latency by route. It must be installed on a chi router.
+func (r *Recorder) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, req.ProtoMajor)
+		next.ServeHTTP(ww, req)
+
+		route := unmatchedRoute
+		if rctx := chi.RouteContext(req.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.requests[labels.Series(RequestsTotal, labels.Labels{
+			"route": req.Method + " " + route,
+			"code":  strconv.Itoa(status),
+		})]++
+		observe(r.requestLatency, labels.Series(RequestDuration, labels.Labels{
+			"route": req.Method + " " + route,
+		}), requestBounds, time.Since(start).Seconds())
+	})
+}
+
+func observe(m map[string]*storage.Histogram, series string, bounds []float64, v float64) {
+	h, ok := m[series]
+	if !ok {
+		h = &storage.Histogram{Bounds: bounds, Counts: make([]uint64, len(bounds))}
+		m[series] = h
+	}
+	h.Observe(v)
+}
+
+// storageOp observes the latency of a storage operation started at start.
+func (r *Recorder) storageOp(operation string, start time.Time) {
+	elapsed := time.Since(start).Seconds()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	observe(r.storageLatency, labels.Series(StorageDuration, labels.Labels{"operation": operation}), storageBounds, elapsed)
+}
+
+// ingest counts an accepted sample of metricType.
+func (r *Recorder) ingest(metricType string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ingested[metricType]++
+}
+
+func (r *Recorder) reject() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rejected++
+}
+
+// Flush writes the values recorded since the previous flush into store, which
+// should be the uninstrumented store so that flushing is not measured itself.
+func (r *Recorder) Flush(store storage.StorageType) {
+	r.mu.Lock()
+	requests, requestLatency, storageLatency := r.requests, r.requestLatency, r.storageLatency
+	ingested, rejected := r.ingested, r.rejected
+	now := r.now()
+	elapsed := now.Sub(r.lastFlush).Seconds()
+	r.lastFlush = now
+	r.reset()
+	r.mu.Unlock()
+
+	for series, count := range requests {
+		store.UpdateCounter(series, count)
+	}
+	for series, h := range requestLatency {
+		_ = store.UpdateHistogram(series, *h)
+	}
+	for series, h := range storageLatency {
+		_ = store.UpdateHistogram(series, *h)
+	}
+
+	var total int64
+	for metricType, count := range ingested {
+		store.UpdateCounter(labels.Series(IngestedTotal, labels.Labels{"type": metricType}), count)
+		total += count
+	}
+	if elapsed > 0 {
+		store.UpdateGauge(IngestionRate, float64(total)/elapsed)
+	}
+	store.UpdateCounter(RejectedTotal, rejected)
+	store.UpdateGauge(Series, float64(len(store.GetAllMetrics())))
+}
+
+// Run flushes into store every interval until ctx is cancelled.
+func (r *Recorder) Run(ctx context.Context, store storage.StorageType, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.Flush(store)
+		}
+	}
+}
+
+// Reserved reports whether name, or the metric name of a series key, is in
+// the reserved namespace.
+func Reserved(name string) bool {
+	return strings.HasPrefix(name, Prefix)
+}
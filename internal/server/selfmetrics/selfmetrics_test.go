@@ -0,0 +1,64 @@
+package selfmetrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/avointsev/yp7m-go/internal/server/storage"
+)
+
+func TestRecorder(t *testing.T) {
+	store := storage.NewMemStorage()
+	recorder := New()
+	now := time.Now()
+	recorder.lastFlush = now.Add(-2 * time.Second)
+	recorder.now = func() time.Time { return now }
+	instrumented := recorder.Wrap(store)
+
+	r := chi.NewRouter()
+	r.Use(recorder.Middleware)
+	r.Post("/update/{name}", func(w http.ResponseWriter, req *http.Request) {
+		instrumented.UpdateGauge(chi.URLParam(req, "name"), 1)
+		w.WriteHeader(http.StatusOK)
+	})
+
+	for _, target := range []string{"/update/a", "/update/b", "/update/" + Prefix + "x", "/missing"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, target, http.NoBody))
+	}
+	recorder.Flush(store)
+
+	requests, err := store.GetMetric(storage.Counter, RequestsTotal+`{code="200",route="POST /update/{name}"}`)
+	if err != nil || requests != int64(3) {
+		t.Errorf("expected 3 matched requests, got %v (%v)", requests, err)
+	}
+	if _, err := store.GetMetric(storage.Counter, RequestsTotal+`{code="404",route="POST unmatched"}`); err != nil {
+		t.Errorf("expected unmatched request to be counted: %v", err)
+	}
+	latency, err := store.GetMetric(storage.HistogramType, RequestDuration+`{route="POST /update/{name}"}`)
+	if h, ok := latency.(storage.Histogram); err != nil || !ok || h.Count != 3 {
+		t.Errorf("expected 3 latency observations, got %+v (%v)", latency, err)
+	}
+	if _, err := store.GetMetric(storage.HistogramType, StorageDuration+`{operation="update_gauge"}`); err != nil {
+		t.Errorf("expected storage latency to be recorded: %v", err)
+	}
+
+	if _, err := store.GetMetric(storage.Gauge, Prefix+"x"); err == nil {
+		t.Error("expected write to the reserved namespace to be dropped")
+	}
+	if rejected, _ := store.GetMetric(storage.Counter, RejectedTotal); rejected != int64(1) {
+		t.Errorf("expected 1 rejected write, got %v", rejected)
+	}
+	if ingested, _ := store.GetMetric(storage.Counter, IngestedTotal+`{type="gauge"}`); ingested != int64(2) {
+		t.Errorf("expected 2 ingested gauges, got %v", ingested)
+	}
+	if rate, _ := store.GetMetric(storage.Gauge, IngestionRate); rate != 1.0 {
+		t.Errorf("expected ingestion rate 1/s, got %v", rate)
+	}
+	if series, _ := store.GetMetric(storage.Gauge, Series); series != 10.0 {
+		t.Errorf("expected stored series count, got %v", series)
+	}
+}
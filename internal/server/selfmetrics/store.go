@@ -0,0 +1,132 @@
+package selfmetrics
+
+import (
+	"errors"
+	"time"
+
+	"github.com/avointsev/yp7m-go/internal/hll"
+	"github.com/avointsev/yp7m-go/internal/labels"
+	"github.com/avointsev/yp7m-go/internal/logger"
+	"github.com/avointsev/yp7m-go/internal/server/storage"
+	"github.com/avointsev/yp7m-go/internal/sketch"
+)
+
+// Store wraps a storage, timing every operation and counting ingested
+// samples. Writes into the reserved namespace are dropped; handlers can ask
+// Reserved first to report them to the client.
+type Store struct {
+	storage.StorageType
+	recorder *Recorder
+}
+
+// Wrap returns store instrumented by r.
+func (r *Recorder) Wrap(store storage.StorageType) *Store {
+	return &Store{StorageType: store, recorder: r}
+}
+
+func (s *Store) UpdateGauge(name string, value float64) {
+	if s.reserved(name) {
+		return
+	}
+	defer s.recorder.storageOp("update_gauge", time.Now())
+	s.StorageType.UpdateGauge(name, value)
+	s.recorder.ingest(storage.Gauge)
+}
+
+func (s *Store) UpdateGaugeAt(name string, value float64, ts time.Time) {
+	if s.reserved(name) {
+		return
+	}
+	defer s.recorder.storageOp("update_gauge", time.Now())
+	s.StorageType.UpdateGaugeAt(name, value, ts)
+	s.recorder.ingest(storage.Gauge)
+}
+
+func (s *Store) UpdateCounter(name string, value int64) {
+	if s.reserved(name) {
+		return
+	}
+	defer s.recorder.storageOp("update_counter", time.Now())
+	s.StorageType.UpdateCounter(name, value)
+	s.recorder.ingest(storage.Counter)
+}
+
+func (s *Store) UpdateHistogram(name string, value storage.Histogram) error {
+	if s.reserved(name) {
+		return errors.New(logger.ErrMetricReserved)
+	}
+	defer s.recorder.storageOp("update_histogram", time.Now())
+	return s.counted(storage.HistogramType, s.StorageType.UpdateHistogram(name, value))
+}
+
+func (s *Store) UpdateSummary(name string, value *sketch.Sketch) error {
+	if s.reserved(name) {
+		return errors.New(logger.ErrMetricReserved)
+	}
+	defer s.recorder.storageOp("update_summary", time.Now())
+	return s.counted(storage.Summary, s.StorageType.UpdateSummary(name, value))
+}
+
+func (s *Store) UpdateSet(name string, value *hll.HLL) error {
+	if s.reserved(name) {
+		return errors.New(logger.ErrMetricReserved)
+	}
+	defer s.recorder.storageOp("update_set", time.Now())
+	return s.counted(storage.Set, s.StorageType.UpdateSet(name, value))
+}
+
+func (s *Store) GetSummaryQuantile(name string, q float64, window time.Duration) (float64, error) {
+	defer s.recorder.storageOp("quantile", time.Now())
+	return s.StorageType.GetSummaryQuantile(name, q, window)
+}
+
+func (s *Store) GetAllMetrics() map[string]interface{} {
+	defer s.recorder.storageOp("get_all", time.Now())
+	return s.StorageType.GetAllMetrics()
+}
+
+func (s *Store) GetMetric(metricType, name string) (interface{}, error) {
+	defer s.recorder.storageOp("get", time.Now())
+	return s.StorageType.GetMetric(metricType, name)
+}
+
+func (s *Store) History(metricType, name string, from, to time.Time) ([]storage.Sample, error) {
+	defer s.recorder.storageOp("history", time.Now())
+	return s.StorageType.History(metricType, name, from, to)
+}
+
+// Reserved reports whether name is in the reserved namespace, counting the
+// write as rejected when it is.
+func (s *Store) Reserved(name string) bool {
+	return s.reserved(name)
+}
+
+func (s *Store) reserved(name string) bool {
+	if Reserved(name) {
+		s.recorder.reject()
+		return true
+	}
+	return false
+}
+
+func (s *Store) counted(metricType string, err error) error {
+	if err == nil {
+		s.recorder.ingest(metricType)
+	}
+	return err
+}
+
+func (s *Store) Delete(metricType, name string) error {
+	defer s.recorder.storageOp("delete", time.Now())
+	return s.StorageType.Delete(metricType, name)
+}
+
+func (s *Store) ResetCounter(name string) error {
+	defer s.recorder.storageOp("reset", time.Now())
+	return s.StorageType.ResetCounter(name)
+}
+
+func (s *Store) DeleteMatching(prefix string, selector labels.Labels) int {
+	defer s.recorder.storageOp("delete", time.Now())
+	return s.StorageType.DeleteMatching(prefix, selector)
+}
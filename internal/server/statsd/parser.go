@@ -0,0 +1,91 @@
+package statsd
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Metric types of the StatsD line protocol.
+const (
+	TypeCounter   = "c"
+	TypeGauge     = "g"
+	TypeTimer     = "ms"
+	TypeHistogram = "h"
+	TypeSet       = "s"
+)
+
+var (
+	errInvalidLine = errors.New("invalid statsd line")
+	errInvalidType = errors.New("unsupported statsd metric type")
+	errNegative    = errors.New("statsd counter must not be negative")
+	errRange       = errors.New("statsd counter out of range")
+)
+
+// minRate is the smallest accepted sample rate. A lower rate would make one
+// packet stand for an arbitrary number of events.
+const minRate = 1e-3
+
+// maxCounter bounds the scaled amount of a single counter sample so that it
+// stays an exact integer after the flush conversion.
+const maxCounter = 1 << 53
+
+// Sample is a single parsed StatsD measurement.
+type Sample struct {
+	Name  string
+	Type  string
+	Raw   string
+	Value float64
+	Rate  float64
+	// Delta is set for gauges written as +N or -N, which adjust the current value.
+	Delta bool
+}
+
+// ParseLine parses one line such as "api.hits:1|c|@0.5" or "queue:-3|g".
+// Trailing DogStatsD tags ("|#tag:value") are accepted and ignored. Counters
+// only go up, so a negative counter value is an error. Sample rates must lie
+// between minRate and 1.
+func ParseLine(line string) (Sample, error) {
+	name, rest, ok := strings.Cut(line, ":")
+	if !ok || name == "" {
+		return Sample{}, errInvalidLine
+	}
+	fields := strings.Split(rest, "|")
+	if len(fields) < 2 || fields[0] == "" {
+		return Sample{}, errInvalidLine
+	}
+
+	sample := Sample{Name: name, Type: fields[1], Raw: fields[0], Rate: 1}
+	for _, field := range fields[2:] {
+		if rate, ok := strings.CutPrefix(field, "@"); ok {
+			value, err := strconv.ParseFloat(rate, 64)
+			if err != nil || value < minRate || value > 1 {
+				return Sample{}, errInvalidLine
+			}
+			sample.Rate = value
+		}
+	}
+
+	switch sample.Type {
+	case TypeSet:
+		return sample, nil
+	case TypeCounter, TypeGauge, TypeTimer, TypeHistogram:
+	default:
+		return Sample{}, errInvalidType
+	}
+
+	value, err := strconv.ParseFloat(sample.Raw, 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return Sample{}, errInvalidLine
+	}
+	if sample.Type == TypeCounter && value < 0 {
+		return Sample{}, errNegative
+	}
+	if sample.Type == TypeCounter && value/sample.Rate > maxCounter {
+		return Sample{}, errRange
+	}
+	sample.Value = value
+	sample.Delta = sample.Type == TypeGauge && (sample.Raw[0] == '+' || sample.Raw[0] == '-')
+	return sample, nil
+}
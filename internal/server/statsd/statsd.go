@@ -0,0 +1,186 @@
+package statsd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/avointsev/yp7m-go/internal/hll"
+	"github.com/avointsev/yp7m-go/internal/logger"
+	"github.com/avointsev/yp7m-go/internal/server/storage"
+	"github.com/avointsev/yp7m-go/internal/sketch"
+)
+
+const maxPacketSize = 65535
+
+type gaugeState struct {
+	value float64
+	set   bool
+}
+
+// Server aggregates StatsD samples received over UDP and flushes them
+// into the storage on an interval: counters become counters, gauges
+// gauges, timers and histograms summaries, and sets distinct-count sets.
+type Server struct {
+	store     storage.StorageType
+	counters  map[string]float64
+	gauges    map[string]gaugeState
+	summaries map[string]*sketch.Sketch
+	sets      map[string]*hll.HLL
+	interval  time.Duration
+	mu        sync.Mutex
+}
+
+// New creates a StatsD server that flushes into store every interval.
+func New(store storage.StorageType, interval time.Duration) *Server {
+	s := &Server{
+		store:    store,
+		interval: interval,
+		counters: make(map[string]float64),
+	}
+	s.reset()
+	return s
+}
+
+func (s *Server) reset() {
+	s.gauges = make(map[string]gaugeState)
+	s.summaries = make(map[string]*sketch.Sketch)
+	s.sets = make(map[string]*hll.HLL)
+}
+
+// Add aggregates a sample until the next flush.
+func (s *Server) Add(sample Sample) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch sample.Type {
+	case TypeCounter:
+		s.counters[sample.Name] += sample.Value / sample.Rate
+	case TypeGauge:
+		state := s.gauges[sample.Name]
+		if sample.Delta {
+			state.value += sample.Value
+		} else {
+			state = gaugeState{value: sample.Value, set: true}
+		}
+		s.gauges[sample.Name] = state
+	case TypeTimer, TypeHistogram:
+		summary, ok := s.summaries[sample.Name]
+		if !ok {
+			summary = sketch.New(sketch.DefaultAlpha)
+			s.summaries[sample.Name] = summary
+		}
+		summary.AddN(sample.Value, uint64(math.Round(1/sample.Rate)))
+	case TypeSet:
+		set, ok := s.sets[sample.Name]
+		if !ok {
+			set = hll.New(hll.DefaultPrecision)
+			s.sets[sample.Name] = set
+		}
+		set.Add(sample.Raw)
+	}
+}
+
+// Flush writes the aggregated samples to the storage. Fractional counter
+// amounts from sampling, and anything above maxCounter, are carried over to
+// the next flush.
+func (s *Server) Flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for name, value := range s.counters {
+		whole := math.Min(math.Trunc(value), maxCounter)
+		if whole != 0 {
+			s.store.UpdateCounter(name, int64(whole))
+		}
+		if rest := value - whole; rest != 0 {
+			s.counters[name] = rest
+		} else {
+			delete(s.counters, name)
+		}
+	}
+	for name, state := range s.gauges {
+		value := state.value
+		if !state.set {
+			if current, err := s.store.GetMetric(storage.Gauge, name); err == nil {
+				if currentValue, ok := current.(float64); ok {
+					value += currentValue
+				}
+			}
+		}
+		s.store.UpdateGauge(name, value)
+	}
+	for name, summary := range s.summaries {
+		if err := s.store.UpdateSummary(name, summary); err != nil {
+			log.Printf("%s for metric %s: %v", logger.ErrStatsdFlush, name, err)
+		}
+	}
+	for name, set := range s.sets {
+		if err := s.store.UpdateSet(name, set); err != nil {
+			log.Printf("%s for metric %s: %v", logger.ErrStatsdFlush, name, err)
+		}
+	}
+	s.reset()
+}
+
+// HandlePacket parses and aggregates every line of a datagram.
+func (s *Server) HandlePacket(packet []byte) {
+	for _, line := range strings.Split(string(packet), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		sample, err := ParseLine(line)
+		if err != nil {
+			log.Printf("%s: %v: %q", logger.ErrStatsdParse, err, line)
+			continue
+		}
+		s.Add(sample)
+	}
+}
+
+// ListenAndServe receives StatsD packets on addr until ctx is cancelled,
+// flushing on the configured interval and once more on shutdown.
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return fmt.Errorf("%s: %w", logger.ErrStatsdListener, err)
+	}
+	return s.Serve(ctx, conn)
+}
+
+// Serve receives StatsD packets from conn until ctx is cancelled.
+func (s *Server) Serve(ctx context.Context, conn net.PacketConn) error {
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				_ = conn.Close()
+				return
+			case <-ticker.C:
+				s.Flush()
+			}
+		}
+	}()
+
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			s.Flush()
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return fmt.Errorf("%s: %w", logger.ErrStatsdListener, err)
+		}
+		s.HandlePacket(buf[:n])
+	}
+}
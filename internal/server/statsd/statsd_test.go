@@ -0,0 +1,133 @@
+package statsd
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/avointsev/yp7m-go/internal/hll"
+	"github.com/avointsev/yp7m-go/internal/server/storage"
+	"github.com/avointsev/yp7m-go/internal/sketch"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    Sample
+		wantErr bool
+	}{
+		{line: "hits:3|c", want: Sample{Name: "hits", Type: "c", Raw: "3", Value: 3, Rate: 1}},
+		{line: "hits:1|c|@0.25", want: Sample{Name: "hits", Type: "c", Raw: "1", Value: 1, Rate: 0.25}},
+		{line: "queue:-2|g", want: Sample{Name: "queue", Type: "g", Raw: "-2", Value: -2, Rate: 1, Delta: true}},
+		{line: "rtt:12.5|ms|#env:prod", want: Sample{Name: "rtt", Type: "ms", Raw: "12.5", Value: 12.5, Rate: 1}},
+		{line: "users:alice|s", want: Sample{Name: "users", Type: "s", Raw: "alice", Rate: 1}},
+		{line: "broken", wantErr: true},
+		{line: "hits:x|c", wantErr: true},
+		{line: "hits:1|z", wantErr: true},
+		{line: "hits:1|c|@2", wantErr: true},
+		{line: "hits:1|c|@0.001", want: Sample{Name: "hits", Type: "c", Raw: "1", Value: 1, Rate: 0.001}},
+		{line: "hits:1|c|@1e-9", wantErr: true},
+		{line: "rtt:1|ms|@1e-9", wantErr: true},
+		{line: "hits:1e300|c", wantErr: true},
+		{line: "hits:-3|c", wantErr: true},
+		{line: "temp:NaN|g", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseLine(tt.line)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseLine(%q) expected error", tt.line)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseLine(%q) unexpected error: %v", tt.line, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseLine(%q) = %+v, want %+v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestFlushMapsTypes(t *testing.T) {
+	store := storage.NewMemStorage()
+	store.UpdateGauge("queue", 10)
+	s := New(store, time.Minute)
+
+	s.HandlePacket([]byte("hits:1|c|@0.5\nhits:2|c\nqueue:-3|g\ntemp:5|g\ntemp:+1|g\nrtt:10|ms\nusers:a|s\nusers:b|s\nusers:a|s"))
+	s.Flush()
+
+	if value, _ := store.GetMetric(storage.Counter, "hits"); value != int64(4) {
+		t.Errorf("expected sampled counter 4, got %v", value)
+	}
+	if value, _ := store.GetMetric(storage.Gauge, "queue"); value != 7.0 {
+		t.Errorf("expected gauge delta applied to 7, got %v", value)
+	}
+	if value, _ := store.GetMetric(storage.Gauge, "temp"); value != 6.0 {
+		t.Errorf("expected gauge 6, got %v", value)
+	}
+	value, _ := store.GetMetric(storage.Summary, "rtt")
+	if summary, ok := value.(*sketch.Sketch); !ok || summary.Count != 1 {
+		t.Errorf("expected timer summary with 1 observation, got %v", value)
+	}
+	value, _ = store.GetMetric(storage.Set, "users")
+	if set, ok := value.(*hll.HLL); !ok || set.Estimate() != 2 {
+		t.Errorf("expected set with 2 members, got %v", value)
+	}
+}
+
+func TestFlushSampledTimer(t *testing.T) {
+	store := storage.NewMemStorage()
+	s := New(store, time.Minute)
+
+	s.HandlePacket([]byte("rtt:10|ms|@0.001"))
+	s.Flush()
+
+	value, _ := store.GetMetric(storage.Summary, "rtt")
+	if summary, ok := value.(*sketch.Sketch); !ok || summary.Count != 1000 || summary.Sum != 10000 {
+		t.Errorf("expected timer summary weighted to 1000 observations, got %v", value)
+	}
+}
+
+func TestServeUDP(t *testing.T) {
+	store := storage.NewMemStorage()
+	s := New(store, 10*time.Millisecond)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Serve(ctx, conn)
+	}()
+
+	client, err := net.Dial("udp", conn.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	defer client.Close()
+	if _, err := client.Write([]byte("requests:5|c")); err != nil {
+		t.Fatalf("could not send packet: %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if value, err := store.GetMetric(storage.Counter, "requests"); err == nil && value == int64(5) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("unexpected serve error: %v", err)
+	}
+	if value, _ := store.GetMetric(storage.Counter, "requests"); value != int64(5) {
+		t.Errorf("expected counter 5 received over UDP, got %v", value)
+	}
+}
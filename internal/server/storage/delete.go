@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/avointsev/yp7m-go/internal/labels"
+	"github.com/avointsev/yp7m-go/internal/logger"
+)
+
+// Delete removes a metric and its history.
+func (m *MemStorage) Delete(metricType, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.updated[metricType][name]; !ok {
+		return errors.New(logger.ErrMetricNotFound)
+	}
+	m.remove(metricType, name)
+	return nil
+}
+
+// ResetCounter sets a counter back to zero, recording the reset in its history.
+func (m *MemStorage) ResetCounter(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.counters[name]; !ok {
+		return errors.New(logger.ErrMetricNotFound)
+	}
+	m.counters[name] = 0
+	m.touch(Counter, name)
+	now := m.now()
+	m.counterHistory.add(name, Sample{Time: now, Value: 0}, now, m.retention)
+	return nil
+}
+
+// DeleteMatching removes every metric whose name starts with prefix and whose
+// labels include all of selector, and returns how many were removed.
+func (m *MemStorage) DeleteMatching(prefix string, selector labels.Labels) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	removed := 0
+	for metricType, updated := range m.updated {
+		for series := range updated {
+			if !matches(series, prefix, selector) {
+				continue
+			}
+			m.remove(metricType, series)
+			removed++
+		}
+	}
+	return removed
+}
+
+func matches(series, prefix string, selector labels.Labels) bool {
+	name, l, err := labels.Parse(series)
+	if err != nil || !strings.HasPrefix(name, prefix) {
+		return false
+	}
+	for k, v := range selector {
+		if value, ok := l[k]; !ok || value != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"errors"
+	"time"
+
+	"github.com/avointsev/yp7m-go/internal/logger"
+)
+
+// Freshness tells when a metric was last updated and whether it is stale.
+type Freshness struct {
+	Updated time.Time `json:"updated_at"`
+	Stale   bool      `json:"stale"`
+}
+
+// SetExpiry sets after how long without updates a metric is reported stale and
+// after how long Expire removes it. Zero disables either.
+func (m *MemStorage) SetExpiry(staleAfter, purgeAfter time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.staleAfter, m.purgeAfter = staleAfter, purgeAfter
+}
+
+// touch records an update of a metric. Callers must hold m.mu.
+func (m *MemStorage) touch(metricType, name string) {
+	updated, ok := m.updated[metricType]
+	if !ok {
+		updated = make(map[string]time.Time)
+		m.updated[metricType] = updated
+	}
+	updated[name] = m.now()
+}
+
+func (m *MemStorage) freshness(updated, now time.Time) Freshness {
+	return Freshness{
+		Updated: updated,
+		Stale:   m.staleAfter > 0 && now.Sub(updated) >= m.staleAfter,
+	}
+}
+
+// Freshness returns the last update time and staleness of a metric.
+func (m *MemStorage) Freshness(metricType, name string) (Freshness, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	updated, ok := m.updated[metricType][name]
+	if !ok {
+		return Freshness{}, errors.New(logger.ErrMetricNotFound)
+	}
+	return m.freshness(updated, m.now()), nil
+}
+
+// AllFreshness returns the freshness of every metric keyed by name, matching GetAllMetrics.
+func (m *MemStorage) AllFreshness() map[string]Freshness {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	all := make(map[string]Freshness)
+	for _, metricType := range []string{Gauge, Counter, HistogramType, Summary, Set} {
+		for name, updated := range m.updated[metricType] {
+			all[name] = m.freshness(updated, now)
+		}
+	}
+	return all
+}
+
+// Expire removes metrics, with their history, that have not been updated for
+// the purge TTL and returns how many were removed.
+func (m *MemStorage) Expire() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.purgeAfter <= 0 {
+		return 0
+	}
+	cutoff := m.now().Add(-m.purgeAfter)
+	removed := 0
+	for metricType, updated := range m.updated {
+		for name, t := range updated {
+			if !t.Before(cutoff) {
+				continue
+			}
+			m.remove(metricType, name)
+			removed++
+		}
+	}
+	return removed
+}
+
+// remove deletes a metric and its history. Callers must hold m.mu.
+func (m *MemStorage) remove(metricType, name string) {
+	delete(m.updated[metricType], name)
+	switch metricType {
+	case Gauge:
+		delete(m.gauges, name)
+		delete(m.gaugeHistory, name)
+	case Counter:
+		delete(m.counters, name)
+		delete(m.counterHistory, name)
+	case HistogramType:
+		delete(m.histograms, name)
+	case Summary:
+		delete(m.summaries, name)
+	case Set:
+		delete(m.sets, name)
+	}
+}
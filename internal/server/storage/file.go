@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"strconv"
+
+	"github.com/avointsev/yp7m-go/internal/hll"
+	"github.com/avointsev/yp7m-go/internal/logger"
+	"github.com/avointsev/yp7m-go/internal/sketch"
+)
+
+// snapshot is the on-disk representation of MemStorage.
+type snapshot struct {
+	Gauges     map[string]gaugeValue     `json:"gauges"`
+	Counters   map[string]int64          `json:"counters"`
+	Histograms map[string]*Histogram     `json:"histograms"`
+	Summaries  map[string]*sketch.Sketch `json:"summaries"`
+	Sets       map[string]*hll.HLL       `json:"sets"`
+}
+
+// gaugeValue is a gauge in the snapshot. JSON has no literals for NaN and the
+// infinities, so they are written as the strings "NaN", "+Inf" and "-Inf".
+type gaugeValue float64
+
+func (v gaugeValue) MarshalJSON() ([]byte, error) {
+	f := float64(v)
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return json.Marshal(strconv.FormatFloat(f, 'f', -1, 64))
+	}
+	return json.Marshal(f)
+}
+
+func (v *gaugeValue) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return err
+		}
+		*v = gaugeValue(f)
+		return nil
+	}
+	var f float64
+	if err := json.Unmarshal(data, &f); err != nil {
+		return err
+	}
+	*v = gaugeValue(f)
+	return nil
+}
+
+// SaveFile writes all metrics to path, replacing the previous file atomically.
+func (m *MemStorage) SaveFile(path string) error {
+	m.mu.Lock()
+	snap := snapshot{
+		Gauges:     make(map[string]gaugeValue, len(m.gauges)),
+		Counters:   m.counters,
+		Histograms: m.histograms,
+		Summaries:  make(map[string]*sketch.Sketch, len(m.summaries)),
+		Sets:       m.sets,
+	}
+	for name, value := range m.gauges {
+		snap.Gauges[name] = gaugeValue(value)
+	}
+	for name, series := range m.summaries {
+		snap.Summaries[name] = series.total
+	}
+	data, err := json.Marshal(snap)
+	m.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("%s: %w", logger.ErrStorageSave, err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("%s: %w", logger.ErrStorageSave, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("%s: %w", logger.ErrStorageSave, err)
+	}
+	return nil
+}
+
+// LoadFile restores metrics saved by SaveFile. A missing file is not an error.
+func (m *MemStorage) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", logger.ErrStorageLoad, err)
+	}
+
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return fmt.Errorf("%s: %w", logger.ErrStorageLoad, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Update times are not saved, so restored metrics count as updated now.
+	// Entries saved as null are skipped.
+	for name, value := range snap.Gauges {
+		m.gauges[name] = float64(value)
+		m.touch(Gauge, name)
+	}
+	for name, value := range snap.Counters {
+		m.counters[name] = value
+		m.touch(Counter, name)
+	}
+	for name, value := range snap.Histograms {
+		if value != nil && value.Validate() == nil {
+			m.histograms[name] = value
+			m.touch(HistogramType, name)
+		}
+	}
+	for name, value := range snap.Summaries {
+		if value != nil && value.Validate() == nil {
+			m.summaries[name] = &summarySeries{total: value}
+			m.touch(Summary, name)
+		}
+	}
+	for name, value := range snap.Sets {
+		if value != nil && value.Validate() == nil {
+			m.sets[name] = value
+			m.touch(Set, name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/avointsev/yp7m-go/internal/logger"
+)
+
+// Histogram holds cumulative bucket counts for a set of upper bounds.
+// Count is the total number of observations and acts as the +Inf bucket.
+type Histogram struct {
+	Bounds []float64 `json:"bounds"`
+	Counts []uint64  `json:"counts"`
+	Sum    float64   `json:"sum"`
+	Count  uint64    `json:"count"`
+}
+
+// Validate checks that bounds and the sum are finite, that bounds increase and
+// that cumulative counts never decrease. The +Inf bucket is implied by Count.
+func (h Histogram) Validate() error {
+	if len(h.Bounds) != len(h.Counts) {
+		return errors.New(logger.ErrHistogramInvalid)
+	}
+	for i := range h.Bounds {
+		if math.IsNaN(h.Bounds[i]) || math.IsInf(h.Bounds[i], 0) || (i > 0 && h.Bounds[i] <= h.Bounds[i-1]) {
+			return errors.New(logger.ErrHistogramInvalid)
+		}
+		if i > 0 && h.Counts[i] < h.Counts[i-1] {
+			return errors.New(logger.ErrHistogramInvalid)
+		}
+	}
+	if math.IsNaN(h.Sum) || math.IsInf(h.Sum, 0) {
+		return errors.New(logger.ErrHistogramInvalid)
+	}
+	if len(h.Counts) > 0 && h.Count < h.Counts[len(h.Counts)-1] {
+		return errors.New(logger.ErrHistogramInvalid)
+	}
+	return nil
+}
+
+// Merge adds the observations of other. Both histograms must share the same bounds.
+func (h *Histogram) Merge(other Histogram) error {
+	if !slices.Equal(h.Bounds, other.Bounds) {
+		return errors.New(logger.ErrHistogramBounds)
+	}
+	for i := range h.Counts {
+		h.Counts[i] += other.Counts[i]
+	}
+	h.Sum += other.Sum
+	h.Count += other.Count
+	return nil
+}
+
+// Observe records a single observation of v.
+func (h *Histogram) Observe(v float64) {
+	for i, bound := range h.Bounds {
+		if v <= bound {
+			h.Counts[i]++
+		}
+	}
+	h.Sum += v
+	h.Count++
+}
+
+// Clone returns a deep copy of the histogram.
+func (h Histogram) Clone() Histogram {
+	h.Bounds = slices.Clone(h.Bounds)
+	h.Counts = slices.Clone(h.Counts)
+	return h
+}
+
+// Quantile estimates the q-quantile by linear interpolation inside the matching bucket.
+// Observations above the last bound are reported as the last bound.
+func (h Histogram) Quantile(q float64) float64 {
+	if h.Count == 0 || len(h.Bounds) == 0 {
+		return math.NaN()
+	}
+	rank := q * float64(h.Count)
+
+	lower, prevCount := 0.0, uint64(0)
+	if h.Bounds[0] < 0 {
+		lower = h.Bounds[0]
+	}
+	for i, upper := range h.Bounds {
+		if float64(h.Counts[i]) >= rank {
+			inBucket := h.Counts[i] - prevCount
+			if inBucket == 0 {
+				return upper
+			}
+			return lower + (upper-lower)*(rank-float64(prevCount))/float64(inBucket)
+		}
+		lower, prevCount = upper, h.Counts[i]
+	}
+	return h.Bounds[len(h.Bounds)-1]
+}
+
+// String renders the histogram summary with quantile estimates for the UI.
+func (h Histogram) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "count=%d sum=%s", h.Count, strconv.FormatFloat(h.Sum, 'f', -1, 64))
+	for _, q := range []float64{0.5, 0.9, 0.99} {
+		fmt.Fprintf(&b, " p%s=%s", strconv.FormatFloat(q*100, 'f', -1, 64), strconv.FormatFloat(h.Quantile(q), 'g', 4, 64))
+	}
+	return b.String()
+}
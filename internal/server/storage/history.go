@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/avointsev/yp7m-go/internal/logger"
+)
+
+const (
+	// DefaultHistoryRetention is how long gauge and counter samples are kept.
+	DefaultHistoryRetention = time.Hour
+	// maxHistorySamples caps the samples kept per series regardless of retention.
+	maxHistorySamples = 10000
+)
+
+// Sample is a metric value observed at a point in time.
+type Sample struct {
+	Time  time.Time `json:"time"`
+	Value float64   `json:"value"`
+}
+
+// MarshalJSON writes a non-finite value, which JSON cannot represent, as null.
+func (s Sample) MarshalJSON() ([]byte, error) {
+	type plain struct {
+		Time  time.Time `json:"time"`
+		Value *float64  `json:"value"`
+	}
+	p := plain{Time: s.Time}
+	if !math.IsNaN(s.Value) && !math.IsInf(s.Value, 0) {
+		p.Value = &s.Value
+	}
+	return json.Marshal(p)
+}
+
+// history keeps time-ordered samples per series.
+type history map[string][]Sample
+
+// add inserts a sample in time order and drops samples outside the retention.
+// It reports whether the sample is the newest of its series. Samples usually
+// arrive in order and are appended; the trimmed slice keeps its spare capacity
+// so that appending does not copy the series.
+func (h history) add(name string, sample Sample, now time.Time, retention time.Duration) bool {
+	samples := h[name]
+	newest := len(samples) == 0 || !sample.Time.Before(samples[len(samples)-1].Time)
+	if newest {
+		samples = append(samples, sample)
+	} else {
+		i, _ := slices.BinarySearchFunc(samples, sample.Time, func(s Sample, t time.Time) int {
+			return s.Time.Compare(t)
+		})
+		for i < len(samples) && samples[i].Time.Equal(sample.Time) {
+			i++
+		}
+		samples = slices.Insert(samples, i, sample)
+	}
+
+	cutoff := now.Add(-retention)
+	drop := 0
+	for drop < len(samples) && samples[drop].Time.Before(cutoff) {
+		drop++
+	}
+	drop = max(drop, len(samples)-maxHistorySamples)
+	h[name] = samples[drop:]
+	return newest
+}
+
+// between returns a copy of the samples with from <= time <= to.
+func (h history) between(name string, from, to time.Time) []Sample {
+	var result []Sample
+	for _, s := range h[name] {
+		if !s.Time.Before(from) && !s.Time.After(to) {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// SetHistoryRetention changes how long samples are kept.
+func (m *MemStorage) SetHistoryRetention(retention time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.retention = retention
+}
+
+// UpdateGaugeAt records a gauge value observed at ts. The current value only
+// changes when ts is not older than the latest recorded sample. Timestamps in
+// the future are clamped to now so that they cannot hold back later samples.
+func (m *MemStorage) UpdateGaugeAt(name string, value float64, ts time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.touch(Gauge, name)
+	now := m.now()
+	if ts.After(now) {
+		ts = now
+	}
+	if m.gaugeHistory.add(name, Sample{Time: ts, Value: value}, now, m.retention) {
+		m.gauges[name] = value
+		return
+	}
+	if _, ok := m.gauges[name]; !ok {
+		m.gauges[name] = value
+	}
+}
+
+// History returns the recorded samples of a gauge or counter between from and to.
+// Counter samples hold the cumulative value after each update.
+func (m *MemStorage) History(metricType, name string, from, to time.Time) ([]Sample, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch MetricType(metricType) {
+	case Gauge:
+		if _, ok := m.gauges[name]; !ok {
+			return nil, errors.New(logger.ErrMetricNotFound)
+		}
+		return m.gaugeHistory.between(name, from, to), nil
+	case Counter:
+		if _, ok := m.counters[name]; !ok {
+			return nil, errors.New(logger.ErrMetricNotFound)
+		}
+		return m.counterHistory.between(name, from, to), nil
+	default:
+		return nil, errors.New(logger.ErrMetricInvalidType)
+	}
+}
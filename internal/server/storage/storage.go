@@ -3,38 +3,74 @@ package storage
 import (
 	"errors"
 	"sync"
+	"time"
 
+	"github.com/avointsev/yp7m-go/internal/hll"
+	"github.com/avointsev/yp7m-go/internal/labels"
 	"github.com/avointsev/yp7m-go/internal/logger"
+	"github.com/avointsev/yp7m-go/internal/sketch"
 )
 
 // MetricType defines metric types.
 type MetricType string
 
 const (
-	Gauge   = "gauge"
-	Counter = "counter"
+	Gauge         = "gauge"
+	Counter       = "counter"
+	HistogramType = "histogram"
+	Summary       = "summary"
+	Set           = "set"
 )
 
 // StorageType interface for interacting with MemStorage.
 type StorageType interface {
 	UpdateGauge(name string, value float64)
+	UpdateGaugeAt(name string, value float64, ts time.Time)
 	UpdateCounter(name string, value int64)
+	UpdateHistogram(name string, value Histogram) error
+	UpdateSummary(name string, value *sketch.Sketch) error
+	GetSummaryQuantile(name string, q float64, window time.Duration) (float64, error)
+	UpdateSet(name string, value *hll.HLL) error
 	GetAllMetrics() map[string]interface{}
 	GetMetric(metricType, name string) (interface{}, error)
+	History(metricType, name string, from, to time.Time) ([]Sample, error)
+	Freshness(metricType, name string) (Freshness, error)
+	AllFreshness() map[string]Freshness
+	Delete(metricType, name string) error
+	ResetCounter(name string) error
+	DeleteMatching(prefix string, selector labels.Labels) int
 }
 
 // MemStorage memory storage for metrics.
 type MemStorage struct {
-	gauges   map[string]float64
-	counters map[string]int64
-	mu       sync.Mutex
+	gauges         map[string]float64
+	counters       map[string]int64
+	histograms     map[string]*Histogram
+	summaries      map[string]*summarySeries
+	sets           map[string]*hll.HLL
+	gaugeHistory   history
+	counterHistory history
+	updated        map[string]map[string]time.Time
+	now            func() time.Time
+	retention      time.Duration
+	staleAfter     time.Duration
+	purgeAfter     time.Duration
+	mu             sync.Mutex
 }
 
 // NewMemStorage creates a new instance of MemStorage.
 func NewMemStorage() *MemStorage {
 	return &MemStorage{
-		gauges:   make(map[string]float64),
-		counters: make(map[string]int64),
+		gauges:         make(map[string]float64),
+		counters:       make(map[string]int64),
+		histograms:     make(map[string]*Histogram),
+		summaries:      make(map[string]*summarySeries),
+		sets:           make(map[string]*hll.HLL),
+		gaugeHistory:   make(history),
+		counterHistory: make(history),
+		updated:        make(map[string]map[string]time.Time),
+		now:            time.Now,
+		retention:      DefaultHistoryRetention,
 	}
 }
 
@@ -43,6 +79,9 @@ func (m *MemStorage) UpdateGauge(name string, value float64) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	m.gauges[name] = value
+	m.touch(Gauge, name)
+	now := m.now()
+	m.gaugeHistory.add(name, Sample{Time: now, Value: value}, now, m.retention)
 }
 
 // UpdateCounter updates the value of a counter metric.
@@ -53,6 +92,46 @@ func (m *MemStorage) UpdateCounter(name string, value int64) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	m.counters[name] += value
+	m.touch(Counter, name)
+	now := m.now()
+	m.counterHistory.add(name, Sample{Time: now, Value: float64(m.counters[name])}, now, m.retention)
+}
+
+// UpdateHistogram merges value into the stored histogram with the same bounds.
+func (m *MemStorage) UpdateHistogram(name string, value Histogram) error {
+	if err := value.Validate(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current, ok := m.histograms[name]
+	if !ok {
+		h := value.Clone()
+		m.histograms[name] = &h
+	} else if err := current.Merge(value); err != nil {
+		return err
+	}
+	m.touch(HistogramType, name)
+	return nil
+}
+
+// UpdateSet merges value into the stored distinct-count sketch.
+func (m *MemStorage) UpdateSet(name string, value *hll.HLL) error {
+	if err := value.Validate(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current, ok := m.sets[name]
+	if !ok {
+		m.sets[name] = value.Clone()
+	} else if err := current.Merge(value); err != nil {
+		return err
+	}
+	m.touch(Set, name)
+	return nil
 }
 
 // GetAllMetrics returns a map of all available metrics.
@@ -67,6 +146,15 @@ func (m *MemStorage) GetAllMetrics() map[string]interface{} {
 	for name, value := range m.counters {
 		allMetrics[name] = value
 	}
+	for name, value := range m.histograms {
+		allMetrics[name] = value.Clone()
+	}
+	for name, value := range m.summaries {
+		allMetrics[name] = value.total.Clone()
+	}
+	for name, value := range m.sets {
+		allMetrics[name] = value.Clone()
+	}
 	return allMetrics
 }
 
@@ -78,16 +166,34 @@ func (m *MemStorage) GetMetric(metricType, name string) (interface{}, error) {
 	case Gauge:
 		value, ok := m.gauges[name]
 		if !ok {
-			return nil, errors.New(logger.ErrMetricInvalidType)
+			return nil, errors.New(logger.ErrMetricNotFound)
 		}
 		return value, nil
 	case Counter:
 		value, ok := m.counters[name]
 		if !ok {
-			return nil, errors.New(logger.ErrMetricInvalidType)
+			return nil, errors.New(logger.ErrMetricNotFound)
 		}
 		return value, nil
+	case HistogramType:
+		value, ok := m.histograms[name]
+		if !ok {
+			return nil, errors.New(logger.ErrMetricNotFound)
+		}
+		return value.Clone(), nil
+	case Summary:
+		value, ok := m.summaries[name]
+		if !ok {
+			return nil, errors.New(logger.ErrMetricNotFound)
+		}
+		return value.total.Clone(), nil
+	case Set:
+		value, ok := m.sets[name]
+		if !ok {
+			return nil, errors.New(logger.ErrMetricNotFound)
+		}
+		return value.Clone(), nil
 	default:
-		return nil, errors.New(logger.ErrMetricNotFound)
+		return nil, errors.New(logger.ErrMetricInvalidType)
 	}
 }
@@ -1,7 +1,16 @@
 package storage
 
 import (
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
+
+	"github.com/avointsev/yp7m-go/internal/hll"
+	"github.com/avointsev/yp7m-go/internal/labels"
+	"github.com/avointsev/yp7m-go/internal/sketch"
 )
 
 func TestUpdateGauge(t *testing.T) {
@@ -96,3 +105,385 @@ func TestGetMetricInvalidType(t *testing.T) {
 		t.Errorf("expected an error for invalid metric type, got nil")
 	}
 }
+
+func TestUpdateHistogram(t *testing.T) {
+	memStorage := NewMemStorage()
+
+	first := Histogram{Bounds: []float64{0.1, 1}, Counts: []uint64{2, 3}, Sum: 1.5, Count: 4}
+	if err := memStorage.UpdateHistogram("latency", first); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	second := Histogram{Bounds: []float64{0.1, 1}, Counts: []uint64{1, 1}, Sum: 0.05, Count: 1}
+	if err := memStorage.UpdateHistogram("latency", second); err != nil {
+		t.Fatalf("unexpected error on merge: %v", err)
+	}
+
+	value, err := memStorage.GetMetric("histogram", "latency")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	h, ok := value.(Histogram)
+	if !ok {
+		t.Fatalf("expected Histogram, got %T", value)
+	}
+	if h.Count != 5 || h.Counts[0] != 3 || h.Counts[1] != 4 || h.Sum != 1.55 {
+		t.Errorf("expected merged histogram, got %+v", h)
+	}
+
+	mismatched := Histogram{Bounds: []float64{0.5}, Counts: []uint64{1}, Sum: 0.2, Count: 1}
+	if err := memStorage.UpdateHistogram("latency", mismatched); err == nil {
+		t.Error("expected an error for mismatched bounds, got nil")
+	}
+
+	invalid := Histogram{Bounds: []float64{1, 0.5}, Counts: []uint64{1, 2}, Sum: 1, Count: 2}
+	if err := memStorage.UpdateHistogram("other", invalid); err == nil {
+		t.Error("expected an error for unsorted bounds, got nil")
+	}
+
+	infinite := Histogram{Bounds: []float64{1, math.Inf(1)}, Counts: []uint64{1, 2}, Sum: 1, Count: 2}
+	if err := memStorage.UpdateHistogram("other", infinite); err == nil {
+		t.Error("expected an error for an infinite bound, got nil")
+	}
+}
+
+func TestHistogramQuantile(t *testing.T) {
+	h := Histogram{Bounds: []float64{1, 2, 4}, Counts: []uint64{10, 20, 40}, Count: 40}
+
+	tests := []struct {
+		q    float64
+		want float64
+	}{
+		{0.25, 1},
+		{0.5, 2},
+		{0.75, 3},
+		{1, 4},
+	}
+	for _, tt := range tests {
+		if got := h.Quantile(tt.q); got != tt.want {
+			t.Errorf("Quantile(%v) = %v, want %v", tt.q, got, tt.want)
+		}
+	}
+}
+
+func TestSummaryQuantileWindows(t *testing.T) {
+	memStorage := NewMemStorage()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	memStorage.now = func() time.Time { return now }
+
+	old := sketch.New(sketch.DefaultAlpha)
+	for range 100 {
+		old.Add(1000)
+	}
+	if err := memStorage.UpdateSummary("latency", old); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	now = now.Add(10 * time.Minute)
+	recent := sketch.New(sketch.DefaultAlpha)
+	for range 100 {
+		recent.Add(10)
+	}
+	if err := memStorage.UpdateSummary("latency", recent); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	windowed, err := memStorage.GetSummaryQuantile("latency", 0.99, 5*time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if windowed < 9 || windowed > 11 {
+		t.Errorf("expected windowed p99 near 10, got %v", windowed)
+	}
+
+	total, err := memStorage.GetSummaryQuantile("latency", 0.99, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if total < 990 {
+		t.Errorf("expected all-time p99 near 1000, got %v", total)
+	}
+
+	if _, err := memStorage.GetSummaryQuantile("missing", 0.5, 0); err == nil {
+		t.Error("expected an error for missing summary, got nil")
+	}
+}
+
+func TestUpdateSet(t *testing.T) {
+	memStorage := NewMemStorage()
+
+	first, second := hll.New(hll.DefaultPrecision), hll.New(hll.DefaultPrecision)
+	first.Add("alice")
+	first.Add("bob")
+	second.Add("bob")
+	second.Add("carol")
+
+	for _, set := range []*hll.HLL{first, second} {
+		if err := memStorage.UpdateSet("users", set); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	value, err := memStorage.GetMetric("set", "users")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	set, ok := value.(*hll.HLL)
+	if !ok {
+		t.Fatalf("expected *hll.HLL, got %T", value)
+	}
+	if set.Estimate() != 3 {
+		t.Errorf("expected 3 distinct members, got %d", set.Estimate())
+	}
+
+	if err := memStorage.UpdateSet("users", hll.New(10)); err == nil {
+		t.Error("expected an error for mismatched precision, got nil")
+	}
+}
+
+func TestSaveAndLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+
+	memStorage := NewMemStorage()
+	memStorage.UpdateGauge("gauge_metric", 10.5)
+	memStorage.UpdateCounter("counter_metric", 5)
+	set := hll.New(hll.DefaultPrecision)
+	set.Add("10.0.0.1")
+	if err := memStorage.UpdateSet("ips", set); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := memStorage.SaveFile(path); err != nil {
+		t.Fatalf("unexpected save error: %v", err)
+	}
+
+	restored := NewMemStorage()
+	if err := restored.LoadFile(path); err != nil {
+		t.Fatalf("unexpected load error: %v", err)
+	}
+
+	if value, _ := restored.GetMetric("gauge", "gauge_metric"); value != 10.5 {
+		t.Errorf("expected restored gauge 10.5, got %v", value)
+	}
+	if value, _ := restored.GetMetric("counter", "counter_metric"); value != int64(5) {
+		t.Errorf("expected restored counter 5, got %v", value)
+	}
+	value, err := restored.GetMetric("set", "ips")
+	if err != nil {
+		t.Fatalf("expected restored set, got %v", err)
+	}
+	if restoredSet, ok := value.(*hll.HLL); !ok || restoredSet.Estimate() != 1 {
+		t.Errorf("expected restored set with 1 member, got %v", value)
+	}
+
+	if err := NewMemStorage().LoadFile(filepath.Join(t.TempDir(), "missing.json")); err != nil {
+		t.Errorf("expected missing file to be ignored, got %v", err)
+	}
+}
+
+func TestSaveFileNonFiniteGauges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+
+	memStorage := NewMemStorage()
+	memStorage.UpdateGauge("nan", math.NaN())
+	memStorage.UpdateGauge("inf", math.Inf(-1))
+	if err := memStorage.SaveFile(path); err != nil {
+		t.Fatalf("unexpected save error: %v", err)
+	}
+
+	restored := NewMemStorage()
+	if err := restored.LoadFile(path); err != nil {
+		t.Fatalf("unexpected load error: %v", err)
+	}
+	value, _ := restored.GetMetric("gauge", "nan")
+	if f, ok := value.(float64); !ok || !math.IsNaN(f) {
+		t.Errorf("expected restored NaN gauge, got %v", value)
+	}
+	if value, _ = restored.GetMetric("gauge", "inf"); value != math.Inf(-1) {
+		t.Errorf("expected restored -Inf gauge, got %v", value)
+	}
+}
+
+func TestLoadFileSkipsNullEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	data := `{"gauges": {"g": 1}, "histograms": {"h": null}, "summaries": {"s": null}, "sets": {"ips": null}}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("unexpected write error: %v", err)
+	}
+
+	restored := NewMemStorage()
+	if err := restored.LoadFile(path); err != nil {
+		t.Fatalf("unexpected load error: %v", err)
+	}
+	if _, err := restored.GetMetric("histogram", "h"); err == nil {
+		t.Error("expected null histogram to be skipped")
+	}
+	if value, _ := restored.GetMetric("gauge", "g"); value != 1.0 {
+		t.Errorf("expected restored gauge 1, got %v", value)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	memStorage := NewMemStorage()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	memStorage.now = func() time.Time { return now }
+	memStorage.SetHistoryRetention(10 * time.Minute)
+
+	memStorage.UpdateGaugeAt("temp", 20, now.Add(-time.Minute))
+	memStorage.UpdateGaugeAt("temp", 22, now)
+	memStorage.UpdateGaugeAt("temp", 21, now.Add(-30*time.Second))
+	memStorage.UpdateGaugeAt("temp", 5, now.Add(-time.Hour))
+
+	if value, _ := memStorage.GetMetric("gauge", "temp"); value != 22.0 {
+		t.Errorf("expected latest sample to be current value 22, got %v", value)
+	}
+
+	samples, err := memStorage.History("gauge", "temp", now.Add(-time.Hour), now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var values []float64
+	for _, s := range samples {
+		values = append(values, s.Value)
+	}
+	if len(values) != 3 || values[0] != 20 || values[1] != 21 || values[2] != 22 {
+		t.Errorf("expected ordered samples [20 21 22] within retention, got %v", values)
+	}
+
+	memStorage.UpdateCounter("hits", 2)
+	now = now.Add(time.Second)
+	memStorage.UpdateCounter("hits", 3)
+	samples, err = memStorage.History("counter", "hits", now.Add(-time.Minute), now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(samples) != 2 || samples[1].Value != 5 {
+		t.Errorf("expected cumulative counter samples, got %v", samples)
+	}
+
+	if _, err := memStorage.History("gauge", "missing", now, now); err == nil {
+		t.Error("expected an error for missing metric, got nil")
+	}
+
+	memStorage.UpdateGaugeAt("skewed", 1, now.Add(time.Hour))
+	now = now.Add(time.Second)
+	memStorage.UpdateGaugeAt("skewed", 2, now)
+	if value, _ := memStorage.GetMetric("gauge", "skewed"); value != 2.0 {
+		t.Errorf("expected a future sample not to block later ones, got %v", value)
+	}
+}
+
+func TestHistoryLimit(t *testing.T) {
+	memStorage := NewMemStorage()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	memStorage.now = func() time.Time { return now }
+
+	start := now.Add(-time.Duration(maxHistorySamples+5) * time.Millisecond)
+	for i := range maxHistorySamples + 5 {
+		memStorage.UpdateGaugeAt("fast", float64(i), start.Add(time.Duration(i)*time.Millisecond))
+	}
+	samples, err := memStorage.History("gauge", "fast", start, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(samples) != maxHistorySamples || samples[0].Value != 5 || samples[len(samples)-1].Value != maxHistorySamples+4 {
+		t.Errorf("expected the newest %d samples, got %d starting at %v", maxHistorySamples, len(samples), samples[0].Value)
+	}
+}
+
+func TestSampleJSON(t *testing.T) {
+	ts := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for value, want := range map[float64]string{
+		1.5:          `{"time":"2024-01-01T12:00:00Z","value":1.5}`,
+		math.Inf(-1): `{"time":"2024-01-01T12:00:00Z","value":null}`,
+	} {
+		data, err := json.Marshal(Sample{Time: ts, Value: value})
+		if err != nil || string(data) != want {
+			t.Errorf("expected %s, got %s (%v)", want, data, err)
+		}
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	memStorage := NewMemStorage()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	memStorage.now = func() time.Time { return now }
+	memStorage.SetExpiry(time.Minute, 10*time.Minute)
+
+	memStorage.UpdateGauge("old", 1)
+	memStorage.UpdateCounter("hits", 1)
+	now = now.Add(5 * time.Minute)
+	memStorage.UpdateGauge("fresh", 2)
+
+	f, err := memStorage.Freshness(Gauge, "old")
+	if err != nil || !f.Stale || !f.Updated.Equal(now.Add(-5*time.Minute)) {
+		t.Errorf("expected old gauge to be stale, got %+v (%v)", f, err)
+	}
+	if f, _ := memStorage.Freshness(Gauge, "fresh"); f.Stale {
+		t.Error("expected fresh gauge not to be stale")
+	}
+	if all := memStorage.AllFreshness(); len(all) != 3 || !all["hits"].Stale {
+		t.Errorf("unexpected freshness %+v", all)
+	}
+	if _, err := memStorage.Freshness(Counter, "missing"); err == nil {
+		t.Error("expected an error for missing metric, got nil")
+	}
+
+	if removed := memStorage.Expire(); removed != 0 {
+		t.Errorf("expected nothing to expire yet, removed %d", removed)
+	}
+	now = now.Add(6 * time.Minute)
+	if removed := memStorage.Expire(); removed != 2 {
+		t.Errorf("expected 2 expired metrics, removed %d", removed)
+	}
+	if _, err := memStorage.GetMetric(Gauge, "old"); err == nil {
+		t.Error("expected expired gauge to be removed")
+	}
+	if _, err := memStorage.History(Counter, "hits", now.Add(-time.Hour), now); err == nil {
+		t.Error("expected expired counter history to be removed")
+	}
+	if _, err := memStorage.GetMetric(Gauge, "fresh"); err != nil {
+		t.Errorf("expected fresh gauge to be kept: %v", err)
+	}
+}
+
+func TestDeleteAndReset(t *testing.T) {
+	memStorage := NewMemStorage()
+	memStorage.UpdateGauge(`cpu{host="a"}`, 1)
+	memStorage.UpdateGauge(`cpu{host="b"}`, 2)
+	memStorage.UpdateGauge("typo_metric", 3)
+	memStorage.UpdateCounter(`requests{host="a"}`, 5)
+	memStorage.UpdateCounter("hits", 7)
+
+	if err := memStorage.Delete(Gauge, "typo_metric"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := memStorage.GetMetric(Gauge, "typo_metric"); err == nil {
+		t.Error("expected deleted gauge to be gone")
+	}
+	if err := memStorage.Delete(Counter, "typo_metric"); err == nil {
+		t.Error("expected an error deleting a missing metric, got nil")
+	}
+
+	if err := memStorage.ResetCounter("hits"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	memStorage.UpdateCounter("hits", 2)
+	if v, _ := memStorage.GetMetric(Counter, "hits"); v != int64(2) {
+		t.Errorf("expected counter to count from zero after reset, got %v", v)
+	}
+	if err := memStorage.ResetCounter("missing"); err == nil {
+		t.Error("expected an error resetting a missing counter, got nil")
+	}
+
+	if removed := memStorage.DeleteMatching("", labels.Labels{"host": "a"}); removed != 2 {
+		t.Errorf("expected 2 metrics removed by selector, removed %d", removed)
+	}
+	if removed := memStorage.DeleteMatching("cp", nil); removed != 1 {
+		t.Errorf("expected 1 metric removed by prefix, removed %d", removed)
+	}
+	if all := memStorage.GetAllMetrics(); len(all) != 1 {
+		t.Errorf("expected only hits to remain, got %v", all)
+	}
+	if all := memStorage.AllFreshness(); len(all) != 1 {
+		t.Errorf("expected freshness of deleted metrics to be dropped, got %v", all)
+	}
+}
@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"errors"
+	"time"
+
+	"github.com/avointsev/yp7m-go/internal/logger"
+	"github.com/avointsev/yp7m-go/internal/sketch"
+)
+
+const (
+	// summaryWindow is the granularity of time-windowed summary queries.
+	summaryWindow = time.Minute
+	// summaryRetention is how far back time-windowed summary queries can look.
+	summaryRetention = time.Hour
+)
+
+// summarySeries keeps an all-time sketch and per-minute sketches for windowed queries.
+type summarySeries struct {
+	total   *sketch.Sketch
+	windows []summaryWindowSketch
+}
+
+type summaryWindowSketch struct {
+	start  time.Time
+	sketch *sketch.Sketch
+}
+
+func (s *summarySeries) add(now time.Time, value *sketch.Sketch) error {
+	if err := s.total.Merge(value); err != nil {
+		return err
+	}
+
+	start := now.Truncate(summaryWindow)
+	if n := len(s.windows); n > 0 && s.windows[n-1].start.Equal(start) {
+		return s.windows[n-1].sketch.Merge(value)
+	}
+	s.windows = append(s.windows, summaryWindowSketch{start: start, sketch: value.Clone()})
+
+	cutoff := now.Add(-summaryRetention)
+	for len(s.windows) > 0 && s.windows[0].start.Before(cutoff) {
+		s.windows = s.windows[1:]
+	}
+	return nil
+}
+
+// since merges the windows that overlap the last d before now.
+func (s *summarySeries) since(now time.Time, d time.Duration) *sketch.Sketch {
+	merged := sketch.New(s.total.Alpha)
+	cutoff := now.Add(-d).Truncate(summaryWindow)
+	for _, w := range s.windows {
+		if !w.start.Before(cutoff) {
+			_ = merged.Merge(w.sketch)
+		}
+	}
+	return merged
+}
+
+// UpdateSummary merges a quantile sketch into the stored summary metric.
+func (m *MemStorage) UpdateSummary(name string, value *sketch.Sketch) error {
+	if err := value.Validate(); err != nil {
+		return errors.Join(errors.New(logger.ErrSummaryInvalid), err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	series, ok := m.summaries[name]
+	if !ok {
+		series = &summarySeries{total: sketch.New(value.Alpha)}
+		m.summaries[name] = series
+	}
+	if err := series.add(m.now(), value); err != nil {
+		return err
+	}
+	m.touch(Summary, name)
+	return nil
+}
+
+// GetSummaryQuantile estimates the q-quantile of a summary metric.
+// A zero window uses all observations, otherwise only those of the last window.
+func (m *MemStorage) GetSummaryQuantile(name string, q float64, window time.Duration) (float64, error) {
+	if q < 0 || q > 1 {
+		return 0, errors.New(logger.ErrSummaryQuantile)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	series, ok := m.summaries[name]
+	if !ok {
+		return 0, errors.New(logger.ErrMetricNotFound)
+	}
+	if window <= 0 {
+		return series.total.Quantile(q), nil
+	}
+	if window > summaryRetention {
+		return 0, errors.New(logger.ErrSummaryWindow)
+	}
+	return series.since(m.now(), window).Quantile(q), nil
+}
@@ -0,0 +1,99 @@
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/avointsev/yp7m-go/internal/labels"
+	"github.com/avointsev/yp7m-go/internal/logger"
+)
+
+// heartbeatInterval keeps idle connections open through proxies.
+const heartbeatInterval = 15 * time.Second
+
+// Handler streams metric updates as Server-Sent Events. The type parameter
+// takes a comma-separated list of metric types, name a glob pattern on the
+// metric name and label repeated key=value pairs. Each update is sent as a
+// "metric" event; a "dropped" event reports updates lost while the client
+// was too slow to keep up.
+func Handler(b *Broker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, err := parseFilter(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, logger.ErrStreamUnsupported, http.StatusInternalServerError)
+			return
+		}
+
+		sub := b.Subscribe(filter)
+		defer b.Unsubscribe(sub)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		heartbeat := time.NewTicker(heartbeatInterval)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-b.done:
+				return
+			case <-heartbeat.C:
+				if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+					return
+				}
+			case e := <-sub.C:
+				if dropped := sub.Dropped(); dropped > 0 {
+					if _, err := fmt.Fprintf(w, "event: dropped\ndata: {\"dropped\":%d}\n\n", dropped); err != nil {
+						return
+					}
+				}
+				data, err := json.Marshal(e)
+				if err != nil {
+					log.Printf(logger.LogDefaultFormat, logger.ErrWriteResponce, err)
+					continue
+				}
+				if _, err := fmt.Fprintf(w, "event: metric\ndata: %s\n\n", data); err != nil {
+					return
+				}
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func parseFilter(r *http.Request) (Filter, error) {
+	query := r.URL.Query()
+	var filter Filter
+	if types := query.Get("type"); types != "" {
+		filter.Types = strings.Split(types, ",")
+	}
+	filter.Name = query.Get("name")
+	if _, err := path.Match(filter.Name, ""); err != nil {
+		return Filter{}, fmt.Errorf("%s: %w", logger.ErrStreamFilter, err)
+	}
+	for _, pair := range query["label"] {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			return Filter{}, fmt.Errorf("%s: label %q", logger.ErrStreamFilter, pair)
+		}
+		if filter.Labels == nil {
+			filter.Labels = make(labels.Labels)
+		}
+		filter.Labels[key] = value
+	}
+	return filter, nil
+}
@@ -0,0 +1,91 @@
+package stream
+
+import (
+	"time"
+
+	"github.com/avointsev/yp7m-go/internal/hll"
+	"github.com/avointsev/yp7m-go/internal/server/storage"
+	"github.com/avointsev/yp7m-go/internal/sketch"
+)
+
+// Store wraps a storage and publishes every successful write to the broker.
+// Bulk deletes are not published, as the removed names are not known.
+type Store struct {
+	storage.StorageType
+	broker *Broker
+}
+
+// Wrap returns store publishing its updates to b.
+func (b *Broker) Wrap(store storage.StorageType) *Store {
+	return &Store{StorageType: store, broker: b}
+}
+
+func (s *Store) UpdateGauge(name string, value float64) {
+	s.StorageType.UpdateGauge(name, value)
+	s.publishValue(storage.Gauge, name, nil)
+}
+
+func (s *Store) UpdateGaugeAt(name string, value float64, ts time.Time) {
+	s.StorageType.UpdateGaugeAt(name, value, ts)
+	s.publishValue(storage.Gauge, name, nil)
+}
+
+func (s *Store) UpdateCounter(name string, value int64) {
+	s.StorageType.UpdateCounter(name, value)
+	if value > 0 {
+		s.publishValue(storage.Counter, name, &value)
+	}
+}
+
+func (s *Store) UpdateHistogram(name string, value storage.Histogram) error {
+	return s.published(storage.HistogramType, name, s.StorageType.UpdateHistogram(name, value))
+}
+
+func (s *Store) UpdateSummary(name string, value *sketch.Sketch) error {
+	return s.published(storage.Summary, name, s.StorageType.UpdateSummary(name, value))
+}
+
+func (s *Store) UpdateSet(name string, value *hll.HLL) error {
+	return s.published(storage.Set, name, s.StorageType.UpdateSet(name, value))
+}
+
+func (s *Store) ResetCounter(name string) error {
+	if err := s.StorageType.ResetCounter(name); err != nil {
+		return err
+	}
+	s.publishValue(storage.Counter, name, nil)
+	return nil
+}
+
+func (s *Store) Delete(metricType, name string) error {
+	if err := s.StorageType.Delete(metricType, name); err != nil {
+		return err
+	}
+	if s.broker.listening() {
+		s.broker.publish(Event{Type: metricType, Name: name, Deleted: true, Time: time.Now()})
+	}
+	return nil
+}
+
+// publishValue publishes the current value of a gauge or counter.
+func (s *Store) publishValue(metricType, name string, delta *int64) {
+	if !s.broker.listening() {
+		return
+	}
+	e := Event{Type: metricType, Name: name, Delta: delta, Time: time.Now()}
+	switch v, _ := s.StorageType.GetMetric(metricType, name); v := v.(type) {
+	case float64:
+		e.Value = &v
+	case int64:
+		f := float64(v)
+		e.Value = &f
+	}
+	s.broker.publish(e)
+}
+
+func (s *Store) published(metricType, name string, err error) error {
+	if err == nil && s.broker.listening() {
+		s.broker.publish(Event{Type: metricType, Name: name, Time: time.Now()})
+	}
+	return err
+}
@@ -0,0 +1,140 @@
+// Package stream publishes metric updates written through the storage to
+// live subscribers. Slow subscribers do not hold up writers: events that do
+// not fit in a subscriber's buffer are dropped and counted.
+package stream
+
+import (
+	"path"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/avointsev/yp7m-go/internal/labels"
+)
+
+// bufferSize is how many events a subscriber may fall behind before events are dropped.
+const bufferSize = 256
+
+// Event is one metric update. Value holds the current value of gauges and
+// counters and Delta the increment of a counter update.
+type Event struct {
+	Type    string    `json:"type"`
+	Name    string    `json:"id"`
+	Value   *float64  `json:"value,omitempty"`
+	Delta   *int64    `json:"delta,omitempty"`
+	Deleted bool      `json:"deleted,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// Filter selects events by metric type, a glob pattern on the metric name
+// and label values. Empty fields match everything.
+type Filter struct {
+	Types  []string
+	Name   string
+	Labels labels.Labels
+}
+
+// Match reports whether e passes the filter.
+func (f Filter) Match(e Event) bool {
+	if len(f.Types) > 0 && !contains(f.Types, e.Type) {
+		return false
+	}
+	name, l, err := labels.Parse(e.Name)
+	if err != nil {
+		return false
+	}
+	if f.Name != "" {
+		if ok, _ := path.Match(f.Name, name); !ok {
+			return false
+		}
+	}
+	for k, v := range f.Labels {
+		if l[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Subscription receives the events matching its filter.
+type Subscription struct {
+	C       <-chan Event
+	events  chan Event
+	filter  Filter
+	dropped atomic.Int64
+}
+
+// Dropped returns and resets the number of events dropped since the last call.
+func (s *Subscription) Dropped() int64 {
+	return s.dropped.Swap(0)
+}
+
+// Broker fans events out to subscriptions.
+type Broker struct {
+	subs map[*Subscription]struct{}
+	done chan struct{}
+	once sync.Once
+	// active lets writers skip building events when nobody listens.
+	active atomic.Int32
+	mu     sync.RWMutex
+}
+
+// NewBroker creates a broker without subscribers.
+func NewBroker() *Broker {
+	return &Broker{subs: make(map[*Subscription]struct{}), done: make(chan struct{})}
+}
+
+// Close ends every open stream, e.g. on server shutdown.
+func (b *Broker) Close() {
+	b.once.Do(func() { close(b.done) })
+}
+
+// Subscribe registers a subscription for events matching filter.
+func (b *Broker) Subscribe(filter Filter) *Subscription {
+	events := make(chan Event, bufferSize)
+	sub := &Subscription{C: events, events: events, filter: filter}
+	b.mu.Lock()
+	b.subs[sub] = struct{}{}
+	b.mu.Unlock()
+	b.active.Add(1)
+	return sub
+}
+
+// Unsubscribe removes sub; its channel is not closed.
+func (b *Broker) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	if _, ok := b.subs[sub]; ok {
+		delete(b.subs, sub)
+		b.active.Add(-1)
+	}
+	b.mu.Unlock()
+}
+
+func (b *Broker) listening() bool {
+	return b.active.Load() > 0
+}
+
+func (b *Broker) publish(e Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for sub := range b.subs {
+		if !sub.filter.Match(e) {
+			continue
+		}
+		select {
+		case sub.events <- e:
+		default:
+			sub.dropped.Add(1)
+		}
+	}
+}
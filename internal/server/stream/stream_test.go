@@ -0,0 +1,129 @@
+package stream
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/avointsev/yp7m-go/internal/labels"
+	"github.com/avointsev/yp7m-go/internal/server/storage"
+)
+
+func TestFilterMatch(t *testing.T) {
+	e := Event{Type: storage.Gauge, Name: `cpu_usage{host="web1"}`}
+	tests := []struct {
+		filter Filter
+		want   bool
+	}{
+		{Filter{}, true},
+		{Filter{Types: []string{"counter", "gauge"}}, true},
+		{Filter{Types: []string{"counter"}}, false},
+		{Filter{Name: "cpu_*"}, true},
+		{Filter{Name: "mem_*"}, false},
+		{Filter{Labels: labels.Labels{"host": "web1"}}, true},
+		{Filter{Labels: labels.Labels{"host": "web2"}}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.filter.Match(e); got != tt.want {
+			t.Errorf("%+v.Match = %v; want %v", tt.filter, got, tt.want)
+		}
+	}
+}
+
+func TestStorePublishes(t *testing.T) {
+	broker := NewBroker()
+	store := broker.Wrap(storage.NewMemStorage())
+	store.UpdateGauge("unheard", 1)
+
+	sub := broker.Subscribe(Filter{Types: []string{storage.Counter}})
+	defer broker.Unsubscribe(sub)
+	store.UpdateGauge("ignored", 1)
+	store.UpdateCounter("hits", 2)
+	store.UpdateCounter("hits", 3)
+
+	for _, want := range []float64{2, 5} {
+		select {
+		case e := <-sub.C:
+			if e.Name != "hits" || e.Value == nil || *e.Value != want || e.Delta == nil {
+				t.Errorf("unexpected event %+v", e)
+			}
+		default:
+			t.Fatalf("expected counter event with value %v", want)
+		}
+	}
+	select {
+	case e := <-sub.C:
+		t.Errorf("unexpected extra event %+v", e)
+	default:
+	}
+
+	for range bufferSize + 3 {
+		store.UpdateCounter("hits", 1)
+	}
+	if dropped := sub.Dropped(); dropped != 3 {
+		t.Errorf("expected 3 dropped events, got %d", dropped)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	broker := NewBroker()
+	store := broker.Wrap(storage.NewMemStorage())
+	server := httptest.NewServer(Handler(broker))
+	defer server.Close()
+
+	if resp, err := http.Get(server.URL + "?label=bad"); err != nil || resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected bad request for invalid label filter, got %v", err)
+	} else if err := resp.Body.Close(); err != nil {
+		t.Errorf("could not close response body: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"?type=gauge&name=Heap*", http.NoBody)
+	if err != nil {
+		t.Fatalf("could not create request: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("could not connect: %v", err)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			t.Errorf("could not close response body: %v", err)
+		}
+	}()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+
+	store.UpdateGauge("Other", 1)
+	store.UpdateGauge("HeapAlloc", 42)
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var e Event
+		if err := json.Unmarshal([]byte(data), &e); err != nil {
+			t.Fatalf("could not decode event %q: %v", data, err)
+		}
+		if e.Name != "HeapAlloc" || e.Value == nil || *e.Value != 42 {
+			t.Errorf("unexpected event %+v", e)
+		}
+		break
+	}
+
+	broker.Close()
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			t.Errorf("expected stream to end after close, got %q", line)
+		}
+	}
+}
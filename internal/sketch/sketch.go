@@ -0,0 +1,181 @@
+// Package sketch implements a mergeable quantile sketch with relative accuracy
+// guarantees, following the DDSketch algorithm.
+package sketch
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// DefaultAlpha is the relative accuracy used when none is given.
+const DefaultAlpha = 0.01
+
+// ErrAlphaMismatch is returned when merging sketches with different accuracy.
+var ErrAlphaMismatch = errors.New("sketch relative accuracy does not match")
+
+// Sketch stores observations in logarithmically sized buckets so that every
+// quantile estimate is within Alpha relative error of the true value.
+type Sketch struct {
+	Positive map[int]uint64 `json:"positive,omitempty"`
+	Negative map[int]uint64 `json:"negative,omitempty"`
+	Alpha    float64        `json:"alpha"`
+	Zero     uint64         `json:"zero,omitempty"`
+	Count    uint64         `json:"count"`
+	Sum      float64        `json:"sum"`
+}
+
+// New creates an empty sketch with relative accuracy alpha.
+func New(alpha float64) *Sketch {
+	return &Sketch{
+		Alpha:    alpha,
+		Positive: make(map[int]uint64),
+		Negative: make(map[int]uint64),
+	}
+}
+
+// Validate checks that the sketch can be used for merging and queries.
+func (s *Sketch) Validate() error {
+	if s.Alpha <= 0 || s.Alpha >= 1 {
+		return fmt.Errorf("invalid sketch alpha %v", s.Alpha)
+	}
+	var total uint64 = s.Zero
+	for _, c := range s.Positive {
+		total += c
+	}
+	for _, c := range s.Negative {
+		total += c
+	}
+	if total != s.Count {
+		return fmt.Errorf("sketch bucket counts %d do not match count %d", total, s.Count)
+	}
+	return nil
+}
+
+func (s *Sketch) gamma() float64 {
+	return (1 + s.Alpha) / (1 - s.Alpha)
+}
+
+func (s *Sketch) key(v float64) int {
+	return int(math.Ceil(math.Log(v) / math.Log(s.gamma())))
+}
+
+func (s *Sketch) value(key int) float64 {
+	g := s.gamma()
+	return 2 * math.Pow(g, float64(key)) / (g + 1)
+}
+
+// Add records a single observation. NaN and infinite values are ignored.
+func (s *Sketch) Add(v float64) {
+	s.AddN(v, 1)
+}
+
+// AddN records n observations of v at once, as when v stands for a sampled
+// stream. NaN and infinite values are ignored.
+func (s *Sketch) AddN(v float64, n uint64) {
+	if n == 0 || math.IsNaN(v) || math.IsInf(v, 0) {
+		return
+	}
+	if s.Positive == nil {
+		s.Positive = make(map[int]uint64)
+	}
+	if s.Negative == nil {
+		s.Negative = make(map[int]uint64)
+	}
+	switch {
+	case v > 0:
+		s.Positive[s.key(v)] += n
+	case v < 0:
+		s.Negative[s.key(-v)] += n
+	default:
+		s.Zero += n
+	}
+	s.Count += n
+	s.Sum += v * float64(n)
+}
+
+// Merge adds the observations of other, which must have the same Alpha.
+func (s *Sketch) Merge(other *Sketch) error {
+	if other.Alpha != s.Alpha {
+		return ErrAlphaMismatch
+	}
+	if s.Positive == nil {
+		s.Positive = make(map[int]uint64)
+	}
+	if s.Negative == nil {
+		s.Negative = make(map[int]uint64)
+	}
+	for k, c := range other.Positive {
+		s.Positive[k] += c
+	}
+	for k, c := range other.Negative {
+		s.Negative[k] += c
+	}
+	s.Zero += other.Zero
+	s.Count += other.Count
+	s.Sum += other.Sum
+	return nil
+}
+
+// Clone returns a deep copy of the sketch.
+func (s *Sketch) Clone() *Sketch {
+	c := *s
+	c.Positive = maps.Clone(s.Positive)
+	c.Negative = maps.Clone(s.Negative)
+	return &c
+}
+
+// Quantile returns an estimate of the q-quantile, or NaN for an empty sketch.
+func (s *Sketch) Quantile(q float64) float64 {
+	if s.Count == 0 || q < 0 || q > 1 {
+		return math.NaN()
+	}
+	rank := uint64(q * float64(s.Count-1))
+
+	var seen uint64
+	negative := sortedKeys(s.Negative)
+	for i := len(negative) - 1; i >= 0; i-- {
+		seen += s.Negative[negative[i]]
+		if seen > rank {
+			return -s.value(negative[i])
+		}
+	}
+	seen += s.Zero
+	if seen > rank {
+		return 0
+	}
+	positive := sortedKeys(s.Positive)
+	for _, k := range positive {
+		seen += s.Positive[k]
+		if seen > rank {
+			return s.value(k)
+		}
+	}
+	if len(positive) > 0 {
+		return s.value(positive[len(positive)-1])
+	}
+	return 0
+}
+
+// String renders count, sum and common quantiles for display.
+func (s *Sketch) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "count=%d sum=%s", s.Count, strconv.FormatFloat(s.Sum, 'f', -1, 64))
+	for _, q := range []float64{0.5, 0.95, 0.99} {
+		fmt.Fprintf(&b, " p%s=%s", strconv.FormatFloat(q*100, 'f', -1, 64), strconv.FormatFloat(s.Quantile(q), 'g', 4, 64))
+	}
+	return b.String()
+}
+
+func sortedKeys(m map[int]uint64) []int {
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,73 @@
+package sketch
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestQuantileAccuracy(t *testing.T) {
+	s := New(DefaultAlpha)
+	for i := 1; i <= 1000; i++ {
+		s.Add(float64(i))
+	}
+
+	for _, q := range []float64{0.5, 0.95, 0.99} {
+		want := q * 999
+		got := s.Quantile(q)
+		if math.Abs(got-want) > want*DefaultAlpha+1 {
+			t.Errorf("Quantile(%v) = %v, want about %v", q, got, want)
+		}
+	}
+}
+
+func TestMergeMatchesSingleSketch(t *testing.T) {
+	a, b, all := New(DefaultAlpha), New(DefaultAlpha), New(DefaultAlpha)
+	for i := -50; i <= 100; i++ {
+		v := float64(i)
+		all.Add(v)
+		if i%2 == 0 {
+			a.Add(v)
+		} else {
+			b.Add(v)
+		}
+	}
+
+	if err := a.Merge(b); err != nil {
+		t.Fatalf("unexpected merge error: %v", err)
+	}
+	if a.Count != all.Count || a.Sum != all.Sum {
+		t.Fatalf("expected merged count %d sum %v, got %d %v", all.Count, all.Sum, a.Count, a.Sum)
+	}
+	for _, q := range []float64{0, 0.1, 0.5, 0.9, 1} {
+		if a.Quantile(q) != all.Quantile(q) {
+			t.Errorf("Quantile(%v) differs after merge: %v vs %v", q, a.Quantile(q), all.Quantile(q))
+		}
+	}
+
+	if err := a.Merge(New(0.05)); err == nil {
+		t.Error("expected error when merging sketches with different alpha")
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	s := New(DefaultAlpha)
+	for _, v := range []float64{0, 1.5, 20, -3} {
+		s.Add(v)
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatalf("unexpected marshal error: %v", err)
+	}
+	var decoded Sketch
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("unexpected unmarshal error: %v", err)
+	}
+	if err := decoded.Validate(); err != nil {
+		t.Fatalf("expected decoded sketch to be valid: %v", err)
+	}
+	if decoded.Quantile(0.5) != s.Quantile(0.5) {
+		t.Errorf("expected same median after round trip, got %v and %v", decoded.Quantile(0.5), s.Quantile(0.5))
+	}
+}
@@ -0,0 +1,139 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// issue creates a certificate signed by parent, or a self-signed CA when parent is nil.
+func issue(t *testing.T, dir, name string, parent *testCert, isClient bool) (*testCert, string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("could not generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.cert, parent.key
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		if isClient {
+			template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatalf("could not create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("could not parse certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("could not marshal key: %v", err)
+	}
+
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+
+	return &testCert{cert: cert, key: key}, certFile, keyFile
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("could not write %s: %v", path, err)
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca, caFile, _ := issue(t, dir, "ca", nil, false)
+	_, serverCert, serverKey := issue(t, dir, "server", ca, false)
+	_, clientCert, clientKey := issue(t, dir, "client", ca, true)
+
+	serverConfig, err := ServerConfig(serverCert, serverKey, caFile)
+	if err != nil {
+		t.Fatalf("unexpected server config error: %v", err)
+	}
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	ts.TLS = serverConfig
+	ts.StartTLS()
+	defer ts.Close()
+
+	get := func(config *tls.Config) error {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+		resp, err := client.Get(ts.URL)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+
+	withCert, err := ClientConfig(caFile, clientCert, clientKey)
+	if err != nil {
+		t.Fatalf("unexpected client config error: %v", err)
+	}
+	if err := get(withCert); err != nil {
+		t.Errorf("expected request with client certificate to succeed, got %v", err)
+	}
+
+	withoutCert, err := ClientConfig(caFile, "", "")
+	if err != nil {
+		t.Fatalf("unexpected client config error: %v", err)
+	}
+	if err := get(withoutCert); err == nil {
+		t.Error("expected request without client certificate to fail")
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	if _, err := ServerConfig("", "", ""); err == nil {
+		t.Error("expected error for missing server key pair")
+	}
+	if _, err := ClientConfig("", "client.crt", ""); err == nil {
+		t.Error("expected error for client certificate without key")
+	}
+	if _, err := ClientConfig(filepath.Join(t.TempDir(), "missing.pem"), "", ""); err == nil {
+		t.Error("expected error for missing CA bundle")
+	}
+}